@@ -18,6 +18,7 @@ import (
 	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/redis/go-redis/v9"
+	"github.com/twmb/franz-go/pkg/kgo"
 )
 
 type EnvVars struct {
@@ -94,10 +95,24 @@ func main() {
 		*startHeight = lastProcessedBlock.Height
 	}
 
+	// Creates the block stream
+	var blockStream streams.IBlockStream
+	switch envvars.BlockStreamBackend {
+	case "kafka":
+		kafkaClient, err := kgo.NewClient(kgo.SeedBrokers(envvars.KafkaBrokers...))
+		if err != nil {
+			panic(err)
+		}
+		defer kafkaClient.Close()
+		blockStream = streams.NewKafkaBlockStream(kafkaClient, envvars.ChainID, &streams.KafkaBlockStreamOpts{Codec: envvars.BlockStream.Codec})
+	default:
+		blockStream = streams.NewBlockStream(redisStreamClient, envvars.ChainID, envvars.BlockStream.Opts())
+	}
+
 	// Creates the service
 	service := blockforwarder.NewBlockForwarder(
 		ethsrc.NewEthBlockSource(ethClient, startHeight),
-		streams.NewBlockStream(redisStreamClient, envvars.ChainID),
+		blockStream,
 	)
 
 	// Runs the service until the context is cancelled
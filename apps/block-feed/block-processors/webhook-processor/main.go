@@ -3,7 +3,9 @@ package main
 import (
 	"context"
 	"database/sql"
+	"encoding/base64"
 	"log"
+	"net/http"
 	"os/signal"
 	"syscall"
 	"time"
@@ -13,9 +15,12 @@ import (
 	"github.com/chris-de-leon/block-feed-prototype/block-stores/redistore"
 	"github.com/chris-de-leon/block-feed-prototype/block-stores/timescalestore"
 	"github.com/chris-de-leon/block-feed-prototype/common"
+	"github.com/chris-de-leon/block-feed-prototype/netguard"
 	"github.com/chris-de-leon/block-feed-prototype/queries"
 	"github.com/chris-de-leon/block-feed-prototype/services/blockrelay"
 	"github.com/chris-de-leon/block-feed-prototype/streams"
+	"github.com/chris-de-leon/block-feed-prototype/webhookauth"
+	"github.com/chris-de-leon/block-feed-prototype/webhookcache"
 
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -29,6 +34,54 @@ type EnvVars struct {
 	MySqlConnPoolSize int   `validate:"required,gt=0" env:"WEBHOOK_PROCESSOR_MYSQL_CONN_POOL_SIZE,required"`
 	ConsumerPoolSize  int   `validate:"required,gt=0" env:"WEBHOOK_PROCESSOR_POOL_SIZE,required"`
 	ShardID           int32 `validate:"required,gt=0" env:"WEBHOOK_PROCESSOR_SHARD_ID,required"`
+	ErrorSinkSize     int64 `validate:"required,gt=0" env:"WEBHOOK_PROCESSOR_ERROR_SINK_SIZE" envDefault:"50"`
+	LedgerSize        int64 `validate:"required,gt=0" env:"WEBHOOK_PROCESSOR_DELIVERY_LEDGER_SIZE" envDefault:"100"`
+	DelayedPollMs     int   `validate:"required,gt=0" env:"WEBHOOK_PROCESSOR_DELAYED_POLL_MS" envDefault:"1000"`
+	AttemptLogSize    int   `validate:"gte=0" env:"WEBHOOK_PROCESSOR_ATTEMPT_LOG_SIZE" envDefault:"100"`
+
+	// Webhook config cache - updates are pushed over redis, the TTL only matters if one is missed
+	CacheTTLMs      int `validate:"required,gt=0" env:"WEBHOOK_PROCESSOR_CACHE_TTL_MS" envDefault:"60000"`
+	CacheMaxEntries int `validate:"required,gt=0" env:"WEBHOOK_PROCESSOR_CACHE_MAX_ENTRIES" envDefault:"10000"`
+
+	// Circuit breaker settings - webhooks are deactivated after failing for the whole failure window
+	CircuitFailureThreshold int64  `validate:"required,gt=0" env:"WEBHOOK_PROCESSOR_CIRCUIT_FAILURE_THRESHOLD" envDefault:"5"`
+	CircuitProbeIntervalMs  int64  `validate:"required,gt=0" env:"WEBHOOK_PROCESSOR_CIRCUIT_PROBE_INTERVAL_MS" envDefault:"60000"`
+	CircuitFailureWindowMs  int64  `validate:"required,gt=0" env:"WEBHOOK_PROCESSOR_CIRCUIT_FAILURE_WINDOW_MS" envDefault:"86400000"`
+	NotifierUrl             string `validate:"omitempty,url" env:"WEBHOOK_PROCESSOR_NOTIFIER_URL"`
+
+	// Delivery quotas shared by every processor - zero values disable the corresponding limit
+	CustomerRateLimit   float64 `validate:"gte=0" env:"WEBHOOK_PROCESSOR_CUSTOMER_RATE_LIMIT"`
+	CustomerBurst       int64   `validate:"gte=0" env:"WEBHOOK_PROCESSOR_CUSTOMER_BURST"`
+	CustomerMaxInFlight int64   `validate:"gte=0" env:"WEBHOOK_PROCESSOR_CUSTOMER_MAX_IN_FLIGHT"`
+	HostRateLimit       float64 `validate:"gte=0" env:"WEBHOOK_PROCESSOR_HOST_RATE_LIMIT"`
+	HostBurst           int64   `validate:"gte=0" env:"WEBHOOK_PROCESSOR_HOST_BURST"`
+	HostMaxInFlight     int64   `validate:"gte=0" env:"WEBHOOK_PROCESSOR_HOST_MAX_IN_FLIGHT"`
+
+	// Backfill quotas per shard - keeps webhooks that are catching up from starving real-time jobs
+	BackfillRateLimit   float64 `validate:"gte=0" env:"WEBHOOK_PROCESSOR_BACKFILL_RATE_LIMIT"`
+	BackfillBurst       int64   `validate:"gte=0" env:"WEBHOOK_PROCESSOR_BACKFILL_BURST"`
+	BackfillMaxInFlight int64   `validate:"gte=0" env:"WEBHOOK_PROCESSOR_BACKFILL_MAX_IN_FLIGHT" envDefault:"1"`
+
+	// HTTP transport settings - zero values fall back to the defaults in the blockrelay package
+	HttpMaxIdleConns          int  `validate:"gte=0" env:"WEBHOOK_PROCESSOR_HTTP_MAX_IDLE_CONNS"`
+	HttpMaxIdleConnsPerHost   int  `validate:"gte=0" env:"WEBHOOK_PROCESSOR_HTTP_MAX_IDLE_CONNS_PER_HOST"`
+	HttpMaxConnsPerHost       int  `validate:"gte=0" env:"WEBHOOK_PROCESSOR_HTTP_MAX_CONNS_PER_HOST"`
+	HttpIdleConnTimeoutMs     int  `validate:"gte=0" env:"WEBHOOK_PROCESSOR_HTTP_IDLE_CONN_TIMEOUT_MS"`
+	HttpDialTimeoutMs         int  `validate:"gte=0" env:"WEBHOOK_PROCESSOR_HTTP_DIAL_TIMEOUT_MS"`
+	HttpTLSHandshakeTimeoutMs int  `validate:"gte=0" env:"WEBHOOK_PROCESSOR_HTTP_TLS_HANDSHAKE_TIMEOUT_MS"`
+	HttpKeepAliveMs           int  `validate:"gte=0" env:"WEBHOOK_PROCESSOR_HTTP_KEEP_ALIVE_MS"`
+	HttpDisableHTTP2          bool `env:"WEBHOOK_PROCESSOR_HTTP_DISABLE_HTTP2"`
+	RequireVerification       bool `env:"WEBHOOK_PROCESSOR_REQUIRE_VERIFICATION"`
+
+	// SSRF protection - deliveries to private addresses are blocked unless they are allowed here
+	GuardEnabled    bool     `env:"WEBHOOK_PROCESSOR_GUARD_ENABLED" envDefault:"true"`
+	GuardAllowCIDRs []string `env:"WEBHOOK_PROCESSOR_GUARD_ALLOW_CIDRS" envSeparator:","`
+	GuardDenyCIDRs  []string `env:"WEBHOOK_PROCESSOR_GUARD_DENY_CIDRS" envSeparator:","`
+	GuardHttpsOnly  bool     `env:"WEBHOOK_PROCESSOR_GUARD_HTTPS_ONLY"`
+
+	// Webhook credentials - the key decrypts custom headers / basic auth and the directory holds client certificates
+	AuthKey       string `validate:"omitempty,base64" env:"WEBHOOK_PROCESSOR_AUTH_KEY"`
+	ClientCertDir string `validate:"omitempty,dir" env:"WEBHOOK_PROCESSOR_CLIENT_CERT_DIR"`
 }
 
 // NOTE: multiple replicas of this service can be created per chain
@@ -107,14 +160,101 @@ func main() {
 		panic(err)
 	}
 
+	// Creates a notifier if customers should be told when their webhooks are deactivated
+	var notifier blockrelay.IWebhookNotifier
+	if envvars.NotifierUrl != "" {
+		notifier = blockrelay.NewHttpNotifier(&http.Client{Timeout: 10 * time.Second}, envvars.NotifierUrl)
+	}
+
+	// Creates the database queries and caches the webhooks that they load
+	mysqlQueries := queries.New(mysqlClient)
+	webhookCache := webhookcache.NewWebhookCache(redisClusterClient, mysqlQueries.WebhooksFindOne, &webhookcache.WebhookCacheOpts{
+		TTL:        time.Duration(envvars.CacheTTLMs) * time.Millisecond,
+		MaxEntries: envvars.CacheMaxEntries,
+	})
+
+	// Creates a guard that stops deliveries from reaching private addresses (if enabled)
+	var guard *netguard.Guard
+	if envvars.GuardEnabled {
+		guard, err = netguard.NewGuard(&netguard.GuardOpts{
+			AllowCIDRs: envvars.GuardAllowCIDRs,
+			DenyCIDRs:  envvars.GuardDenyCIDRs,
+			HttpsOnly:  envvars.GuardHttpsOnly,
+		})
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	// Creates the cipher that decrypts webhook credentials (if configured)
+	var authCipher *webhookauth.Cipher
+	if envvars.AuthKey != "" {
+		key, err := base64.StdEncoding.DecodeString(envvars.AuthKey)
+		if err != nil {
+			panic(err)
+		}
+		authCipher, err = webhookauth.NewCipher(key)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	// Creates the store that loads client certificates for mutual TLS (if configured)
+	var certStore *webhookauth.CertStore
+	if envvars.ClientCertDir != "" {
+		certStore = webhookauth.NewCertStore(envvars.ClientCertDir)
+	}
+
 	// Creates the service
 	service := blockrelay.NewBlockRelay(blockrelay.BlockRelayParams{
-		WebhookStream: streams.NewWebhookStream(redisClusterClient, shardID),
-		Queries:       queries.New(mysqlClient),
-		BlockStore:    store,
+		WebhookStream:  streams.NewWebhookStream(redisClusterClient, shardID, envvars.WebhookStream.Opts()),
+		DeliveryLedger: streams.NewDeliveryLedger(redisClusterClient, shardID, envvars.LedgerSize),
+		DeliveryStates: streams.NewDeliveryStates(redisClusterClient, shardID),
+		ErrorSink:      streams.NewRedisErrorSink(redisClusterClient, envvars.ErrorSinkSize),
+		CircuitBreaker: streams.NewCircuitBreaker(redisClusterClient, shardID, &streams.CircuitBreakerOpts{
+			FailureThreshold: envvars.CircuitFailureThreshold,
+			ProbeInterval:    time.Duration(envvars.CircuitProbeIntervalMs) * time.Millisecond,
+			FailureWindow:    time.Duration(envvars.CircuitFailureWindowMs) * time.Millisecond,
+		}),
+		DeliveryQuotas: streams.NewDeliveryQuotas(redisClusterClient, &streams.DeliveryQuotasOpts{
+			Customer: streams.QuotaOpts{
+				RatePerSecond: envvars.CustomerRateLimit,
+				Burst:         envvars.CustomerBurst,
+				MaxInFlight:   envvars.CustomerMaxInFlight,
+			},
+			Host: streams.QuotaOpts{
+				RatePerSecond: envvars.HostRateLimit,
+				Burst:         envvars.HostBurst,
+				MaxInFlight:   envvars.HostMaxInFlight,
+			},
+			Backfill: streams.QuotaOpts{
+				RatePerSecond: envvars.BackfillRateLimit,
+				Burst:         envvars.BackfillBurst,
+				MaxInFlight:   envvars.BackfillMaxInFlight,
+			},
+		}),
+		Notifier:     notifier,
+		WebhookCache: webhookCache,
+		Queries:      mysqlQueries,
+		BlockStore:   store,
+		AuthCipher:   authCipher,
+		CertStore:    certStore,
 		Opts: &blockrelay.BlockRelayOpts{
-			ConsumerName: envvars.ConsumerName,
-			Concurrency:  envvars.ConsumerPoolSize,
+			ConsumerName:   envvars.ConsumerName,
+			Concurrency:    envvars.ConsumerPoolSize,
+			DelayedPollMs:  envvars.DelayedPollMs,
+			AttemptLogSize: envvars.AttemptLogSize,
+
+			MaxIdleConns:          envvars.HttpMaxIdleConns,
+			MaxIdleConnsPerHost:   envvars.HttpMaxIdleConnsPerHost,
+			MaxConnsPerHost:       envvars.HttpMaxConnsPerHost,
+			IdleConnTimeoutMs:     envvars.HttpIdleConnTimeoutMs,
+			DialTimeoutMs:         envvars.HttpDialTimeoutMs,
+			TLSHandshakeTimeoutMs: envvars.HttpTLSHandshakeTimeoutMs,
+			KeepAliveMs:           envvars.HttpKeepAliveMs,
+			DisableHTTP2:          envvars.HttpDisableHTTP2,
+			RequireVerification:   envvars.RequireVerification,
+			Guard:                 guard,
 		},
 	})
 
@@ -15,6 +15,7 @@ import (
 
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/redis/go-redis/v9"
+	"github.com/twmb/franz-go/pkg/kgo"
 )
 
 type EnvVars struct {
@@ -90,12 +91,30 @@ func main() {
 	// are delivered
 	webhookStreams := make([]*streams.WebhookStream, envvars.ShardCount)
 	for shardID := range envvars.ShardCount {
-		webhookStreams[shardID] = streams.NewWebhookStream(redisClusterClient, shardID)
+		webhookStreams[shardID] = streams.NewWebhookStream(redisClusterClient, shardID, envvars.WebhookStream.Opts())
+	}
+
+	// Creates the block stream - kafka consumers must join the consumer group
+	// when the client is created
+	var blockStream streams.IBlockStream
+	switch envvars.BlockStreamBackend {
+	case "kafka":
+		kafkaClient, err := kgo.NewClient(append(
+			streams.KafkaBlockStreamConsumerOpts(envvars.ChainID),
+			kgo.SeedBrokers(envvars.KafkaBrokers...),
+		)...)
+		if err != nil {
+			panic(err)
+		}
+		defer kafkaClient.Close()
+		blockStream = streams.NewKafkaBlockStream(kafkaClient, envvars.ChainID, &streams.KafkaBlockStreamOpts{Codec: envvars.BlockStream.Codec})
+	default:
+		blockStream = streams.NewBlockStream(redisStreamClient, envvars.ChainID, envvars.BlockStream.Opts())
 	}
 
 	// Creates the service
 	service := blockrouter.NewBlockRouter(blockrouter.BlockRouterParams{
-		BlockStream:    streams.NewBlockStream(redisStreamClient, envvars.ChainID),
+		BlockStream:    blockStream,
 		WebhookStreams: webhookStreams,
 		BlockStore:     store,
 		Opts: &blockrouter.BlockRouterOpts{
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"text/tabwriter"
+
+	"github.com/chris-de-leon/block-feed-prototype/common"
+	"github.com/chris-de-leon/block-feed-prototype/streams"
+
+	"github.com/redis/go-redis/v9"
+)
+
+type Report struct {
+	BlockStream   *streams.StreamHealth        `json:"blockStream"`
+	WebhookShards []streams.WebhookShardHealth `json:"webhookShards"`
+}
+
+// Prints the health of the block stream and every webhook stream shard of a chain.
+// Flags default to the same env variables that the other block-feed services use.
+func main() {
+	// Close the context when a stop/kill signal is received
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	// Parses the command line flags
+	redisClusterUrl := flag.String("redis-cluster-url", os.Getenv("CHAIN_REDIS_CLUSTER_URL"), "address of the redis cluster that stores the webhook streams")
+	redisStreamUrl := flag.String("redis-stream-url", os.Getenv("CHAIN_REDIS_STREAM_URL"), "address of the redis instance that stores the block stream (omit to skip)")
+	shardCount := flag.Int("shards", envInt("CHAIN_SHARD_COUNT"), "number of webhook shards for the chain")
+	asJson := flag.Bool("json", false, "print the report as JSON")
+	flag.Parse()
+
+	// Validates the flags
+	if *redisClusterUrl == "" || *shardCount <= 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	// Creates a redis cluster client
+	redisClusterClient := redis.NewClusterClient(&redis.ClusterOptions{
+		Addrs:                 []string{*redisClusterUrl},
+		ContextTimeoutEnabled: true,
+	})
+	defer func() {
+		if err := redisClusterClient.Close(); err != nil {
+			common.LogError(nil, err)
+		}
+	}()
+
+	// Gets the health of the webhook streams
+	report := Report{}
+	shards, err := streams.GetWebhookShardsHealth(ctx, redisClusterClient, int32(*shardCount))
+	if err != nil {
+		panic(err)
+	} else {
+		report.WebhookShards = shards
+	}
+
+	// Gets the health of the block stream if it is backed by redis
+	if *redisStreamUrl != "" {
+		redisStreamClient := redis.NewClient(&redis.Options{
+			Addr:                  *redisStreamUrl,
+			ContextTimeoutEnabled: true,
+		})
+		defer func() {
+			if err := redisStreamClient.Close(); err != nil {
+				common.LogError(nil, err)
+			}
+		}()
+
+		health, err := streams.NewBlockStream(redisStreamClient, "", nil).Health(ctx)
+		if err != nil {
+			panic(err)
+		} else {
+			report.BlockStream = health
+		}
+	}
+
+	// Prints the report
+	if *asJson {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			panic(err)
+		}
+	} else {
+		printReport(report)
+	}
+}
+
+func printReport(report Report) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	defer w.Flush()
+
+	// Prints one row per shard
+	fmt.Fprintln(w, "SHARD\tSTREAM LENGTH\tWEBHOOKS\tPENDING SET\tDELAYED SET\tPARKED SET\tLATEST HEIGHT")
+	for _, shard := range report.WebhookShards {
+		latestHeight := "-"
+		if shard.LatestBlockHeight != nil {
+			latestHeight = strconv.FormatUint(*shard.LatestBlockHeight, 10)
+		}
+		fmt.Fprintf(w, "%d\t%d\t%d\t%d\t%d\t%d\t%s\n",
+			shard.ShardID,
+			shard.Stream.Length,
+			shard.WebhookSetSize,
+			shard.PendingSetSize,
+			shard.DelayedSetSize,
+			shard.ParkedSetSize,
+			latestHeight,
+		)
+	}
+	fmt.Fprintln(w)
+
+	// Collects every stream so that the groups and consumers can be printed together
+	allStreams := []streams.StreamHealth{}
+	if report.BlockStream != nil {
+		allStreams = append(allStreams, *report.BlockStream)
+	}
+	for _, shard := range report.WebhookShards {
+		allStreams = append(allStreams, shard.Stream)
+	}
+
+	// Prints one row per consumer group
+	fmt.Fprintln(w, "STREAM\tGROUP\tLAG\tPENDING\tLAST DELIVERED ID")
+	for _, stream := range allStreams {
+		for _, group := range stream.Groups {
+			fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s\n", stream.Name, group.Name, group.Lag, group.Pending, group.LastDeliveredID)
+		}
+	}
+	fmt.Fprintln(w)
+
+	// Prints one row per consumer
+	fmt.Fprintln(w, "STREAM\tGROUP\tCONSUMER\tPENDING\tIDLE\tINACTIVE")
+	for _, stream := range allStreams {
+		for _, group := range stream.Groups {
+			for _, consumer := range group.Consumers {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%dms\t%dms\n", stream.Name, group.Name, consumer.Name, consumer.Pending, consumer.IdleMs, consumer.InactiveMs)
+			}
+		}
+	}
+}
+
+func envInt(key string) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return 0
+	}
+	return value
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"net"
+	"net/http"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/chris-de-leon/block-feed-prototype/appenv"
+	"github.com/chris-de-leon/block-feed-prototype/block-stores/cachedstore"
+	"github.com/chris-de-leon/block-feed-prototype/block-stores/redistore"
+	"github.com/chris-de-leon/block-feed-prototype/block-stores/timescalestore"
+	"github.com/chris-de-leon/block-feed-prototype/common"
+	"github.com/chris-de-leon/block-feed-prototype/netguard"
+	"github.com/chris-de-leon/block-feed-prototype/queries"
+	"github.com/chris-de-leon/block-feed-prototype/services/webhooks"
+	"github.com/chris-de-leon/block-feed-prototype/streams"
+	"github.com/chris-de-leon/block-feed-prototype/webhookauth"
+	"github.com/chris-de-leon/block-feed-prototype/webhookverify"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/sync/errgroup"
+)
+
+type EnvVars struct {
+	MySqlUrl string `validate:"required,gt=0" env:"WEBHOOK_RECONCILER_MYSQL_URL,required"`
+	appenv.ChainEnv
+	MySqlConnPoolSize int   `validate:"required,gt=0" env:"WEBHOOK_RECONCILER_MYSQL_CONN_POOL_SIZE,required"`
+	IntervalMs        int   `validate:"required,gt=0" env:"WEBHOOK_RECONCILER_INTERVAL_MS" envDefault:"60000"`
+	BatchSize         int32 `validate:"required,gt=0" env:"WEBHOOK_RECONCILER_BATCH_SIZE" envDefault:"1000"`
+	VerifyEndpoints   bool  `env:"WEBHOOK_RECONCILER_VERIFY_ENDPOINTS" envDefault:"true"`
+
+	// The API that the dashboard uses to activate, pause, resume, and remove webhooks
+	ApiAddr  string `validate:"required,gt=0" env:"WEBHOOK_RECONCILER_API_ADDR" envDefault:":8080"`
+	ApiToken string `validate:"required,gt=0" env:"WEBHOOK_RECONCILER_API_TOKEN,required"`
+
+	// SSRF protection for verification challenges (see the webhook processor's settings)
+	GuardEnabled    bool     `env:"WEBHOOK_RECONCILER_GUARD_ENABLED" envDefault:"true"`
+	GuardAllowCIDRs []string `env:"WEBHOOK_RECONCILER_GUARD_ALLOW_CIDRS" envSeparator:","`
+	GuardDenyCIDRs  []string `env:"WEBHOOK_RECONCILER_GUARD_DENY_CIDRS" envSeparator:","`
+	GuardHttpsOnly  bool     `env:"WEBHOOK_RECONCILER_GUARD_HTTPS_ONLY"`
+
+	// Webhook credentials that are presented during verification (see the webhook processor's settings)
+	AuthKey       string `validate:"omitempty,base64" env:"WEBHOOK_RECONCILER_AUTH_KEY"`
+	ClientCertDir string `validate:"omitempty,dir" env:"WEBHOOK_RECONCILER_CLIENT_CERT_DIR"`
+}
+
+// NOTE: only one replica of this service is needed per chain
+func main() {
+	// Close the context when a stop/kill signal is received
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	// Loads env variables into a struct and validates them
+	envvars, err := appenv.LoadEnvVars[EnvVars]()
+	if err != nil {
+		panic(err)
+	}
+
+	// Creates a mysql client
+	mysqlClient, err := sql.Open("mysql", envvars.MySqlUrl)
+	if err != nil {
+		panic(err)
+	} else {
+		defer func() {
+			if err := mysqlClient.Close(); err != nil {
+				common.LogError(nil, err)
+			}
+		}()
+		mysqlClient.SetConnMaxLifetime(time.Duration(30) * time.Second)
+		mysqlClient.SetMaxOpenConns(envvars.MySqlConnPoolSize)
+		mysqlClient.SetMaxIdleConns(envvars.MySqlConnPoolSize)
+	}
+
+	// Creates a redis cluster client
+	redisClusterClient := redis.NewClusterClient(&redis.ClusterOptions{
+		Addrs:                 []string{envvars.RedisClusterUrl},
+		ContextTimeoutEnabled: true,
+	})
+	defer func() {
+		if err := redisClusterClient.Close(); err != nil {
+			common.LogError(nil, err)
+		}
+	}()
+
+	// Creates a redis store client
+	redisStoreClient := redis.NewClient(&redis.Options{
+		Addr:                  envvars.RedisStoreUrl,
+		ContextTimeoutEnabled: true,
+	})
+	defer func() {
+		if err := redisStoreClient.Close(); err != nil {
+			common.LogError(nil, err)
+		}
+	}()
+
+	// Creates a database connection pool
+	pgClient, err := pgxpool.New(ctx, envvars.PgStoreUrl)
+	if err != nil {
+		panic(err)
+	}
+	defer pgClient.Close()
+
+	// Creates a block store which is used to check that cursors and replays start from blocks that are still stored
+	store := cachedstore.NewRedisOptimizedBlockStore(
+		timescalestore.NewTimescaleBlockStore(pgClient),
+		redistore.NewRedisBlockStore(redisStoreClient),
+	)
+
+	// Creates a list of webhook streams - one per shard
+	webhookStreams := make([]*streams.WebhookStream, envvars.ShardCount)
+	for shardID := range envvars.ShardCount {
+		webhookStreams[shardID] = streams.NewWebhookStream(redisClusterClient, shardID, envvars.WebhookStream.Opts())
+	}
+
+	// Creates a guard that stops challenges from reaching private addresses (if enabled)
+	var guard *netguard.Guard
+	if envvars.GuardEnabled {
+		guard, err = netguard.NewGuard(&netguard.GuardOpts{
+			AllowCIDRs: envvars.GuardAllowCIDRs,
+			DenyCIDRs:  envvars.GuardDenyCIDRs,
+			HttpsOnly:  envvars.GuardHttpsOnly,
+		})
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	// Defines a helper function that creates a client for sending verification challenges
+	newClient := func(tlsConfig *tls.Config) *http.Client {
+		dialer := &net.Dialer{Timeout: 5 * time.Second}
+		if guard != nil {
+			dialer = guard.Dialer(dialer)
+		}
+		var transport http.RoundTripper = &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: 5 * time.Second,
+			TLSClientConfig:     tlsConfig,
+		}
+		if guard != nil {
+			transport = guard.Transport(transport)
+		}
+		return &http.Client{Transport: transport}
+	}
+
+	// Creates the cipher that decrypts webhook credentials (if configured)
+	var authCipher *webhookauth.Cipher
+	if envvars.AuthKey != "" {
+		key, err := base64.StdEncoding.DecodeString(envvars.AuthKey)
+		if err != nil {
+			panic(err)
+		}
+		authCipher, err = webhookauth.NewCipher(key)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	// Creates clients that present client certificates for mutual TLS (if configured)
+	var newCertClient func(certName string) (*http.Client, error)
+	if envvars.ClientCertDir != "" {
+		certStore := webhookauth.NewCertStore(envvars.ClientCertDir)
+		newCertClient = func(certName string) (*http.Client, error) {
+			if _, err := certStore.Get(certName); err != nil {
+				return nil, err
+			}
+			return newClient(&tls.Config{
+				GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+					return certStore.Get(certName)
+				},
+			}), nil
+		}
+	}
+
+	// Creates an endpoint verifier (if enabled) - challenges time out with their webhook
+	var verifier *webhookverify.EndpointVerifier
+	if envvars.VerifyEndpoints {
+		verifier = webhookverify.NewEndpointVerifier(newClient(nil), newCertClient)
+	}
+
+	// Creates the service
+	service := webhooks.NewWebhookService(webhooks.WebhookServiceParams{
+		WebhookStreams: webhookStreams,
+		RedisClient:    redisClusterClient,
+		Queries:        queries.New(mysqlClient),
+		Verifier:       verifier,
+		AuthCipher:     authCipher,
+		BlockStore:     store,
+		Opts: &webhooks.WebhookServiceOpts{
+			ChainID: envvars.ChainID,
+		},
+	})
+
+	// Creates the reconciler
+	reconciler := webhooks.NewWebhookReconciler(service, &webhooks.WebhookReconcilerOpts{
+		IntervalMs: envvars.IntervalMs,
+		BatchSize:  envvars.BatchSize,
+	})
+
+	// Creates the API server
+	server := &http.Server{
+		Addr:              envvars.ApiAddr,
+		Handler:           webhooks.NewWebhookApi(service, &webhooks.WebhookApiOpts{Token: envvars.ApiToken}).Handler(),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	// Creates an error group so that the API and the reconciler can run in parallel
+	eg := new(errgroup.Group)
+
+	// Serves the API until the context is cancelled
+	eg.Go(func() error {
+		defer cancel()
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		return nil
+	})
+
+	// Stops the API once the context is cancelled
+	eg.Go(func() error {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		return server.Shutdown(shutdownCtx)
+	})
+
+	// Repairs drift between MySQL and redis until the context is cancelled
+	eg.Go(func() error {
+		defer cancel()
+		return reconciler.Run(ctx)
+	})
+
+	// Waits for everything to stop
+	if err := eg.Wait(); err != nil {
+		common.LogError(nil, err)
+		panic(err)
+	}
+}
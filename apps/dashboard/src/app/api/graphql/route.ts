@@ -15,6 +15,8 @@ import {
   withStripeWebhookEventHandler,
   requireStripeSubscription,
   GraphQLContext,
+  zWebhookAuthEnv,
+  zWebhookApiEnv,
   withClerkJWT,
   zStripeEnv,
   builder,
@@ -27,6 +29,8 @@ const envvars = z
     REDIS_CACHE_EXP_MS: z.coerce.number().min(1),
   })
   .and(zStripeEnv)
+  .and(zWebhookAuthEnv)
+  .and(zWebhookApiEnv)
   .parse(process.env)
 
 const stripeProvider = new stripe.Provider(stripe.zEnv.parse(process.env))
@@ -76,6 +80,8 @@ const { handleRequest } = createYoga({
       },
       env: {
         stripe: envvars,
+        webhookAuth: envvars,
+        webhookApi: envvars,
       },
     }) satisfies GraphQLContext,
   plugins: [
@@ -48,10 +48,29 @@ export type StripeSubscriptionStatus =
   | 'trialing'
   | 'unpaid';
 
+export type WebhookAuthHeaderInput = {
+  name: Scalars['String']['input'];
+  value: Scalars['String']['input'];
+};
+
+export type WebhookAuthInput = {
+  basicAuth?: InputMaybe<WebhookBasicAuthInput>;
+  clientCert?: InputMaybe<Scalars['String']['input']>;
+  headers?: InputMaybe<Array<WebhookAuthHeaderInput>>;
+};
+
+export type WebhookBasicAuthInput = {
+  password: Scalars['String']['input'];
+  username: Scalars['String']['input'];
+};
+
 export type WebhookCreateInput = {
+  auth?: InputMaybe<WebhookAuthInput>;
   blockchainId: Scalars['String']['input'];
+  legacyPayload?: InputMaybe<Scalars['Boolean']['input']>;
   maxBlocks: Scalars['Int']['input'];
   maxRetries: Scalars['Int']['input'];
+  startHeight?: InputMaybe<Scalars['Int']['input']>;
   timeoutMs: Scalars['Int']['input'];
   url: Scalars['String']['input'];
 };
@@ -67,6 +86,8 @@ export type WebhookFiltersInput = {
 };
 
 export type WebhookUpdateInput = {
+  auth?: InputMaybe<WebhookAuthInput>;
+  legacyPayload?: InputMaybe<Scalars['Boolean']['input']>;
   maxBlocks?: InputMaybe<Scalars['Int']['input']>;
   maxRetries?: InputMaybe<Scalars['Int']['input']>;
   timeoutMs?: InputMaybe<Scalars['Int']['input']>;
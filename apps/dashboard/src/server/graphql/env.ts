@@ -8,3 +8,17 @@ export const zStripeEnv = z.object({
   STRIPE_BILLING_PORTAL_RETURN_URL: z.string().url().min(1),
   STRIPE_CUSTOMER_PORTAL_URL: z.string().url().min(1),
 })
+
+export const zWebhookAuthEnv = z.object({
+  WEBHOOK_AUTH_KEY: z
+    .string()
+    .base64()
+    .refine((key) => Buffer.from(key, "base64").length === 32, {
+      message: "WEBHOOK_AUTH_KEY must be a base64 encoded 32 byte key",
+    })
+    .optional(),
+})
+
+export const zWebhookApiEnv = z.object({
+  WEBHOOK_API_TOKEN: z.string().min(1),
+})
@@ -6,7 +6,7 @@ import { mysql } from "@block-feed/node-providers-mysql"
 import { clerk } from "@block-feed/node-providers-clerk"
 import { YogaInitialContext } from "graphql-yoga"
 import { User } from "@clerk/clerk-sdk-node"
-import { zStripeEnv } from "./env"
+import { zStripeEnv, zWebhookApiEnv, zWebhookAuthEnv } from "./env"
 import { Stripe } from "stripe"
 import { z } from "zod"
 
@@ -29,6 +29,8 @@ export type BaseContext = Readonly<{
   }>
   env: Readonly<{
     stripe: z.infer<typeof zStripeEnv>
+    webhookAuth: z.infer<typeof zWebhookAuthEnv>
+    webhookApi: z.infer<typeof zWebhookApiEnv>
   }>
 }>
 
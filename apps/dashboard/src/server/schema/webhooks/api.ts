@@ -0,0 +1,54 @@
+import { GraphQLAuthContext } from "../../graphql/types"
+import {
+  gqlInternalServerError,
+  gqlBadRequestError,
+} from "../../graphql/errors"
+
+// NOTE: these routes should match the ones served by the webhook reconciler of each chain
+type WebhookApiRequest = Readonly<{
+  method: "POST" | "DELETE"
+  path: "" | "/activate"
+}>
+
+export const WEBHOOK_API_REQUESTS = {
+  activate: { method: "POST", path: "/activate" },
+  remove: { method: "DELETE", path: "" },
+} as const satisfies Record<string, WebhookApiRequest>
+
+// Sends a lifecycle operation to the webhook service of a chain so that MySQL and redis are
+// changed in one place. Resolves to false if the webhook no longer exists. The caller must
+// check that the customer owns the webhook before calling this function.
+export const callWebhookApi = async (
+  ctx: GraphQLAuthContext,
+  url: string,
+  webhookId: string,
+  req: WebhookApiRequest,
+) => {
+  const res = await fetch(
+    new URL(`/webhooks/${encodeURIComponent(webhookId)}${req.path}`, url),
+    {
+      method: req.method,
+      headers: {
+        Authorization: `Bearer ${ctx.env.webhookApi.WEBHOOK_API_TOKEN}`,
+      },
+    },
+  ).catch((err) => {
+    throw gqlInternalServerError(String(err))
+  })
+
+  if (res.ok) {
+    return true
+  }
+  if (res.status === 404) {
+    return false
+  }
+
+  // Errors that were caused by the state of the webhook (e.g. its endpoint could not
+  // be verified) are reported back to the customer
+  const body = await res.json().catch(() => ({}))
+  const msg = typeof body.error === "string" ? body.error : res.statusText
+  if (res.status === 409 || res.status === 422) {
+    throw gqlBadRequestError(msg)
+  }
+  throw gqlInternalServerError(msg)
+}
@@ -0,0 +1,77 @@
+import { GraphQLAuthContext } from "../../graphql/types"
+import { gqlBadRequestError } from "../../graphql/errors"
+import { createCipheriv, randomBytes } from "crypto"
+import { z } from "zod"
+
+// NOTE: the encryption scheme should match the one in the Go backend (see webhookauth)
+const ALGORITHM = "aes-256-gcm"
+const NONCE_SIZE = 12
+
+export const zWebhookAuthInput = z.object({
+  headers: z
+    .array(
+      z.object({
+        name: z
+          .string()
+          .min(1)
+          .max(256)
+          .regex(/^[!#$%&'*+\-.^_`|~0-9A-Za-z]+$/, "invalid header name"),
+        value: z
+          .string()
+          .max(4096)
+          .regex(/^[^\r\n\0]*$/, "invalid header value"),
+      }),
+    )
+    .max(20)
+    .nullish(),
+  basicAuth: z
+    .object({
+      username: z.string().min(1).max(256),
+      password: z.string().max(1024),
+    })
+    .nullish(),
+  clientCert: z
+    .string()
+    .min(1)
+    .max(253)
+    .regex(/^[a-z0-9]([-a-z0-9.]*[a-z0-9])?$/, "invalid client certificate")
+    .nullish(),
+})
+
+// Encrypts the credentials that the webhook processors present to a webhook's endpoint.
+// The webhook ID is authenticated along with the credentials so that they can't be copied
+// to another webhook. If no credentials are given then null is returned, which clears them.
+export const encryptWebhookAuth = (
+  ctx: GraphQLAuthContext,
+  webhookId: string,
+  auth: z.infer<typeof zWebhookAuthInput>,
+) => {
+  const config = {
+    headers:
+      auth.headers != null && auth.headers.length !== 0
+        ? Object.fromEntries(auth.headers.map((h) => [h.name, h.value]))
+        : undefined,
+    basicAuth: auth.basicAuth ?? undefined,
+    clientCert: auth.clientCert ?? undefined,
+  }
+  if (Object.values(config).every((v) => v == null)) {
+    return null
+  }
+
+  const key = ctx.env.webhookAuth.WEBHOOK_AUTH_KEY
+  if (key == null) {
+    throw gqlBadRequestError("webhook credentials are not supported")
+  }
+
+  const nonce = randomBytes(NONCE_SIZE)
+  const cipher = createCipheriv(ALGORITHM, Buffer.from(key, "base64"), nonce)
+  cipher.setAAD(Buffer.from(webhookId))
+  const ciphertext = Buffer.concat([
+    cipher.update(JSON.stringify(config)),
+    cipher.final(),
+  ])
+
+  return Buffer.concat([nonce, ciphertext, cipher.getAuthTag()]).toString(
+    "base64",
+  )
+}
@@ -1,5 +1,5 @@
 import { constants } from "@block-feed/dashboard/utils/constants"
-import { gqlInternalServerError } from "../../../graphql/errors"
+import { callWebhookApi, WEBHOOK_API_REQUESTS } from "../api"
 import { GraphQLAuthContext } from "../../../graphql/types"
 import { and, eq, inArray } from "drizzle-orm"
 import * as schema from "@block-feed/node-db"
@@ -21,7 +21,7 @@ export const handler = async (
     return { count: 0 }
   }
 
-  // Gets the webhooks and their corresponding redis cluster connection info
+  // Gets the webhooks that the customer owns and the API of their blockchain
   const results = await ctx.providers.mysql.drizzle.query.webhook.findMany({
     where: and(
       eq(schema.webhook.customerId, ctx.clerk.user.id),
@@ -38,69 +38,19 @@ export const handler = async (
     return { count: 0 }
   }
 
-  // Groups the webhooks into a nested map: Redis Cluster URL -> Shard ID -> Webhook IDs
-  const clusterMap = new Map<string, Map<number, string[]>>()
-  results.forEach((result) => {
-    const shards = clusterMap.get(result.blockchain.redisClusterUrl)
-    if (shards == null) {
-      clusterMap.set(
-        result.blockchain.redisClusterUrl,
-        new Map([[result.shardId, [result.id]]]),
-      )
-    } else {
-      const webhookIds = shards.get(result.shardId)
-      if (webhookIds == null) {
-        shards.set(result.shardId, [result.id])
-      } else {
-        shards.set(result.shardId, webhookIds.concat(result.id))
-      }
-    }
-  })
-
-  // Collects all promises into an array
-  const promises = Array.from(Array.from(clusterMap.entries()))
-    .map(([url, shards]) => {
-      const redisClusterProvider = ctx.caches.redisClusterConn.getOrSet(url, {
-        REDIS_CLUSTER_URL: url,
-      })
-
-      return Array.from(shards.entries()).map(async ([shardId, webhookIds]) => {
-        // NOTE: these key names are case sensitive and should
-        // match the names in the Go backend
-        //
-        // TODO: it may be better to add these to a single configuration
-        // file that is read by both the Go code and the Typescript code
-        // instead of hardcoding it in two places
-        await redisClusterProvider.client.activate(
-          `block-feed:{s${shardId}}:webhook-set`,
-          `block-feed:{s${shardId}}:pending-set`,
-          ...webhookIds,
-        )
-
-        // TODO: if the request above succeeds but this query fails then
-        // this will cause the dashboard to display a misleading status
-        await ctx.providers.mysql.drizzle
-          .update(schema.webhook)
-          .set({ isActive: 1 })
-          .where(
-            and(
-              eq(schema.webhook.customerId, ctx.clerk.user.id),
-              inArray(schema.webhook.id, webhookIds),
-            ),
-          )
-      })
-    })
-    .flat()
-
-  // Idempotently activates the webhooks
-  await Promise.allSettled(promises).then((results) => {
-    results.forEach((result) => {
-      if (result.status === "rejected") {
-        throw gqlInternalServerError(result.reason)
-      }
-    })
-  })
+  // The Go backend verifies HTTP endpoints before it marks the webhooks as
+  // active in MySQL and adds their jobs to redis
+  const activated = await Promise.all(
+    results.map((webhook) =>
+      callWebhookApi(
+        ctx,
+        webhook.blockchain.webhookApiUrl,
+        webhook.id,
+        WEBHOOK_API_REQUESTS.activate,
+      ),
+    ),
+  )
 
-  // Returns a successful response if no errors occurred
-  return { count: 1 }
+  // Returns the number of webhooks that were activated
+  return { count: activated.filter(Boolean).length }
 }
@@ -1,6 +1,7 @@
 import { constants } from "@block-feed/dashboard/utils/constants"
 import { GraphQLAuthContext } from "../../../graphql/types"
-import { randomUUID, randomInt } from "crypto"
+import { randomUUID, randomInt, randomBytes } from "crypto"
+import { encryptWebhookAuth, zWebhookAuthInput } from "../auth"
 import * as schema from "@block-feed/node-db"
 import { eq } from "drizzle-orm"
 import { z } from "zod"
@@ -35,6 +36,13 @@ export const zInput = z.object({
       .string()
       .min(constants.webhooks.limits.BLOCKCHAIN_ID.MIN)
       .max(constants.webhooks.limits.BLOCKCHAIN_ID.MAX),
+    startHeight: z
+      .number()
+      .int()
+      .min(constants.webhooks.limits.START_HEIGHT.MIN)
+      .nullish(),
+    legacyPayload: z.boolean().nullish(),
+    auth: zWebhookAuthInput.nullish(),
   }),
 })
 
@@ -65,6 +73,13 @@ export const handler = async (
       customerId: ctx.clerk.user.id,
       blockchainId: args.data.blockchainId,
       shardId: randomInt(0, blockchain.shardCount),
+      signingSecret: `whsec_${randomBytes(32).toString("hex")}`,
+      startHeight: args.data.startHeight ?? null,
+      legacyPayload: args.data.legacyPayload ? 1 : 0,
+      encryptedAuth:
+        args.data.auth != null
+          ? encryptWebhookAuth(ctx, uuid, args.data.auth)
+          : null,
     })
     .then(([result]) => {
       if (result.affectedRows === 0) {
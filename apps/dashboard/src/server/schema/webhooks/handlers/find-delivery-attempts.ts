@@ -0,0 +1,44 @@
+import { constants } from "@block-feed/dashboard/utils/constants"
+import { gqlBadRequestError } from "../../../graphql/errors"
+import { GraphQLAuthContext } from "../../../graphql/types"
+import * as schema from "@block-feed/node-db"
+import { and, desc, eq, lt } from "drizzle-orm"
+import { z } from "zod"
+
+export const zInput = z.object({
+  id: z.string().uuid(),
+  limit: z
+    .number()
+    .int()
+    .min(constants.pagination.limits.LIMIT.MIN)
+    .max(constants.pagination.limits.LIMIT.MAX),
+  before: z.number().int().optional().nullable(),
+})
+
+export const handler = async (
+  args: z.infer<typeof zInput>,
+  ctx: GraphQLAuthContext,
+) => {
+  const webhook = await ctx.providers.mysql.drizzle.query.webhook.findFirst({
+    where: and(
+      eq(schema.webhook.customerId, ctx.clerk.user.id),
+      eq(schema.webhook.id, args.id),
+    ),
+  })
+  if (webhook == null) {
+    throw gqlBadRequestError(`record with id "${args.id}" does not exist`)
+  }
+
+  return await ctx.providers.mysql.drizzle.query.webhookDeliveryAttempt.findMany(
+    {
+      where: and(
+        eq(schema.webhookDeliveryAttempt.webhookId, webhook.id),
+        args.before != null
+          ? lt(schema.webhookDeliveryAttempt.id, args.before)
+          : undefined,
+      ),
+      limit: args.limit,
+      orderBy: [desc(schema.webhookDeliveryAttempt.id)],
+    },
+  )
+}
@@ -1,4 +1,5 @@
 import { constants } from "@block-feed/dashboard/utils/constants"
+import { callWebhookApi, WEBHOOK_API_REQUESTS } from "../api"
 import { GraphQLAuthContext } from "../../../graphql/types"
 import { and, eq, inArray } from "drizzle-orm"
 import * as schema from "@block-feed/node-db"
@@ -19,15 +20,29 @@ export const handler = async (
     return { count: 0 }
   }
 
-  return await ctx.providers.mysql.drizzle
-    .delete(schema.webhook)
-    .where(
-      and(
-        eq(schema.webhook.customerId, ctx.clerk.user.id),
-        inArray(schema.webhook.id, args.ids),
+  // Gets the webhooks that the customer owns and the API of their blockchain
+  const webhooks = await ctx.providers.mysql.drizzle.query.webhook.findMany({
+    where: and(
+      eq(schema.webhook.customerId, ctx.clerk.user.id),
+      inArray(schema.webhook.id, args.ids),
+    ),
+    with: {
+      blockchain: true,
+    },
+  })
+
+  // The Go backend deletes the webhooks from MySQL, removes their jobs from
+  // redis, and tells the webhook processors to drop their cached copies
+  const removed = await Promise.all(
+    webhooks.map((webhook) =>
+      callWebhookApi(
+        ctx,
+        webhook.blockchain.webhookApiUrl,
+        webhook.id,
+        WEBHOOK_API_REQUESTS.remove,
       ),
-    )
-    .then(([result]) => ({
-      count: result.affectedRows,
-    }))
+    ),
+  )
+
+  return { count: removed.filter(Boolean).length }
 }
@@ -1,5 +1,7 @@
 import { constants } from "@block-feed/dashboard/utils/constants"
 import { GraphQLAuthContext } from "../../../graphql/types"
+import { encryptWebhookAuth, zWebhookAuthInput } from "../auth"
+import { invalidateWebhooks } from "../invalidate"
 import * as schema from "@block-feed/node-db"
 import { and, eq } from "drizzle-orm"
 import { z } from "zod"
@@ -35,6 +37,8 @@ export const zInput = z.object({
       .max(constants.webhooks.limits.TIMEOUT_MS.MAX)
       .optional()
       .nullable(),
+    legacyPayload: z.boolean().optional().nullable(),
+    auth: zWebhookAuthInput.optional().nullable(),
   }),
 })
 
@@ -46,13 +50,37 @@ export const handler = async (
     return { count: 0 }
   }
 
-  return await ctx.providers.mysql.drizzle
+  // Gets the webhook and its corresponding redis cluster connection info
+  const webhook = await ctx.providers.mysql.drizzle.query.webhook.findFirst({
+    where: and(
+      eq(schema.webhook.customerId, ctx.clerk.user.id),
+      eq(schema.webhook.id, args.id),
+    ),
+    with: {
+      blockchain: true,
+    },
+  })
+
+  // Exits early if the webhook does not exist
+  if (webhook == null) {
+    return { count: 0 }
+  }
+
+  const result = await ctx.providers.mysql.drizzle
     .update(schema.webhook)
     .set({
       maxRetries: args.data.maxRetries ?? undefined,
       maxBlocks: args.data.maxBlocks ?? undefined,
       timeoutMs: args.data.timeoutMs ?? undefined,
       url: args.data.url ?? undefined,
+      legacyPayload:
+        args.data.legacyPayload == null
+          ? undefined
+          : Number(args.data.legacyPayload),
+      encryptedAuth:
+        args.data.auth == null
+          ? undefined
+          : encryptWebhookAuth(ctx, webhook.id, args.data.auth),
     })
     .where(
       and(
@@ -63,4 +91,11 @@ export const handler = async (
     .then(([result]) => ({
       count: result.affectedRows,
     }))
+
+  // Tells the webhook processors to drop their cached copy of the webhook
+  await invalidateWebhooks(ctx, webhook.blockchain.redisClusterUrl, [
+    webhook.id,
+  ])
+
+  return result
 }
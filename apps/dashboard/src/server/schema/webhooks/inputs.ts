@@ -5,12 +5,51 @@ import {
   gqlBoolEqFilterInput,
 } from "../../graphql/inputs"
 
+export const gqlWebhookAuthHeaderInput = builder.inputType(
+  "WebhookAuthHeaderInput",
+  {
+    fields: (t) => ({
+      name: t.string({ required: true }),
+      value: t.string({ required: true }),
+    }),
+  },
+)
+
+export const gqlWebhookBasicAuthInput = builder.inputType(
+  "WebhookBasicAuthInput",
+  {
+    fields: (t) => ({
+      username: t.string({ required: true }),
+      password: t.string({ required: true }),
+    }),
+  },
+)
+
+export const gqlWebhookAuthInput = builder.inputType("WebhookAuthInput", {
+  fields: (t) => ({
+    headers: t.field({
+      type: [gqlWebhookAuthHeaderInput],
+      required: false,
+    }),
+    basicAuth: t.field({
+      type: gqlWebhookBasicAuthInput,
+      required: false,
+    }),
+    clientCert: t.string({ required: false }),
+  }),
+})
+
 export const gqlWebhookUpdateInput = builder.inputType("WebhookUpdateInput", {
   fields: (t) => ({
     url: t.string({ required: false }),
     maxBlocks: t.int({ required: false }),
     maxRetries: t.int({ required: false }),
     timeoutMs: t.int({ required: false }),
+    legacyPayload: t.boolean({ required: false }),
+    auth: t.field({
+      type: gqlWebhookAuthInput,
+      required: false,
+    }),
   }),
 })
 
@@ -21,6 +60,12 @@ export const gqlWebhookCreateInput = builder.inputType("WebhookCreateInput", {
     maxRetries: t.int({ required: true }),
     timeoutMs: t.int({ required: true }),
     blockchainId: t.string({ required: true }),
+    startHeight: t.int({ required: false }),
+    legacyPayload: t.boolean({ required: false }),
+    auth: t.field({
+      type: gqlWebhookAuthInput,
+      required: false,
+    }),
   }),
 })
 
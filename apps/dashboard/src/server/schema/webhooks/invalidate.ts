@@ -0,0 +1,22 @@
+import { GraphQLAuthContext } from "../../graphql/types"
+
+// NOTE: this channel name is case sensitive and should match the name in the Go backend
+const INVALIDATION_CHANNEL = "block-feed:webhook-invalidations"
+
+// Tells the webhook processors connected to a redis cluster to drop their cached copies
+// of the given webhooks so that changes take effect right away
+export const invalidateWebhooks = async (
+  ctx: GraphQLAuthContext,
+  url: string,
+  webhookIds: string[],
+) => {
+  const redisClusterProvider = ctx.caches.redisClusterConn.getOrSet(url, {
+    REDIS_CLUSTER_URL: url,
+  })
+
+  await Promise.all(
+    webhookIds.map((id) =>
+      redisClusterProvider.client.publish(INVALIDATION_CHANNEL, id),
+    ),
+  )
+}
@@ -14,11 +14,36 @@ builder.objectType(gqlWebhook, {
     maxBlocks: t.exposeInt("maxBlocks"),
     maxRetries: t.exposeInt("maxRetries"),
     timeoutMs: t.exposeInt("timeoutMs"),
+    startHeight: t.exposeInt("startHeight", { nullable: true }),
+    legacyPayload: t.exposeInt("legacyPayload"),
+    hasAuth: t.boolean({
+      resolve: (webhook) => webhook.encryptedAuth != null,
+    }),
     customerId: t.exposeString("customerId"),
     blockchainId: t.exposeString("blockchainId"),
   }),
 })
 
+export const gqlWebhookDeliveryAttempt = builder.objectRef<
+  InferSelectModel<typeof schema.webhookDeliveryAttempt>
+>("WebhookDeliveryAttempt")
+
+builder.objectType(gqlWebhookDeliveryAttempt, {
+  fields: (t) => ({
+    id: t.exposeInt("id"),
+    createdAt: t.exposeString("createdAt"),
+    webhookId: t.exposeString("webhookId"),
+    deliveryId: t.exposeString("deliveryId"),
+    startHeight: t.exposeInt("startHeight"),
+    endHeight: t.exposeInt("endHeight"),
+    attempt: t.exposeInt("attempt"),
+    statusCode: t.exposeInt("statusCode", { nullable: true }),
+    latencyMs: t.exposeInt("latencyMs"),
+    error: t.exposeString("error", { nullable: true }),
+    responseBody: t.exposeString("responseBody", { nullable: true }),
+  }),
+})
+
 export const gqlPaginationFlags = builder.objectRef<{
   hasNext: boolean
   hasPrev: boolean
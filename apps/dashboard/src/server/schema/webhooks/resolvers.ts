@@ -1,6 +1,7 @@
 import { gqlCursorPaginationInput } from "../../graphql/inputs"
 import { gqlCount, gqlUUID } from "../../graphql/models"
-import { gqlWebhook, gqlWebhooks } from "./models"
+import { gqlWebhook, gqlWebhooks, gqlWebhookDeliveryAttempt } from "./models"
+import * as findDeliveryAttempts from "./handlers/find-delivery-attempts"
 import * as findMany from "./handlers/find-many"
 import { builder } from "../../graphql/builder"
 import * as activate from "./handlers/activate"
@@ -63,6 +64,29 @@ builder.queryField("webhooks", (t) =>
   }),
 )
 
+builder.queryField("webhookDeliveryAttempts", (t) =>
+  t.field({
+    type: [gqlWebhookDeliveryAttempt],
+    args: {
+      id: t.arg.string({ required: true }),
+      limit: t.arg.int({ required: true }),
+      before: t.arg.int({ required: false }),
+    },
+    validate: {
+      schema: findDeliveryAttempts.zInput,
+    },
+    resolve: async (_, args, ctx) => {
+      await ctx.middlewares.requireStripeSubscription({
+        cache: ctx.caches.stripeCheckoutSess,
+        stripe: ctx.providers.stripe,
+        db: ctx.providers.mysql,
+        user: ctx.clerk.user,
+      })
+      return await findDeliveryAttempts.handler(args, ctx)
+    },
+  }),
+)
+
 builder.mutationField("webhookCreate", (t) =>
   t.field({
     type: gqlUUID,
@@ -25,6 +25,9 @@ export const constants = {
         MIN: 1,
         MAX: 2048,
       },
+      START_HEIGHT: {
+        MIN: 0,
+      },
     },
   },
   pagination: {
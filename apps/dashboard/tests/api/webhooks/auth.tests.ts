@@ -4,7 +4,7 @@ import { mysql } from "@block-feed/node-providers-mysql"
 import { clerk } from "@block-feed/node-providers-clerk"
 import { after, before, describe, it } from "node:test"
 import * as testutils from "@block-feed/node-testutils"
-import { randomInt, randomUUID } from "node:crypto"
+import { randomBytes, randomInt, randomUUID } from "node:crypto"
 import * as schema from "@block-feed/node-db"
 import assert from "node:assert"
 import z from "zod"
@@ -195,6 +195,7 @@ describe("Auth Tests", () => {
             redisStoreUrl: "not used by the API",
             pgStoreUrl: "not used by the API",
             url: "not used by the API",
+            webhookApiUrl: "not used by the API",
           })
         })
       })
@@ -249,6 +250,12 @@ describe("Auth Tests", () => {
         },
         env: {
           stripe: fakeStripeEnv,
+          webhookAuth: {
+            WEBHOOK_AUTH_KEY: randomBytes(32).toString("base64"),
+          },
+          webhookApi: {
+            WEBHOOK_API_TOKEN: "not used by the API",
+          },
         },
       }
 
@@ -5,7 +5,10 @@ import { clerk } from "@block-feed/node-providers-clerk"
 import { after, before, describe, it } from "node:test"
 import * as testutils from "@block-feed/node-testutils"
 import * as schema from "@block-feed/node-db"
-import { randomUUID } from "node:crypto"
+import { randomBytes, randomUUID } from "node:crypto"
+import { AddressInfo } from "node:net"
+import { eq } from "drizzle-orm"
+import http from "node:http"
 import assert from "node:assert"
 import z from "zod"
 import {
@@ -30,6 +33,7 @@ describe("CRUD Tests", () => {
   const shardCount = 4
   const cacheExpMs = 30000
   const fakeStripeApiKey = "fake api key"
+  const fakeWebhookApiToken = "fake api token"
   const fakeStripeEnv: z.infer<typeof zStripeEnv> = {
     STRIPE_WEBHOOK_SECRET: "dummy-webhook-secret",
     STRIPE_PRICE_ID: "dummy-price-id",
@@ -78,6 +82,59 @@ describe("CRUD Tests", () => {
       const apiDbUrl = testutils.containers.db.getApiUserUrl(databaseC)
       const redisUrl = testutils.containers.redis.getRedisUrl(redisC)
 
+      // Creates a fake webhook API which applies lifecycle operations to MySQL like the Go backend does
+      const webhookApiServer = http.createServer((req, res) => {
+        const match = /^\/webhooks\/([^/]+)(\/activate)?$/.exec(req.url ?? "")
+        if (req.headers.authorization !== `Bearer ${fakeWebhookApiToken}`) {
+          res.writeHead(401).end()
+          return
+        }
+        if (match == null) {
+          res.writeHead(404).end()
+          return
+        }
+
+        const [, id, activate] = match
+        testutils
+          .withMySqlDatabaseConn(adminDbUrl, async ({ conn }) => {
+            if (req.method === "POST" && activate != null) {
+              return await conn
+                .update(schema.webhook)
+                .set({ isActive: 1 })
+                .where(eq(schema.webhook.id, id))
+            }
+            if (req.method === "DELETE" && activate == null) {
+              return await conn
+                .delete(schema.webhook)
+                .where(eq(schema.webhook.id, id))
+            }
+            return null
+          })
+          .then((result) => {
+            res.writeHead(result?.[0].affectedRows ? 204 : 404).end()
+          })
+          .catch((err) => {
+            res
+              .writeHead(500, { "Content-Type": "application/json" })
+              .end(JSON.stringify({ error: String(err) }))
+          })
+      })
+      await new Promise<void>((res) => webhookApiServer.listen(0, res))
+      const webhookApiUrl = `http://localhost:${(webhookApiServer.address() as AddressInfo).port}`
+
+      // Schedule the fake webhook API for cleanup
+      testCleaner.add(
+        () =>
+          new Promise((res, rej) => {
+            webhookApiServer.close((err) => {
+              if (err != null) {
+                rej(err)
+              }
+              res(null)
+            })
+          }),
+      )
+
       // Creates a stripe API client
       const stripeProvider = new stripe.Provider({
         STRIPE_API_KEY: fakeStripeApiKey,
@@ -128,6 +185,12 @@ describe("CRUD Tests", () => {
         },
         env: {
           stripe: fakeStripeEnv,
+          webhookAuth: {
+            WEBHOOK_AUTH_KEY: randomBytes(32).toString("base64"),
+          },
+          webhookApi: {
+            WEBHOOK_API_TOKEN: fakeWebhookApiToken,
+          },
         },
       }
 
@@ -161,6 +224,7 @@ describe("CRUD Tests", () => {
             redisStoreUrl: "not used by the API",
             pgStoreUrl: "not used by the API",
             url: "not used by the API",
+            webhookApiUrl,
           })
         })
       })
@@ -246,6 +310,10 @@ describe("CRUD Tests", () => {
           data: {
             ...data,
             maxBlocks: newMaxBlocks,
+            auth: {
+              headers: [{ name: "X-Api-Key", value: "secret" }],
+              basicAuth: { username: "user", password: "pass" },
+            },
           },
         },
         headers,
@@ -57,6 +57,7 @@ module "block_feed_moonbeam_mainnet" {
   shard_count              = 1
   replicas_per_shard       = 1
   workers_per_replica      = 1
+  webhook_api_token        = var.webhook_api_token
 
   depends_on = [module.block_feed_storage]
 }
@@ -79,17 +80,19 @@ module "block_feed_moonbeam_mainnet" {
 #   shard_count              = 1
 #   replicas_per_shard       = 1
 #   workers_per_replica      = 1
+#   webhook_api_token        = var.webhook_api_token
 #
 #   depends_on = [module.block_feed_storage]
 # }
 
 module "block_feed_frontend" {
-  source         = "./modules/frontend"
-  tag            = var.tag
-  dashboard_port = 3001
-  web_port       = 3000
-  mysql_api_url  = module.block_feed_storage.mysql_api_url
-  redis_image    = docker_image.redis.name
-  network_name   = docker_network.block_feed_net.name
+  source            = "./modules/frontend"
+  tag               = var.tag
+  dashboard_port    = 3001
+  web_port          = 3000
+  mysql_api_url     = module.block_feed_storage.mysql_api_url
+  redis_image       = docker_image.redis.name
+  network_name      = docker_network.block_feed_net.name
+  webhook_api_token = var.webhook_api_token
 }
 
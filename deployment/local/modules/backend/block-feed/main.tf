@@ -12,6 +12,7 @@ locals {
   redis_cluster_url = "${docker_container.redis_cluster.name}:${docker_container.redis_cluster.ports[0].internal}"
   redis_stream_url  = "${docker_container.redis_block_stream.name}:${docker_container.redis_block_stream.ports[0].internal}"
   redis_store_url   = "${docker_container.redis_block_store.name}:${docker_container.redis_block_store.ports[0].internal}"
+  webhook_api_url   = "http://${docker_container.webhook_reconciler.name}:8080"
   envvars = [
     "CHAIN_ID=${var.chain_id}",
     "CHAIN_URL=${var.chain_url}",
@@ -30,7 +31,7 @@ resource "null_resource" "insert_chain" {
   }
 
   provisioner "local-exec" {
-    command = "docker exec mysql /bin/bash -c 'bash /db/utils/insert-chain.sh \"${var.chain_id}\" \"${var.shard_count}\" \"${var.chain_url}\" \"${local.timescaledb_url}\" \"${local.redis_store_url}\" \"${local.redis_cluster_url}\" \"${local.redis_stream_url}\"'"
+    command = "docker exec mysql /bin/bash -c 'bash /db/utils/insert-chain.sh \"${var.chain_id}\" \"${var.shard_count}\" \"${var.chain_url}\" \"${local.timescaledb_url}\" \"${local.redis_store_url}\" \"${local.redis_cluster_url}\" \"${local.redis_stream_url}\" \"${local.webhook_api_url}\"'"
   }
 }
 
@@ -219,3 +220,30 @@ resource "docker_container" "webhook_processor" {
   }
 }
 
+
+resource "docker_image" "webhook_reconciler" {
+  name         = "webhook-reconciler:${var.tag}"
+  keep_locally = true
+  build {
+    context    = path.cwd
+    dockerfile = "./go.Dockerfile"
+    build_args = {
+      BUILD_DIR = "apps/block-feed/webhook-reconciler"
+    }
+  }
+}
+
+resource "docker_container" "webhook_reconciler" {
+  name    = "webhook-reconciler-${var.chain_id}"
+  restart = "always"
+  image   = docker_image.webhook_reconciler.name
+  env = concat(local.envvars, [
+    "WEBHOOK_RECONCILER_MYSQL_URL=${var.mysql_workers_url}",
+    "WEBHOOK_RECONCILER_MYSQL_CONN_POOL_SIZE=2",
+    "WEBHOOK_RECONCILER_API_ADDR=:8080",
+    "WEBHOOK_RECONCILER_API_TOKEN=${var.webhook_api_token}"
+  ])
+  networks_advanced {
+    name = var.network_name
+  }
+}
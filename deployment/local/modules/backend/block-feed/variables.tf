@@ -62,3 +62,7 @@ variable "workers_per_replica" {
   type = number
 }
 
+variable "webhook_api_token" {
+  type      = string
+  sensitive = true
+}
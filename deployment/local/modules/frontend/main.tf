@@ -91,6 +91,7 @@ resource "docker_container" "dashboard" {
     "REDIS_STREAM_URL=${local.redis_stripe_url}",
     "REDIS_CACHE_URL=${local.redis_api_cache_url}",
     "DB_URL=${var.mysql_api_url}",
+    "WEBHOOK_API_TOKEN=${var.webhook_api_token}",
   ]
   networks_advanced {
     name = var.network_name
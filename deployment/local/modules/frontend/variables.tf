@@ -22,6 +22,11 @@ variable "mysql_api_url" {
   type = string
 }
 
+variable "webhook_api_token" {
+  type      = string
+  sensitive = true
+}
+
 variable "stripe_webhook_event_consumer_replicas" {
   type    = number
   default = 1
@@ -2,6 +2,12 @@ variable "tag" {
   type = string
 }
 
+# Shared by the webhook reconcilers and the dashboard, which calls their API
+variable "webhook_api_token" {
+  type      = string
+  sensitive = true
+}
+
 variable "timescaledb_version" {
   type    = string
   default = "latest-pg16"
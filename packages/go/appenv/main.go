@@ -3,6 +3,7 @@ package appenv
 import (
 	"fmt"
 
+	"github.com/chris-de-leon/block-feed-prototype/streams"
 	"github.com/chris-de-leon/block-feed-prototype/validation"
 
 	"github.com/caarlos0/env/v11"
@@ -17,9 +18,39 @@ type (
 		RedisClusterUrl string `validate:"required,gt=0" env:"CHAIN_REDIS_CLUSTER_URL,required"`
 		RedisStreamUrl  string `validate:"required,gt=0" env:"CHAIN_REDIS_STREAM_URL,required"`
 		ShardCount      int32  `validate:"required,gt=0" env:"CHAIN_SHARD_COUNT,required"`
+
+		// The block stream is backed by redis unless kafka is explicitly requested
+		BlockStreamBackend string   `validate:"required,oneof=redis kafka" env:"CHAIN_BLOCK_STREAM_BACKEND" envDefault:"redis"`
+		KafkaBrokers       []string `validate:"required_if=BlockStreamBackend kafka" env:"CHAIN_KAFKA_BROKERS" envSeparator:","`
+
+		// Trimming and backpressure settings for the redis streams
+		BlockStream   RedisStreamEnv `envPrefix:"CHAIN_BLOCK_STREAM_"`
+		WebhookStream RedisStreamEnv `envPrefix:"CHAIN_WEBHOOK_STREAM_"`
+	}
+
+	RedisStreamEnv struct {
+		TrimStrategy          string `validate:"omitempty,oneof=maxlen minid" env:"TRIM_STRATEGY"`
+		TrimMaxLen            int64  `validate:"gte=0" env:"TRIM_MAXLEN"`
+		TrimApprox            bool   `env:"TRIM_APPROX" envDefault:"true"`
+		BackpressureThreshold int64  `validate:"gte=0" env:"BACKPRESSURE_THRESHOLD"`
+		BackpressureMode      string `validate:"omitempty,oneof=pause slow" env:"BACKPRESSURE_MODE"`
+		BackpressurePollMs    int    `validate:"gte=0" env:"BACKPRESSURE_POLL_MS"`
+		Codec                 string `validate:"omitempty,oneof=json msgpack" env:"CODEC"`
 	}
 )
 
+func (redisStreamEnv RedisStreamEnv) Opts() *streams.RedisStreamOpts {
+	return &streams.RedisStreamOpts{
+		TrimStrategy:          redisStreamEnv.TrimStrategy,
+		TrimMaxLen:            redisStreamEnv.TrimMaxLen,
+		TrimApprox:            redisStreamEnv.TrimApprox,
+		BackpressureThreshold: redisStreamEnv.BackpressureThreshold,
+		BackpressureMode:      redisStreamEnv.BackpressureMode,
+		BackpressurePollMs:    redisStreamEnv.BackpressurePollMs,
+		Codec:                 redisStreamEnv.Codec,
+	}
+}
+
 func LoadEnvVars[T any]() (*T, error) {
 	var envvars T
 
@@ -0,0 +1,226 @@
+// Package blockfilter trims the blocks that are sent to a webhook down to the parts that
+// the webhook cares about.
+//
+// Filters are stored as JSON alongside the webhook:
+//
+//	{
+//	  "rules": [
+//	    { "field": "to", "values": ["0xdAC17F958D2ee523a2206206994597C13D831ec7"] },
+//	    { "field": "topics", "values": ["0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"] },
+//	    { "field": "type", "values": ["A.1654653399040a61.FlowToken.TokensDeposited"] }
+//	  ],
+//	  "projection": ".transactions[].hash"
+//	}
+//
+// Rules are applied to every item in the transactions, logs, and events arrays of a block
+// (whichever of these the block has). An item is kept if any rule matches it, and a rule
+// matches if the item's field equals any of the rule's values (or if the field is an array,
+// contains any of the values). Values are compared case-insensitively so that hex encoded
+// addresses match regardless of their checksum casing. Items that do not match are removed
+// from the block, and blocks without any matching items are removed entirely.
+//
+// The projection is a jq-like path that selects part of each filtered block. Paths are made
+// of dot separated field names, and a field name followed by [] iterates over an array:
+//
+//	.hash                  -> the block hash
+//	.transactions[].hash   -> an array of transaction hashes
+//	.logs[]                -> an array of logs
+package blockfilter
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// The arrays in a block that rules are applied to
+var ItemCollections = []string{"transactions", "logs", "events"}
+
+type (
+	Rule struct {
+		Field  string   `json:"field"`
+		Values []string `json:"values"`
+	}
+
+	Filters struct {
+		Rules      []Rule `json:"rules"`
+		Projection string `json:"projection"`
+	}
+)
+
+// Parses the filters of a webhook - nil is returned if the webhook has no filters
+func Parse(raw []byte) (*Filters, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+
+	var filters Filters
+	if err := json.Unmarshal(raw, &filters); err != nil {
+		return nil, fmt.Errorf("invalid filters: %w", err)
+	}
+
+	for _, rule := range filters.Rules {
+		if rule.Field == "" {
+			return nil, fmt.Errorf("invalid filters: rule field cannot be empty")
+		}
+	}
+
+	if _, err := parsePath(filters.Projection); err != nil {
+		return nil, err
+	}
+
+	return &filters, nil
+}
+
+// Applies the filters to a JSON encoded block. The second return value is false if the
+// block should not be sent to the webhook at all.
+func (filters *Filters) Apply(block []byte) ([]byte, bool, error) {
+	// Exits early if there's nothing to do
+	if filters == nil || (len(filters.Rules) == 0 && filters.Projection == "") {
+		return block, true, nil
+	}
+
+	// Decodes the block
+	var decoded map[string]any
+	if err := json.Unmarshal(block, &decoded); err != nil {
+		return nil, false, err
+	}
+
+	// Removes the items that don't match any of the rules
+	if len(filters.Rules) != 0 {
+		matches := 0
+		for _, collection := range ItemCollections {
+			items, ok := decoded[collection].([]any)
+			if !ok {
+				continue
+			}
+
+			kept := make([]any, 0, len(items))
+			for _, item := range items {
+				if filters.matches(item) {
+					kept = append(kept, item)
+				}
+			}
+
+			decoded[collection] = kept
+			matches += len(kept)
+		}
+		if matches == 0 {
+			return nil, false, nil
+		}
+	}
+
+	// Selects part of the block if a projection was provided
+	var result any = decoded
+	if filters.Projection != "" {
+		segments, err := parsePath(filters.Projection)
+		if err != nil {
+			return nil, false, err
+		}
+		result = project(decoded, segments)
+	}
+
+	// Encodes the result
+	data, err := json.Marshal(result)
+	if err != nil {
+		return nil, false, err
+	}
+	return data, true, nil
+}
+
+func (filters *Filters) matches(item any) bool {
+	fields, ok := item.(map[string]any)
+	if !ok {
+		return false
+	}
+
+	for _, rule := range filters.Rules {
+		value, exists := fields[rule.Field]
+		if !exists {
+			continue
+		}
+
+		candidates := []any{value}
+		if values, ok := value.([]any); ok {
+			candidates = values
+		}
+
+		for _, candidate := range candidates {
+			str, ok := candidate.(string)
+			if !ok {
+				str = fmt.Sprint(candidate)
+			}
+			if slices.ContainsFunc(rule.Values, func(v string) bool { return strings.EqualFold(v, str) }) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+type segment struct {
+	field   string
+	iterate bool
+}
+
+func parsePath(path string) ([]segment, error) {
+	if path == "" {
+		return []segment{}, nil
+	}
+	if !strings.HasPrefix(path, ".") {
+		return nil, fmt.Errorf("invalid projection \"%s\": paths must start with \".\"", path)
+	}
+
+	segments := []segment{}
+	for _, part := range strings.Split(path[1:], ".") {
+		field, iterate := strings.CutSuffix(part, "[]")
+		if strings.ContainsAny(field, "[]") || (field == "" && !iterate && len(path) > 1) {
+			return nil, fmt.Errorf("invalid projection \"%s\"", path)
+		}
+		segments = append(segments, segment{field: field, iterate: iterate})
+	}
+	return segments, nil
+}
+
+func project(value any, segments []segment) any {
+	if len(segments) == 0 {
+		return value
+	}
+
+	// Selects the field (an empty field refers to the current value)
+	head, rest := segments[0], segments[1:]
+	if head.field != "" {
+		fields, ok := value.(map[string]any)
+		if !ok {
+			return nil
+		}
+		value = fields[head.field]
+	}
+
+	// Continues down the path
+	if !head.iterate {
+		return project(value, rest)
+	}
+
+	// Applies the rest of the path to every element of the array and flattens the results
+	items, ok := value.([]any)
+	if !ok {
+		return []any{}
+	}
+	results := make([]any, 0, len(items))
+	for _, item := range items {
+		result := project(item, rest)
+		if nested, ok := result.([]any); ok && hasIterator(rest) {
+			results = append(results, nested...)
+		} else {
+			results = append(results, result)
+		}
+	}
+	return results
+}
+
+func hasIterator(segments []segment) bool {
+	return slices.ContainsFunc(segments, func(s segment) bool { return s.iterate })
+}
@@ -0,0 +1,118 @@
+package blockfilter
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+const testBlock = `{
+  "hash": "0xblock",
+  "transactions": [
+    { "hash": "0x1", "to": "0xAAAA", "from": "0xcccc" },
+    { "hash": "0x2", "to": "0xbbbb", "from": "0xdddd" }
+  ],
+  "logs": [
+    { "address": "0xaaaa", "topics": ["0xtransfer", "0xfrom"] },
+    { "address": "0xeeee", "topics": ["0xapproval"] }
+  ]
+}`
+
+func TestFilters(t *testing.T) {
+	testCases := []struct {
+		name     string
+		filters  string
+		expected any
+		send     bool
+	}{
+		{
+			name:     "no filters",
+			filters:  `null`,
+			expected: mustDecode(t, testBlock),
+			send:     true,
+		},
+		{
+			name:    "recipient (case insensitive)",
+			filters: `{"rules": [{"field": "to", "values": ["0xaaaa"]}]}`,
+			expected: map[string]any{
+				"hash":         "0xblock",
+				"transactions": []any{map[string]any{"hash": "0x1", "to": "0xAAAA", "from": "0xcccc"}},
+				"logs":         []any{},
+			},
+			send: true,
+		},
+		{
+			name:    "topic",
+			filters: `{"rules": [{"field": "topics", "values": ["0xtransfer"]}]}`,
+			expected: map[string]any{
+				"hash":         "0xblock",
+				"transactions": []any{},
+				"logs":         []any{map[string]any{"address": "0xaaaa", "topics": []any{"0xtransfer", "0xfrom"}}},
+			},
+			send: true,
+		},
+		{
+			name:     "sender with projection",
+			filters:  `{"rules": [{"field": "from", "values": ["0xdddd"]}], "projection": ".transactions[].hash"}`,
+			expected: []any{"0x2"},
+			send:     true,
+		},
+		{
+			name:     "nested projection",
+			filters:  `{"projection": ".logs[].topics[]"}`,
+			expected: []any{"0xtransfer", "0xfrom", "0xapproval"},
+			send:     true,
+		},
+		{
+			name:    "no matches",
+			filters: `{"rules": [{"field": "type", "values": ["A.1654653399040a61.FlowToken.TokensDeposited"]}]}`,
+			send:    false,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			filters, err := Parse([]byte(testCase.filters))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			data, send, err := filters.Apply([]byte(testBlock))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if send != testCase.send {
+				t.Fatalf("Expected send to be %v but got %v", testCase.send, send)
+			}
+			if !send {
+				return
+			}
+
+			if actual := mustDecode(t, string(data)); !reflect.DeepEqual(actual, testCase.expected) {
+				t.Fatalf("Expected %v but got %v", testCase.expected, actual)
+			}
+		})
+	}
+}
+
+func TestParseInvalidFilters(t *testing.T) {
+	for _, raw := range []string{
+		`{"rules": [{"field": "", "values": ["0x1"]}]}`,
+		`{"projection": "transactions"}`,
+		`{"projection": ".transactions..hash"}`,
+		`{"projection": ".transactions[0]"}`,
+		`not json`,
+	} {
+		if _, err := Parse([]byte(raw)); err == nil {
+			t.Fatalf("Expected filters %s to be invalid", raw)
+		}
+	}
+}
+
+func mustDecode(t *testing.T, data string) any {
+	var decoded any
+	if err := json.Unmarshal([]byte(data), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	return decoded
+}
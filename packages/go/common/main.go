@@ -8,7 +8,9 @@ import (
 	"math"
 	"math/rand"
 	"runtime"
+	"strings"
 	"time"
+	"unicode/utf8"
 )
 
 func ExponentialBackoff[T any](
@@ -78,3 +80,16 @@ func LogError(logger *log.Logger, err error) {
 		logger.Printf(msg, file, line, err)
 	}
 }
+
+// Truncates a string to at most maxLen bytes without splitting a UTF-8 character - invalid
+// UTF-8 (e.g. a binary response body) is replaced so that the string can be stored as text
+func Truncate(s string, maxLen int) string {
+	s = strings.ToValidUTF8(s, "\uFFFD")
+	if len(s) <= maxLen {
+		return s
+	}
+	for maxLen > 0 && !utf8.RuneStart(s[maxLen]) {
+		maxLen--
+	}
+	return s[:maxLen]
+}
@@ -0,0 +1,135 @@
+package amqptarget
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/chris-de-leon/block-feed-prototype/delivery-targets/deliverytarget"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	HeartbeatInterval = 10 * time.Second
+	HandshakeTimeout  = 30 * time.Second
+)
+
+// NOTE: each delivery is published as a single persistent message with the delivery body
+// as the message body and the delivery headers as message headers. Publisher confirms are
+// enabled on the channel, so a delivery only counts as successful once the broker has
+// confirmed that it took responsibility for the message. Messages are published with the
+// mandatory flag, which means that a message that cannot be routed to any queue is
+// returned by the broker and counted as a failure instead of being silently dropped.
+type (
+	AmqpTargetOpts struct {
+		Exchange   string `json:"exchange"`
+		RoutingKey string `json:"routingKey"`
+	}
+
+	AmqpTarget struct {
+		conn    *amqp.Connection
+		channel *amqp.Channel
+		returns chan amqp.Return
+		opts    AmqpTargetOpts
+	}
+)
+
+func NewAmqpTarget(dialer *net.Dialer, url string, opts *AmqpTargetOpts) (*AmqpTarget, error) {
+	// Validates the options
+	if opts == nil || opts.RoutingKey == "" {
+		return nil, errors.New("amqp targets require a routing key")
+	}
+
+	// Connects to the broker
+	conn, err := amqp.DialConfig(url, amqp.Config{
+		Heartbeat: HeartbeatInterval,
+		Locale:    "en_US",
+		Dial: func(network string, addr string) (net.Conn, error) {
+			conn, err := dialer.Dial(network, addr)
+			if err != nil {
+				return nil, err
+			}
+
+			// Bounds the handshake - the deadline is cleared once the connection is open
+			if err := conn.SetDeadline(time.Now().Add(HandshakeTimeout)); err != nil {
+				conn.Close()
+				return nil, err
+			}
+			return conn, nil
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Opens a channel
+	channel, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	// Enables publisher confirms
+	if err := channel.Confirm(false); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	// Returns the target
+	return &AmqpTarget{
+		conn:    conn,
+		channel: channel,
+		returns: channel.NotifyReturn(make(chan amqp.Return, 1)),
+		opts:    *opts,
+	}, nil
+}
+
+func (target *AmqpTarget) Deliver(ctx context.Context, delivery *deliverytarget.Delivery) error {
+	// Converts the headers to an AMQP table
+	headers := amqp.Table{}
+	for k, v := range delivery.Headers {
+		headers[k] = v
+	}
+
+	// Publishes the message
+	confirmation, err := target.channel.PublishWithDeferredConfirmWithContext(
+		ctx,
+		target.opts.Exchange,
+		target.opts.RoutingKey,
+		true,  // mandatory
+		false, // immediate
+		amqp.Publishing{
+			ContentType:  "application/json",
+			DeliveryMode: amqp.Persistent,
+			Headers:      headers,
+			Body:         delivery.Body,
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	// Waits for the broker to confirm the message
+	acked, err := confirmation.WaitContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	// The broker returns unroutable messages before it confirms them
+	select {
+	case ret := <-target.returns:
+		return errors.New("message could not be routed: " + ret.ReplyText)
+	default:
+	}
+
+	if !acked {
+		return errors.New("message was rejected by the broker")
+	}
+	return nil
+}
+
+func (target *AmqpTarget) Close() error {
+	return target.conn.Close()
+}
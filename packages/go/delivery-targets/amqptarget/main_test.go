@@ -0,0 +1,76 @@
+package amqptarget
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/chris-de-leon/block-feed-prototype/delivery-targets/deliverytarget"
+	"github.com/chris-de-leon/block-feed-prototype/testutils/containers"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestAmqpTarget(t *testing.T) {
+	// Defines helper variables
+	const queueName = "deliveries"
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(60)*time.Second)
+	defer cancel()
+
+	// Starts a container
+	container, err := containers.NewRabbitMQContainer(ctx, t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := containers.AmqpUrl(*container.Conn)
+
+	// Creates a queue to deliver to
+	conn, err := amqp.Dial(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	channel, err := conn.Channel()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := channel.QueueDeclare(queueName, true, false, false, false, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("routable", func(t *testing.T) {
+		target, err := NewAmqpTarget(&net.Dialer{}, url, &AmqpTargetOpts{RoutingKey: queueName})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer target.Close()
+
+		if err := target.Deliver(ctx, &deliverytarget.Delivery{
+			Headers: map[string]string{"X-Test": "value"},
+			Body:    []byte(`["block"]`),
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		msg, ok, err := channel.Get(queueName, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok || string(msg.Body) != `["block"]` || msg.Headers["X-Test"] != "value" {
+			t.Fatalf("Unexpected message: %v", msg)
+		}
+	})
+
+	t.Run("unroutable", func(t *testing.T) {
+		target, err := NewAmqpTarget(&net.Dialer{}, url, &AmqpTargetOpts{RoutingKey: "does-not-exist"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer target.Close()
+
+		if err := target.Deliver(ctx, &deliverytarget.Delivery{Body: []byte(`["block"]`)}); err == nil {
+			t.Fatal("Expected the delivery to fail")
+		}
+	})
+}
@@ -0,0 +1,82 @@
+package deliverytarget
+
+import (
+	"context"
+	"encoding/json"
+)
+
+const (
+	TargetTypeHttp      = "http"
+	TargetTypeWebSocket = "websocket"
+	TargetTypeGrpc      = "grpc"
+	TargetTypeAmqp      = "amqp"
+	TargetTypeTcp       = "tcp"
+)
+
+type (
+	// Delivery is a batch of blocks that is sent to a webhook in one go. The body is
+	// the JSON payload that the webhook receives, and the headers carry the metadata
+	// that goes along with it (e.g. the delivery ID and the signature).
+	//
+	// HTTP targets send the headers as HTTP headers and the body as the request body.
+	// Other targets send the headers using whatever mechanism the protocol provides
+	// (e.g. gRPC metadata or AMQP message headers), and protocols that have no such
+	// mechanism wrap both in an Envelope.
+	Delivery struct {
+		Headers map[string]string
+		Body    []byte
+	}
+
+	// Envelope is the JSON representation of a delivery for targets that can only
+	// send raw bytes (e.g. WebSocket and TCP)
+	Envelope struct {
+		Headers map[string]string `json:"headers"`
+		Payload json.RawMessage   `json:"payload"`
+	}
+
+	// Response is the answer a receiver gave to a delivery (for protocols that have one)
+	Response struct {
+		StatusCode int
+		Body       string
+
+		// The delivery ID that the receiver echoed back to confirm the delivery (if any)
+		Confirmation string
+	}
+
+	// IDeliveryTarget defines the operations for sending blocks to a webhook over a
+	// specific protocol. A delivery is only considered successful if Deliver returns
+	// nil, and implementations should wait for the receiver to acknowledge the
+	// delivery (if the protocol allows it) before returning.
+	IDeliveryTarget interface {
+		// Sends the delivery to the target
+		Deliver(ctx context.Context, delivery *Delivery) error
+
+		// Releases any resources held by the target (e.g. open connections)
+		Close() error
+	}
+
+	// IResponseTarget is implemented by targets whose receivers answer each delivery with
+	// a response (e.g. HTTP) so that the response can be shown to the customer
+	IResponseTarget interface {
+		// Gets the response to the last delivery (nil if there was none)
+		Response() *Response
+	}
+
+	// IConfirmingTarget is implemented by targets whose receivers can confirm deliveries.
+	// A confirmed delivery was processed by the receiver exactly once, so the relay only
+	// resends a delivery if the receiver says that it never confirmed it.
+	IConfirmingTarget interface {
+		// Checks if the receiver requires deliveries to be confirmed
+		ConfirmsDeliveries() bool
+
+		// Asks the receiver whether it confirmed a delivery (e.g. after a restart)
+		IsConfirmed(ctx context.Context, deliveryID string) (bool, error)
+	}
+)
+
+func (delivery *Delivery) Envelope() ([]byte, error) {
+	return json.Marshal(Envelope{
+		Headers: delivery.Headers,
+		Payload: delivery.Body,
+	})
+}
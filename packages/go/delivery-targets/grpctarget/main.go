@@ -0,0 +1,165 @@
+package grpctarget
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"io"
+	"net"
+
+	"github.com/chris-de-leon/block-feed-prototype/delivery-targets/deliverytarget"
+	"github.com/chris-de-leon/block-feed-prototype/webhookpayload"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// Receivers implement the following service:
+//
+//	service DeliveryReceiver {
+//	  rpc Deliver(stream google.protobuf.BytesValue) returns (google.protobuf.Empty);
+//	}
+//
+// Each delivery is sent over its own client stream. The delivery headers are sent as
+// request metadata, and each block in the delivery body (see webhookpayload) is sent as
+// its own message. Legacy payloads are JSON arrays, so each of their elements is sent as
+// is. The receiver acknowledges the delivery by returning from Deliver without an error
+// once it has received all the messages.
+//
+// Only well known protobuf types are used so that receivers don't need any generated
+// code from us - RegisterDeliveryReceiverServer can be used to register a Go receiver.
+const (
+	ServiceName   = "blockfeed.delivery.v1.DeliveryReceiver"
+	DeliverMethod = "/" + ServiceName + "/Deliver"
+)
+
+type (
+	DeliveryReceiverServer interface {
+		Deliver(stream DeliveryReceiverDeliverServer) error
+	}
+
+	DeliveryReceiverDeliverServer interface {
+		SendAndClose(*emptypb.Empty) error
+		Recv() (*wrapperspb.BytesValue, error)
+		grpc.ServerStream
+	}
+
+	deliveryReceiverDeliverServer struct {
+		grpc.ServerStream
+	}
+
+	GrpcTargetOpts struct {
+		TLS bool `json:"tls"`
+	}
+
+	GrpcTarget struct {
+		conn *grpc.ClientConn
+	}
+)
+
+var deliverStreamDesc = grpc.StreamDesc{
+	StreamName:    "Deliver",
+	ClientStreams: true,
+	Handler: func(srv any, stream grpc.ServerStream) error {
+		return srv.(DeliveryReceiverServer).Deliver(&deliveryReceiverDeliverServer{stream})
+	},
+}
+
+var ServiceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*DeliveryReceiverServer)(nil),
+	Streams:     []grpc.StreamDesc{deliverStreamDesc},
+}
+
+func RegisterDeliveryReceiverServer(s grpc.ServiceRegistrar, srv DeliveryReceiverServer) {
+	s.RegisterService(&ServiceDesc, srv)
+}
+
+func (x *deliveryReceiverDeliverServer) SendAndClose(m *emptypb.Empty) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *deliveryReceiverDeliverServer) Recv() (*wrapperspb.BytesValue, error) {
+	m := new(wrapperspb.BytesValue)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func NewGrpcTarget(dialer *net.Dialer, addr string, opts *GrpcTargetOpts) (*GrpcTarget, error) {
+	creds := insecure.NewCredentials()
+	if opts != nil && opts.TLS {
+		creds = credentials.NewTLS(&tls.Config{MinVersion: tls.VersionTLS12})
+	}
+
+	// NOTE: gRPC reports dial errors as Unavailable errors without wrapping them
+	conn, err := grpc.NewClient(addr,
+		grpc.WithTransportCredentials(creds),
+		grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "tcp", addr)
+		}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &GrpcTarget{conn: conn}, nil
+}
+
+func (target *GrpcTarget) Deliver(ctx context.Context, delivery *deliverytarget.Delivery) error {
+	// Splits the body into its elements
+	elems, err := splitBody(delivery.Body)
+	if err != nil {
+		return err
+	}
+
+	// Opens a stream with the headers attached as metadata
+	ctx = metadata.NewOutgoingContext(ctx, metadata.New(delivery.Headers))
+	stream, err := target.conn.NewStream(ctx, &deliverStreamDesc, DeliverMethod)
+	if err != nil {
+		return err
+	}
+
+	// Sends each element as its own message
+	for _, elem := range elems {
+		if err := stream.SendMsg(wrapperspb.Bytes(elem)); err != nil {
+			if err == io.EOF {
+				break // the real error is returned by RecvMsg
+			}
+			return err
+		}
+	}
+
+	// Waits for the receiver to acknowledge the delivery
+	if err := stream.CloseSend(); err != nil {
+		return err
+	}
+	return stream.RecvMsg(new(emptypb.Empty))
+}
+
+func (target *GrpcTarget) Close() error {
+	return target.conn.Close()
+}
+
+// Splits a legacy payload into its elements and an envelope into its blocks
+func splitBody(body []byte) ([]json.RawMessage, error) {
+	if trimmed := bytes.TrimSpace(body); len(trimmed) != 0 && trimmed[0] == '[' {
+		var elems []json.RawMessage
+		if err := json.Unmarshal(trimmed, &elems); err != nil {
+			return nil, err
+		}
+		return elems, nil
+	}
+
+	var payload webhookpayload.Payload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, err
+	}
+	return payload.Blocks, nil
+}
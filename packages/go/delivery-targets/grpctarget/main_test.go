@@ -0,0 +1,93 @@
+package grpctarget
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/chris-de-leon/block-feed-prototype/delivery-targets/deliverytarget"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+type testReceiver struct {
+	headers chan metadata.MD
+	elems   chan []string
+}
+
+func (receiver *testReceiver) Deliver(stream DeliveryReceiverDeliverServer) error {
+	md, _ := metadata.FromIncomingContext(stream.Context())
+	elems := []string{}
+	for {
+		msg, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		elems = append(elems, string(msg.GetValue()))
+	}
+	receiver.headers <- md
+	receiver.elems <- elems
+	return stream.SendAndClose(&emptypb.Empty{})
+}
+
+func TestGrpcTarget(t *testing.T) {
+	// Starts a local gRPC receiver
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer()
+	receiver := &testReceiver{headers: make(chan metadata.MD, 1), elems: make(chan []string, 1)}
+	RegisterDeliveryReceiverServer(server, receiver)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	// Creates the target
+	target, err := NewGrpcTarget(&net.Dialer{}, listener.Addr().String(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { target.Close() })
+
+	// Sends a delivery
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(5)*time.Second)
+	defer cancel()
+	if err := target.Deliver(ctx, &deliverytarget.Delivery{
+		Headers: map[string]string{"X-Test": "value"},
+		Body:    []byte(`["a", {"b": 1}]`),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Checks that the receiver got every element and the headers
+	elems := <-receiver.elems
+	if len(elems) != 2 || elems[0] != `"a"` || elems[1] != `{"b": 1}` {
+		t.Fatalf("Unexpected elements: %v", elems)
+	}
+	if md := <-receiver.headers; len(md.Get("x-test")) != 1 || md.Get("x-test")[0] != "value" {
+		t.Fatalf("Expected headers to be sent as metadata but got %v", md)
+	}
+
+	// Sends an envelope
+	if err := target.Deliver(ctx, &deliverytarget.Delivery{
+		Headers: map[string]string{"X-Test": "value"},
+		Body:    []byte(`{"version":1,"blocks":[{"height":1},{"height":2}]}`),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Checks that the receiver got every block
+	<-receiver.headers
+	elems = <-receiver.elems
+	if len(elems) != 2 || elems[0] != `{"height":1}` || elems[1] != `{"height":2}` {
+		t.Fatalf("Unexpected blocks: %v", elems)
+	}
+}
@@ -0,0 +1,247 @@
+package httptarget
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chris-de-leon/block-feed-prototype/common"
+	"github.com/chris-de-leon/block-feed-prototype/delivery-targets/deliverytarget"
+	"github.com/chris-de-leon/block-feed-prototype/streams"
+	"github.com/chris-de-leon/block-feed-prototype/webhookauth"
+	"github.com/chris-de-leon/block-feed-prototype/webhookpayload"
+)
+
+const (
+	// Caps how long a receiver can ask us to wait before retrying a request
+	MaxRetryAfter = time.Hour
+
+	// Caps how much of a response body is read (the rest is discarded)
+	MaxResponseBodyBytes = 64 * 1024
+
+	// Caps how much of a response body is included in an error message
+	MaxResponseErrorBytes = 256
+
+	// Receivers confirm a delivery by echoing its delivery ID back in this response header
+	ConfirmationHeader = webhookpayload.DeliveryIDHeader
+
+	// The query parameter that carries the delivery ID when asking a receiver about it
+	AckDeliveryIDParam = "deliveryId"
+)
+
+var ErrDeliveryNotConfirmed = errors.New("receiver did not confirm the delivery")
+
+type (
+	HttpTargetOpts struct {
+		// If true, then a delivery is only successful if the receiver echoes the delivery ID
+		// back in the ConfirmationHeader of its response
+		ConfirmDeliveries bool `json:"confirmDeliveries"`
+
+		// An endpoint that reports whether the receiver confirmed a delivery. It is sent a GET
+		// request with the delivery ID in the AckDeliveryIDParam query parameter and should
+		// respond with a 200 if the delivery was confirmed or a 404 if it wasn't. Without it,
+		// deliveries whose outcome is unknown are always resent.
+		AckUrl string `json:"ackUrl"`
+
+		// Credentials that are sent with every request. These are stored encrypted instead of
+		// in the target config, so they are never read from JSON.
+		Auth *webhookauth.Config `json:"-"`
+	}
+
+	// ResponseError is returned when a webhook responds with a non-2xx status code.
+	// If the webhook responded with a 429 or 503 and included a valid Retry-After
+	// header, then RetryAfter is set to how long we should wait before trying again.
+	ResponseError struct {
+		StatusCode int
+		RetryAfter time.Duration
+		Body       string
+	}
+
+	// HttpTarget POSTs deliveries to a URL
+	HttpTarget struct {
+		client   *http.Client
+		url      string
+		opts     *HttpTargetOpts
+		response *deliverytarget.Response
+	}
+)
+
+// The client is shared between targets so that connections to the same host are reused
+func NewHttpTarget(client *http.Client, url string, opts *HttpTargetOpts) *HttpTarget {
+	return &HttpTarget{
+		client: client,
+		url:    url,
+		opts:   opts,
+	}
+}
+
+func (target *HttpTarget) Deliver(ctx context.Context, delivery *deliverytarget.Delivery) error {
+	// Prepares a context aware POST request with the delivery body as the payload -
+	// this only fails if the URL is malformed which retrying will not fix
+	req, err := http.NewRequestWithContext(ctx, "POST", target.url, bytes.NewBuffer(delivery.Body))
+	if err != nil {
+		return streams.NewPermanentError(err)
+	} else {
+		target.authorize(req)
+		req.Header.Set("Content-Type", "application/json")
+		for k, v := range delivery.Headers {
+			req.Header.Set(k, v)
+		}
+	}
+
+	// Sends the request and keeps the response around so that it can be reported
+	resp, err := sendRequest(target.client, req)
+	target.response = resp
+	if err != nil {
+		return err
+	}
+
+	// A receiver that confirms deliveries must echo the delivery ID back
+	if target.opts.ConfirmDeliveries && resp.Confirmation != delivery.Headers[ConfirmationHeader] {
+		return ErrDeliveryNotConfirmed
+	}
+	return nil
+}
+
+func (target *HttpTarget) ConfirmsDeliveries() bool {
+	return target.opts.ConfirmDeliveries
+}
+
+// Asks the receiver's ack endpoint whether it confirmed a delivery. False is returned if
+// the receiver has no ack endpoint.
+func (target *HttpTarget) IsConfirmed(ctx context.Context, deliveryID string) (bool, error) {
+	if target.opts.AckUrl == "" {
+		return false, nil
+	}
+
+	// Adds the delivery ID to the ack endpoint - this only fails if the URL is malformed
+	// which retrying will not fix
+	ackUrl, err := url.Parse(target.opts.AckUrl)
+	if err != nil {
+		return false, streams.NewPermanentError(err)
+	} else {
+		query := ackUrl.Query()
+		query.Set(AckDeliveryIDParam, deliveryID)
+		ackUrl.RawQuery = query.Encode()
+	}
+
+	// Prepares a context aware GET request
+	req, err := http.NewRequestWithContext(ctx, "GET", ackUrl.String(), nil)
+	if err != nil {
+		return false, streams.NewPermanentError(err)
+	} else {
+		target.authorize(req)
+	}
+
+	// A 404 means that the receiver never confirmed the delivery
+	resp, err := sendRequest(target.client, req)
+	var respErr *ResponseError
+	if errors.As(err, &respErr) && respErr.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return resp.StatusCode == http.StatusOK, nil
+}
+
+// Gets the response to the last delivery (nil if the webhook did not respond)
+func (target *HttpTarget) Response() *deliverytarget.Response {
+	return target.response
+}
+
+// The client is shared, so there's nothing to release
+func (target *HttpTarget) Close() error {
+	return nil
+}
+
+func (err *ResponseError) Error() string {
+	msg := fmt.Sprintf("webhook responded with status code %d", err.StatusCode)
+	if err.RetryAfter > 0 {
+		msg += fmt.Sprintf(" (retry after %s)", err.RetryAfter)
+	}
+	if err.Body != "" {
+		msg += fmt.Sprintf(": %s", err.Body)
+	}
+	return msg
+}
+
+// Adds the webhook's credentials (if any) to a request
+func (target *HttpTarget) authorize(req *http.Request) {
+	if target.opts.Auth != nil {
+		target.opts.Auth.Apply(req)
+	}
+}
+
+// Sends the request and classifies the response - a nil error is only returned if the
+// webhook responded with a 2xx status code. The response body is always drained and
+// closed so that the underlying connection can be reused.
+func sendRequest(httpClient *http.Client, req *http.Request) (*deliverytarget.Response, error) {
+	// Sends the request
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// Reads (part of) the response body so that it can be reported
+	body, err := io.ReadAll(io.LimitReader(resp.Body, MaxResponseBodyBytes))
+	if err != nil {
+		return nil, err
+	}
+
+	// Discards anything that is left over
+	if _, err := io.Copy(io.Discard, resp.Body); err != nil {
+		return nil, err
+	}
+
+	// Any 2xx status code counts as a successful delivery
+	response := &deliverytarget.Response{
+		StatusCode:   resp.StatusCode,
+		Body:         string(body),
+		Confirmation: resp.Header.Get(ConfirmationHeader),
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return response, nil
+	}
+
+	// Everything else is a failure
+	respErr := &ResponseError{
+		StatusCode: resp.StatusCode,
+		Body:       common.Truncate(strings.TrimSpace(string(body)), MaxResponseErrorBytes),
+	}
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+		respErr.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+	}
+	return response, respErr
+}
+
+// Parses a Retry-After header which can either be a number of seconds or an HTTP date.
+// Zero is returned if the header is missing or invalid.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+
+	var delay time.Duration
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		delay = time.Duration(seconds) * time.Second
+	} else if date, err := http.ParseTime(value); err == nil {
+		delay = date.Sub(now)
+	} else {
+		return 0
+	}
+
+	if delay <= 0 {
+		return 0
+	}
+	return min(delay, MaxRetryAfter)
+}
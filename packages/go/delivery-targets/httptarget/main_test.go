@@ -0,0 +1,234 @@
+package httptarget
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chris-de-leon/block-feed-prototype/delivery-targets/deliverytarget"
+	"github.com/chris-de-leon/block-feed-prototype/streams"
+)
+
+func TestSendRequest(t *testing.T) {
+	// Defines helper variables
+	ctx := context.Background()
+	httpClient := &http.Client{Timeout: time.Duration(5) * time.Second}
+
+	// Defines a helper function that creates a server which always responds the same way
+	newServer := func(t *testing.T, statusCode int, headers map[string]string, body string) *httptest.Server {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for k, v := range headers {
+				w.Header().Set(k, v)
+			}
+			w.WriteHeader(statusCode)
+			w.Write([]byte(body))
+		}))
+		t.Cleanup(server.Close)
+		return server
+	}
+
+	// Defines a helper function that creates a POST request
+	newRequest := func(t *testing.T, ctx context.Context, url string) *http.Request {
+		req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBufferString("[]"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return req
+	}
+
+	t.Run("2xx", func(t *testing.T) {
+		for _, statusCode := range []int{http.StatusOK, http.StatusCreated, http.StatusAccepted, http.StatusNoContent} {
+			server := newServer(t, statusCode, nil, "")
+			if _, err := sendRequest(httpClient, newRequest(t, ctx, server.URL)); err != nil {
+				t.Fatalf("Expected status code %d to succeed but got: %v", statusCode, err)
+			}
+		}
+	})
+
+	t.Run("4xx and 5xx", func(t *testing.T) {
+		for _, statusCode := range []int{http.StatusBadRequest, http.StatusNotFound, http.StatusInternalServerError, http.StatusBadGateway} {
+			server := newServer(t, statusCode, map[string]string{"Retry-After": "10"}, "oops")
+			_, err := sendRequest(httpClient, newRequest(t, ctx, server.URL))
+
+			var respErr *ResponseError
+			if !errors.As(err, &respErr) {
+				t.Fatalf("Expected a response error for status code %d but got: %v", statusCode, err)
+			}
+			if respErr.StatusCode != statusCode {
+				t.Fatalf("Expected status code %d but got %d", statusCode, respErr.StatusCode)
+			}
+			if respErr.RetryAfter != 0 {
+				t.Fatalf("Expected Retry-After to be ignored for status code %d but got %s", statusCode, respErr.RetryAfter)
+			}
+			if respErr.Body != "oops" {
+				t.Fatalf("Expected response body to be included in the error but got %q", respErr.Body)
+			}
+		}
+	})
+
+	t.Run("429 and 503 with Retry-After", func(t *testing.T) {
+		for _, statusCode := range []int{http.StatusTooManyRequests, http.StatusServiceUnavailable} {
+			server := newServer(t, statusCode, map[string]string{"Retry-After": "30"}, "")
+			_, err := sendRequest(httpClient, newRequest(t, ctx, server.URL))
+
+			var respErr *ResponseError
+			if !errors.As(err, &respErr) {
+				t.Fatalf("Expected a response error for status code %d but got: %v", statusCode, err)
+			}
+			if respErr.RetryAfter != time.Duration(30)*time.Second {
+				t.Fatalf("Expected Retry-After of 30s for status code %d but got %s", statusCode, respErr.RetryAfter)
+			}
+		}
+	})
+
+	t.Run("429 without Retry-After", func(t *testing.T) {
+		server := newServer(t, http.StatusTooManyRequests, nil, "")
+		_, err := sendRequest(httpClient, newRequest(t, ctx, server.URL))
+
+		var respErr *ResponseError
+		if !errors.As(err, &respErr) {
+			t.Fatalf("Expected a response error but got: %v", err)
+		}
+		if respErr.RetryAfter != 0 {
+			t.Fatalf("Expected no Retry-After but got %s", respErr.RetryAfter)
+		}
+	})
+
+	t.Run("response body is drained", func(t *testing.T) {
+		server := newServer(t, http.StatusInternalServerError, nil, strings.Repeat("x", 2*MaxResponseBodyBytes))
+
+		// If the body is drained and closed, then the second request reuses the connection
+		reused := false
+		for i := range 2 {
+			trace := &httptrace.ClientTrace{GotConn: func(info httptrace.GotConnInfo) { reused = info.Reused }}
+			req := newRequest(t, httptrace.WithClientTrace(ctx, trace), server.URL)
+			if _, err := sendRequest(httpClient, req); err == nil {
+				t.Fatalf("Expected request %d to fail", i)
+			}
+		}
+		if !reused {
+			t.Fatal("Expected the connection to be reused")
+		}
+	})
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	testCases := map[string]time.Duration{
+		"":                              0,
+		"abc":                           0,
+		"-5":                            0,
+		"120":                           time.Duration(120) * time.Second,
+		"999999":                        MaxRetryAfter,
+		"Mon, 01 Jan 2024 00:01:00 GMT": time.Minute,
+		"Sun, 31 Dec 2023 23:59:00 GMT": 0,
+	}
+	for value, expected := range testCases {
+		if actual := parseRetryAfter(value, now); actual != expected {
+			t.Fatalf("Expected Retry-After %q to be parsed as %s but got %s", value, expected, actual)
+		}
+	}
+}
+
+func TestHttpTarget(t *testing.T) {
+	// Starts a server that records the last request it received
+	var lastHeader http.Header
+	var lastBody []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		lastHeader, lastBody = r.Header, body
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("received"))
+	}))
+	t.Cleanup(server.Close)
+
+	// Delivers a payload to the server
+	target := NewHttpTarget(server.Client(), server.URL, &HttpTargetOpts{})
+	if err := target.Deliver(context.Background(), &deliverytarget.Delivery{
+		Headers: map[string]string{"X-Test": "value"},
+		Body:    []byte(`["block"]`),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Checks that the server received the payload and the headers
+	if string(lastBody) != `["block"]` {
+		t.Fatalf("Expected body %q but got %q", `["block"]`, lastBody)
+	}
+	if lastHeader.Get("X-Test") != "value" || lastHeader.Get("Content-Type") != "application/json" {
+		t.Fatalf("Expected headers to be forwarded but got %v", lastHeader)
+	}
+
+	// Checks that the response was recorded
+	if resp := target.Response(); resp == nil || resp.StatusCode != http.StatusOK || resp.Body != "received" {
+		t.Fatalf("Expected the response to be recorded but got %v", resp)
+	}
+
+	// Checks that a malformed URL is a permanent error
+	if err := NewHttpTarget(server.Client(), "://bad", &HttpTargetOpts{}).Deliver(context.Background(), &deliverytarget.Delivery{}); streams.GetErrorKind(err) != streams.ErrorKindPermanent {
+		t.Fatalf("Expected a permanent error but got: %v", err)
+	}
+}
+
+func TestHttpTargetConfirmation(t *testing.T) {
+	// Starts a server that only confirms deliveries with an even ID and reports them on its ack endpoint
+	confirmed := map[string]bool{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			if confirmed[r.URL.Query().Get(AckDeliveryIDParam)] {
+				w.WriteHeader(http.StatusOK)
+			} else {
+				w.WriteHeader(http.StatusNotFound)
+			}
+			return
+		}
+		deliveryID := r.Header.Get(ConfirmationHeader)
+		if deliveryID == "2" {
+			confirmed[deliveryID] = true
+			w.Header().Set(ConfirmationHeader, deliveryID)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+
+	// Defines a helper function that delivers a payload with the given delivery ID
+	target := NewHttpTarget(server.Client(), server.URL, &HttpTargetOpts{ConfirmDeliveries: true, AckUrl: server.URL + "/ack"})
+	deliver := func(deliveryID string) error {
+		return target.Deliver(context.Background(), &deliverytarget.Delivery{
+			Headers: map[string]string{ConfirmationHeader: deliveryID},
+			Body:    []byte(`[]`),
+		})
+	}
+
+	// Checks that a delivery which was not echoed back is not successful
+	if err := deliver("1"); !errors.Is(err, ErrDeliveryNotConfirmed) {
+		t.Fatalf("Expected ErrDeliveryNotConfirmed but got: %v", err)
+	}
+	if isConfirmed, err := target.IsConfirmed(context.Background(), "1"); err != nil || isConfirmed {
+		t.Fatalf("Expected delivery 1 to be unconfirmed but got %v (err: %v)", isConfirmed, err)
+	}
+
+	// Checks that a delivery which was echoed back is successful
+	if err := deliver("2"); err != nil {
+		t.Fatal(err)
+	}
+	if isConfirmed, err := target.IsConfirmed(context.Background(), "2"); err != nil || !isConfirmed {
+		t.Fatalf("Expected delivery 2 to be confirmed but got %v (err: %v)", isConfirmed, err)
+	}
+
+	// Checks that targets without an ack endpoint report deliveries as unconfirmed
+	if isConfirmed, err := NewHttpTarget(server.Client(), server.URL, &HttpTargetOpts{}).IsConfirmed(context.Background(), "2"); err != nil || isConfirmed {
+		t.Fatalf("Expected delivery 2 to be unconfirmed but got %v (err: %v)", isConfirmed, err)
+	}
+}
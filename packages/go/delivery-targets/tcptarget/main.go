@@ -0,0 +1,67 @@
+package tcptarget
+
+import (
+	"context"
+	"net"
+
+	"github.com/chris-de-leon/block-feed-prototype/delivery-targets/deliverytarget"
+)
+
+// NOTE: a new connection is opened for each delivery. Each delivery is written as a
+// single line of newline delimited JSON (a JSON encoded deliverytarget.Envelope followed
+// by "\n"), then the write side of the connection is closed. Plain TCP has no way for the
+// receiver to acknowledge the delivery, so a delivery counts as successful once all of
+// its bytes have been handed off to the receiver.
+type (
+	TcpTarget struct {
+		dialer *net.Dialer
+		addr   string
+	}
+)
+
+func NewTcpTarget(dialer *net.Dialer, addr string) *TcpTarget {
+	return &TcpTarget{
+		dialer: dialer,
+		addr:   addr,
+	}
+}
+
+func (target *TcpTarget) Deliver(ctx context.Context, delivery *deliverytarget.Delivery) error {
+	// Encodes the delivery as a line of JSON
+	data, err := delivery.Envelope()
+	if err != nil {
+		return err
+	} else {
+		data = append(data, '\n')
+	}
+
+	// Opens a connection to the receiver
+	conn, err := target.dialer.DialContext(ctx, "tcp", target.addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// Applies the context deadline (if any) to the write
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetWriteDeadline(deadline); err != nil {
+			return err
+		}
+	}
+
+	// Sends the delivery
+	if _, err := conn.Write(data); err != nil {
+		return err
+	}
+
+	// Signals that nothing else will be written
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		return tcpConn.CloseWrite()
+	}
+	return nil
+}
+
+// Connections only live for the duration of a delivery, so there's nothing to release
+func (target *TcpTarget) Close() error {
+	return nil
+}
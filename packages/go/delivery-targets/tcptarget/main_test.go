@@ -0,0 +1,65 @@
+package tcptarget
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/chris-de-leon/block-feed-prototype/delivery-targets/deliverytarget"
+)
+
+func TestTcpTarget(t *testing.T) {
+	// Starts a TCP server that collects the lines it receives
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	lines := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			scanner := bufio.NewScanner(conn)
+			for scanner.Scan() {
+				lines <- scanner.Text()
+			}
+			conn.Close()
+		}
+	}()
+
+	// Sends a few deliveries
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(5)*time.Second)
+	defer cancel()
+	target := NewTcpTarget(&net.Dialer{}, listener.Addr().String())
+	for _, body := range []string{`["a"]`, `["b"]`} {
+		if err := target.Deliver(ctx, &deliverytarget.Delivery{
+			Headers: map[string]string{"X-Test": "value"},
+			Body:    []byte(body),
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Checks that each delivery arrived as its own line
+	for _, expected := range []string{`["a"]`, `["b"]`} {
+		select {
+		case line := <-lines:
+			var envelope deliverytarget.Envelope
+			if err := json.Unmarshal([]byte(line), &envelope); err != nil {
+				t.Fatal(err)
+			}
+			if string(envelope.Payload) != expected || envelope.Headers["X-Test"] != "value" {
+				t.Fatalf("Unexpected envelope: %s", line)
+			}
+		case <-ctx.Done():
+			t.Fatal(ctx.Err())
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package wstarget
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/chris-de-leon/block-feed-prototype/delivery-targets/deliverytarget"
+
+	"github.com/gorilla/websocket"
+)
+
+// NOTE: a new connection is opened for each delivery. The delivery is sent as a single
+// text message containing a JSON encoded deliverytarget.Envelope, and the receiver must
+// acknowledge it by replying with a JSON encoded Ack before the context deadline. If the
+// receiver replies with ok set to false (or closes the connection without replying),
+// then the delivery is retried.
+type (
+	Ack struct {
+		Ok    bool   `json:"ok"`
+		Error string `json:"error,omitempty"`
+	}
+
+	WebSocketTarget struct {
+		dialer *websocket.Dialer
+		url    string
+	}
+)
+
+// The dialer opens the underlying connection and its timeout also applies to the handshake
+func NewWebSocketTarget(dialer *net.Dialer, url string) *WebSocketTarget {
+	return &WebSocketTarget{
+		dialer: &websocket.Dialer{NetDialContext: dialer.DialContext, HandshakeTimeout: dialer.Timeout},
+		url:    url,
+	}
+}
+
+func (target *WebSocketTarget) Deliver(ctx context.Context, delivery *deliverytarget.Delivery) error {
+	// Encodes the delivery
+	data, err := delivery.Envelope()
+	if err != nil {
+		return err
+	}
+
+	// Opens a connection to the receiver
+	conn, _, err := target.dialer.DialContext(ctx, target.url, nil)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// Applies the context deadline (if any) to the reads and writes
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetWriteDeadline(deadline); err != nil {
+			return err
+		}
+		if err := conn.SetReadDeadline(deadline); err != nil {
+			return err
+		}
+	}
+
+	// Sends the delivery
+	if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
+		return err
+	}
+
+	// Waits for the receiver to acknowledge the delivery
+	var ack Ack
+	if err := conn.ReadJSON(&ack); err != nil {
+		return fmt.Errorf("failed to read acknowledgement: %w", err)
+	}
+	if !ack.Ok {
+		return fmt.Errorf("receiver rejected delivery: %s", ack.Error)
+	}
+
+	// Closes the connection gracefully
+	return conn.WriteControl(
+		websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""),
+		time.Now().Add(time.Second),
+	)
+}
+
+// Connections only live for the duration of a delivery, so there's nothing to release
+func (target *WebSocketTarget) Close() error {
+	return nil
+}
@@ -0,0 +1,73 @@
+package wstarget
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chris-de-leon/block-feed-prototype/delivery-targets/deliverytarget"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestWebSocketTarget(t *testing.T) {
+	// Starts a websocket server that acknowledges deliveries unless they contain "reject"
+	received := make(chan deliverytarget.Envelope, 10)
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		var envelope deliverytarget.Envelope
+		if err := conn.ReadJSON(&envelope); err != nil {
+			return
+		} else {
+			received <- envelope
+		}
+
+		if strings.Contains(string(envelope.Payload), "reject") {
+			conn.WriteJSON(Ack{Ok: false, Error: "rejected"})
+		} else {
+			conn.WriteJSON(Ack{Ok: true})
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	// Creates the target
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(5)*time.Second)
+	defer cancel()
+	target := NewWebSocketTarget(&net.Dialer{Timeout: time.Duration(5) * time.Second}, "ws"+strings.TrimPrefix(server.URL, "http"))
+
+	t.Run("acknowledged", func(t *testing.T) {
+		if err := target.Deliver(ctx, &deliverytarget.Delivery{
+			Headers: map[string]string{"X-Test": "value"},
+			Body:    []byte(`["block"]`),
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		envelope := <-received
+		var payload []string
+		if err := json.Unmarshal(envelope.Payload, &payload); err != nil {
+			t.Fatal(err)
+		}
+		if len(payload) != 1 || payload[0] != "block" || envelope.Headers["X-Test"] != "value" {
+			t.Fatalf("Unexpected envelope: %v", envelope)
+		}
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		if err := target.Deliver(ctx, &deliverytarget.Delivery{Body: []byte(`["reject"]`)}); err == nil {
+			t.Fatal("Expected the delivery to be rejected")
+		}
+		<-received
+	})
+}
@@ -0,0 +1,181 @@
+// Package netguard stops deliveries from reaching hosts that webhooks should never have
+// access to, such as localhost, cloud metadata endpoints (169.254.169.254), and services on
+// the private network that the webhook processors run in.
+//
+// Checking a webhook's URL when it's saved is not enough because its hostname can resolve
+// to a public address when it's checked and to a private one when it's used (also known as
+// DNS rebinding). Guard checks the address that a connection is actually opened to instead,
+// by hooking into net.Dialer.Control which runs after the hostname has been resolved:
+//
+//	guard, err := netguard.NewGuard(&netguard.GuardOpts{HttpsOnly: true})
+//	if err != nil {
+//		...
+//	}
+//	dialer := guard.Dialer(&net.Dialer{Timeout: 5 * time.Second})
+//
+// Addresses in DefaultDenyCIDRs (plus any extra ranges in GuardOpts.DenyCIDRs) are blocked
+// unless they are also in GuardOpts.AllowCIDRs. Blocked connections fail with an error that
+// wraps ErrDestinationBlocked, which retrying will not fix.
+package netguard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"syscall"
+)
+
+var ErrDestinationBlocked = errors.New("netguard: destination is not allowed")
+
+// The ranges that are blocked by default
+var DefaultDenyCIDRs = []string{
+	"0.0.0.0/8",      // "This" network
+	"10.0.0.0/8",     // Private
+	"100.64.0.0/10",  // Carrier-grade NAT
+	"127.0.0.0/8",    // Loopback
+	"169.254.0.0/16", // Link-local (includes cloud metadata endpoints)
+	"172.16.0.0/12",  // Private
+	"192.0.0.0/24",   // IETF protocol assignments
+	"192.168.0.0/16", // Private
+	"198.18.0.0/15",  // Benchmarking
+	"224.0.0.0/4",    // Multicast
+	"240.0.0.0/4",    // Reserved (includes broadcast)
+	"::/128",         // Unspecified
+	"::1/128",        // Loopback
+	"64:ff9b::/96",   // IPv4/IPv6 translation (can point at any of the ranges above)
+	"fc00::/7",       // Unique local
+	"fe80::/10",      // Link-local
+	"ff00::/8",       // Multicast
+}
+
+type (
+	GuardOpts struct {
+		// Ranges that are allowed even if they are denied (e.g. a trusted internal service)
+		AllowCIDRs []string
+
+		// Ranges that are blocked on top of DefaultDenyCIDRs
+		DenyCIDRs []string
+
+		// Blocks URLs that are not encrypted (http:// and ws://)
+		HttpsOnly bool
+	}
+
+	Guard struct {
+		allow     []netip.Prefix
+		deny      []netip.Prefix
+		httpsOnly bool
+	}
+
+	guardedTransport struct {
+		guard *Guard
+		next  http.RoundTripper
+	}
+)
+
+func NewGuard(opts *GuardOpts) (*Guard, error) {
+	allow, err := parsePrefixes(opts.AllowCIDRs)
+	if err != nil {
+		return nil, err
+	}
+
+	deny, err := parsePrefixes(append(append([]string{}, DefaultDenyCIDRs...), opts.DenyCIDRs...))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Guard{
+		allow:     allow,
+		deny:      deny,
+		httpsOnly: opts.HttpsOnly,
+	}, nil
+}
+
+// Checks if connections to an address are allowed
+func (guard *Guard) CheckAddr(addr netip.Addr) error {
+	// IPv4 addresses can be written as IPv6 addresses (e.g. ::ffff:127.0.0.1)
+	addr = addr.Unmap()
+
+	for _, prefix := range guard.allow {
+		if prefix.Contains(addr) {
+			return nil
+		}
+	}
+	for _, prefix := range guard.deny {
+		if prefix.Contains(addr) {
+			return fmt.Errorf("%w: %s is in %s", ErrDestinationBlocked, addr, prefix)
+		}
+	}
+	return nil
+}
+
+// Checks if a URL's scheme is allowed - the host is checked when a connection is opened
+func (guard *Guard) CheckURL(rawUrl string) error {
+	parsedUrl, err := url.Parse(rawUrl)
+	if err != nil {
+		return err
+	}
+	if guard.httpsOnly && (parsedUrl.Scheme == "http" || parsedUrl.Scheme == "ws") {
+		return fmt.Errorf("%w: %s URLs are not allowed", ErrDestinationBlocked, parsedUrl.Scheme)
+	}
+	return nil
+}
+
+// Checks the resolved address of a connection before it's opened (see net.Dialer.Control)
+func (guard *Guard) Control(network string, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrDestinationBlocked, err)
+	}
+	return guard.CheckAddr(addrPort.Addr())
+}
+
+// Wraps an HTTP transport so that requests to URLs that are not allowed are never sent -
+// this includes requests that follow redirects
+func (guard *Guard) Transport(next http.RoundTripper) http.RoundTripper {
+	return &guardedTransport{guard: guard, next: next}
+}
+
+// Returns a copy of a dialer which only opens connections that are allowed
+func (guard *Guard) Dialer(dialer *net.Dialer) *net.Dialer {
+	guarded := *dialer
+	guarded.ControlContext = func(ctx context.Context, network string, address string, conn syscall.RawConn) error {
+		if err := guard.Control(network, address, conn); err != nil {
+			return err
+		}
+		if dialer.ControlContext != nil {
+			return dialer.ControlContext(ctx, network, address, conn)
+		}
+		if dialer.Control != nil {
+			return dialer.Control(network, address, conn)
+		}
+		return nil
+	}
+	return &guarded
+}
+
+func (transport *guardedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := transport.guard.CheckURL(req.URL.String()); err != nil {
+		// A round tripper must always close the request body
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+	return transport.next.RoundTrip(req)
+}
+
+func parsePrefixes(cidrs []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR \"%s\": %w", cidr, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
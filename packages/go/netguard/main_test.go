@@ -0,0 +1,99 @@
+package netguard
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strconv"
+	"testing"
+)
+
+func TestGuard(t *testing.T) {
+	// Defines a helper function that creates a guard
+	newGuard := func(t *testing.T, opts *GuardOpts) *Guard {
+		guard, err := NewGuard(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return guard
+	}
+
+	t.Run("blocks private addresses", func(t *testing.T) {
+		guard := newGuard(t, &GuardOpts{})
+		for _, addr := range []string{
+			"127.0.0.1",
+			"10.1.2.3",
+			"172.16.0.1",
+			"192.168.1.1",
+			"169.254.169.254",
+			"0.0.0.0",
+			"::1",
+			"::ffff:127.0.0.1",
+			"fd00::1",
+			"fe80::1",
+		} {
+			if err := guard.CheckAddr(netip.MustParseAddr(addr)); !errors.Is(err, ErrDestinationBlocked) {
+				t.Fatalf("Expected %s to be blocked but got: %v", addr, err)
+			}
+		}
+	})
+
+	t.Run("allows public addresses", func(t *testing.T) {
+		guard := newGuard(t, &GuardOpts{})
+		for _, addr := range []string{"8.8.8.8", "1.1.1.1", "2606:4700:4700::1111"} {
+			if err := guard.CheckAddr(netip.MustParseAddr(addr)); err != nil {
+				t.Fatalf("Expected %s to be allowed but got: %v", addr, err)
+			}
+		}
+	})
+
+	t.Run("applies the allow and deny lists", func(t *testing.T) {
+		guard := newGuard(t, &GuardOpts{AllowCIDRs: []string{"10.0.0.0/24"}, DenyCIDRs: []string{"8.8.8.0/24"}})
+		if err := guard.CheckAddr(netip.MustParseAddr("10.0.0.5")); err != nil {
+			t.Fatalf("Expected an allowed address to be allowed but got: %v", err)
+		}
+		if err := guard.CheckAddr(netip.MustParseAddr("10.0.1.5")); !errors.Is(err, ErrDestinationBlocked) {
+			t.Fatalf("Expected a private address outside of the allow list to be blocked but got: %v", err)
+		}
+		if err := guard.CheckAddr(netip.MustParseAddr("8.8.8.8")); !errors.Is(err, ErrDestinationBlocked) {
+			t.Fatalf("Expected a denied address to be blocked but got: %v", err)
+		}
+	})
+
+	t.Run("rejects invalid CIDRs", func(t *testing.T) {
+		if _, err := NewGuard(&GuardOpts{DenyCIDRs: []string{"not-a-cidr"}}); err == nil {
+			t.Fatal("Expected an error")
+		}
+	})
+
+	t.Run("checks the resolved address when connecting", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		t.Cleanup(server.Close)
+
+		// Sends a request through a guarded client
+		send := func(guard *Guard, url string) error {
+			client := &http.Client{Transport: guard.Transport(&http.Transport{
+				DialContext: guard.Dialer(&net.Dialer{}).DialContext,
+			})}
+			resp, err := client.Get(url)
+			if err != nil {
+				return err
+			}
+			return resp.Body.Close()
+		}
+
+		// The hostname only resolves to a blocked address when the connection is opened
+		url := "http://localhost:" + strconv.Itoa(server.Listener.Addr().(*net.TCPAddr).Port)
+		if err := send(newGuard(t, &GuardOpts{}), url); !errors.Is(err, ErrDestinationBlocked) {
+			t.Fatalf("Expected ErrDestinationBlocked but got: %v", err)
+		}
+		if err := send(newGuard(t, &GuardOpts{AllowCIDRs: []string{"127.0.0.0/8", "::1/128"}}), url); err != nil {
+			t.Fatalf("Expected the request to succeed but got: %v", err)
+		}
+		if err := send(newGuard(t, &GuardOpts{AllowCIDRs: []string{"127.0.0.0/8", "::1/128"}, HttpsOnly: true}), url); !errors.Is(err, ErrDestinationBlocked) {
+			t.Fatalf("Expected a plain HTTP URL to be blocked but got: %v", err)
+		}
+	})
+}
@@ -5,6 +5,8 @@
 package queries
 
 import (
+	"database/sql"
+	"encoding/json"
 	"time"
 )
 
@@ -17,6 +19,7 @@ type Blockchain struct {
 	RedisStoreUrl   string    `json:"redisStoreUrl"`
 	RedisClusterUrl string    `json:"redisClusterUrl"`
 	RedisStreamUrl  string    `json:"redisStreamUrl"`
+	WebhookApiUrl   string    `json:"webhookApiUrl"`
 }
 
 type CheckoutSession struct {
@@ -34,14 +37,40 @@ type Customer struct {
 }
 
 type Webhook struct {
-	ID           string    `json:"id"`
-	CreatedAt    time.Time `json:"createdAt"`
-	IsActive     bool      `json:"isActive"`
-	Url          string    `json:"url"`
-	MaxBlocks    int32     `json:"maxBlocks"`
-	MaxRetries   int32     `json:"maxRetries"`
-	TimeoutMs    int32     `json:"timeoutMs"`
-	CustomerID   string    `json:"customerId"`
-	BlockchainID string    `json:"blockchainId"`
-	ShardID      int32     `json:"shardId"`
+	ID                             string          `json:"id"`
+	CreatedAt                      time.Time       `json:"createdAt"`
+	IsActive                       bool            `json:"isActive"`
+	Url                            string          `json:"url"`
+	MaxBlocks                      int32           `json:"maxBlocks"`
+	MaxRetries                     int32           `json:"maxRetries"`
+	TimeoutMs                      int32           `json:"timeoutMs"`
+	CustomerID                     string          `json:"customerId"`
+	BlockchainID                   string          `json:"blockchainId"`
+	ShardID                        int32           `json:"shardId"`
+	SigningSecret                  string          `json:"signingSecret"`
+	PreviousSigningSecret          sql.NullString  `json:"previousSigningSecret"`
+	PreviousSigningSecretExpiresAt sql.NullTime    `json:"previousSigningSecretExpiresAt"`
+	Filters                        json.RawMessage `json:"filters"`
+	TargetType                     string          `json:"targetType"`
+	TargetConfig                   json.RawMessage `json:"targetConfig"`
+	MaxPayloadBytes                int32           `json:"maxPayloadBytes"`
+	LingerMs                       int32           `json:"lingerMs"`
+	StartHeight                    sql.NullInt64   `json:"startHeight"`
+	VerifiedUrl                    sql.NullString  `json:"verifiedUrl"`
+	LegacyPayload                  bool            `json:"legacyPayload"`
+	EncryptedAuth                  sql.NullString  `json:"encryptedAuth"`
+}
+
+type WebhookDeliveryAttempt struct {
+	ID           int64          `json:"id"`
+	CreatedAt    time.Time      `json:"createdAt"`
+	WebhookID    string         `json:"webhookId"`
+	DeliveryID   string         `json:"deliveryId"`
+	StartHeight  uint64         `json:"startHeight"`
+	EndHeight    uint64         `json:"endHeight"`
+	Attempt      int32          `json:"attempt"`
+	StatusCode   sql.NullInt32  `json:"statusCode"`
+	LatencyMs    int32          `json:"latencyMs"`
+	Error        sql.NullString `json:"error"`
+	ResponseBody sql.NullString `json:"responseBody"`
 }
@@ -1,3 +1,70 @@
+-- name: DeliveryAttemptsCreate :exec
+INSERT INTO `webhook_delivery_attempt` (
+  `webhook_id`,
+  `delivery_id`,
+  `start_height`,
+  `end_height`,
+  `attempt`,
+  `status_code`,
+  `latency_ms`,
+  `error`,
+  `response_body`
+) VALUES (
+  sqlc.arg('webhook_id'),
+  sqlc.arg('delivery_id'),
+  sqlc.arg('start_height'),
+  sqlc.arg('end_height'),
+  sqlc.arg('attempt'),
+  sqlc.narg('status_code'),
+  sqlc.arg('latency_ms'),
+  sqlc.narg('error'),
+  sqlc.narg('response_body')
+);
+
+
+-- name: DeliveryAttemptsPrune :execrows
+DELETE FROM `webhook_delivery_attempt`
+WHERE `webhook_id` = sqlc.arg('webhook_id') AND `id` <= (
+  SELECT `cutoff`.`id` FROM (
+    SELECT `id` FROM `webhook_delivery_attempt`
+    WHERE `webhook_id` = sqlc.arg('webhook_id')
+    ORDER BY `id` DESC
+    LIMIT 1 OFFSET ?
+  ) AS `cutoff`
+);
+
+
 -- name: WebhooksFindOne :one
 SELECT * FROM `webhook` WHERE `id` = sqlc.arg('id') LIMIT 1;
 
+
+-- name: WebhooksFindManyByShard :many
+SELECT `id`, `is_active` FROM `webhook`
+WHERE `blockchain_id` = sqlc.arg('blockchain_id') AND `shard_id` = sqlc.arg('shard_id') AND `id` > sqlc.arg('cursor')
+ORDER BY `id` ASC
+LIMIT ?;
+
+
+-- name: WebhooksActivate :execrows
+UPDATE `webhook` SET `is_active` = true WHERE `id` = sqlc.arg('id');
+
+
+-- name: WebhooksDeactivate :execrows
+UPDATE `webhook` SET `is_active` = false WHERE `id` = sqlc.arg('id');
+
+
+-- name: WebhooksDelete :execrows
+DELETE FROM `webhook` WHERE `id` = sqlc.arg('id');
+
+
+-- name: WebhooksRotateSigningSecret :execrows
+UPDATE `webhook`
+SET
+  `previous_signing_secret` = `signing_secret`,
+  `previous_signing_secret_expires_at` = sqlc.arg('previous_signing_secret_expires_at'),
+  `signing_secret` = sqlc.arg('signing_secret')
+WHERE `id` = sqlc.arg('id');
+
+
+-- name: WebhooksVerify :execrows
+UPDATE `webhook` SET `verified_url` = sqlc.arg('url') WHERE `id` = sqlc.arg('id') AND `url` = sqlc.arg('url');
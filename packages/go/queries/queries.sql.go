@@ -7,15 +7,224 @@ package queries
 
 import (
 	"context"
+	"database/sql"
 )
 
+const DeliveryAttemptsCreate = `-- name: DeliveryAttemptsCreate :exec
+INSERT INTO ` + "`" + `webhook_delivery_attempt` + "`" + ` (
+  ` + "`" + `webhook_id` + "`" + `,
+  ` + "`" + `delivery_id` + "`" + `,
+  ` + "`" + `start_height` + "`" + `,
+  ` + "`" + `end_height` + "`" + `,
+  ` + "`" + `attempt` + "`" + `,
+  ` + "`" + `status_code` + "`" + `,
+  ` + "`" + `latency_ms` + "`" + `,
+  ` + "`" + `error` + "`" + `,
+  ` + "`" + `response_body` + "`" + `
+) VALUES (
+  ?,
+  ?,
+  ?,
+  ?,
+  ?,
+  ?,
+  ?,
+  ?,
+  ?
+)
+`
+
+type DeliveryAttemptsCreateParams struct {
+	WebhookID    string         `json:"webhookId"`
+	DeliveryID   string         `json:"deliveryId"`
+	StartHeight  uint64         `json:"startHeight"`
+	EndHeight    uint64         `json:"endHeight"`
+	Attempt      int32          `json:"attempt"`
+	StatusCode   sql.NullInt32  `json:"statusCode"`
+	LatencyMs    int32          `json:"latencyMs"`
+	Error        sql.NullString `json:"error"`
+	ResponseBody sql.NullString `json:"responseBody"`
+}
+
+// DeliveryAttemptsCreate
+//
+//	INSERT INTO `webhook_delivery_attempt` (
+//	  `webhook_id`,
+//	  `delivery_id`,
+//	  `start_height`,
+//	  `end_height`,
+//	  `attempt`,
+//	  `status_code`,
+//	  `latency_ms`,
+//	  `error`,
+//	  `response_body`
+//	) VALUES (
+//	  ?,
+//	  ?,
+//	  ?,
+//	  ?,
+//	  ?,
+//	  ?,
+//	  ?,
+//	  ?,
+//	  ?
+//	)
+func (q *Queries) DeliveryAttemptsCreate(ctx context.Context, arg *DeliveryAttemptsCreateParams) error {
+	_, err := q.db.ExecContext(ctx, DeliveryAttemptsCreate,
+		arg.WebhookID,
+		arg.DeliveryID,
+		arg.StartHeight,
+		arg.EndHeight,
+		arg.Attempt,
+		arg.StatusCode,
+		arg.LatencyMs,
+		arg.Error,
+		arg.ResponseBody,
+	)
+	return err
+}
+
+const DeliveryAttemptsPrune = `-- name: DeliveryAttemptsPrune :execrows
+DELETE FROM ` + "`" + `webhook_delivery_attempt` + "`" + `
+WHERE ` + "`" + `webhook_id` + "`" + ` = ? AND ` + "`" + `id` + "`" + ` <= (
+  SELECT ` + "`" + `cutoff` + "`" + `.` + "`" + `id` + "`" + ` FROM (
+    SELECT ` + "`" + `id` + "`" + ` FROM ` + "`" + `webhook_delivery_attempt` + "`" + `
+    WHERE ` + "`" + `webhook_id` + "`" + ` = ?
+    ORDER BY ` + "`" + `id` + "`" + ` DESC
+    LIMIT 1 OFFSET ?
+  ) AS ` + "`" + `cutoff` + "`" + `
+)
+`
+
+type DeliveryAttemptsPruneParams struct {
+	WebhookID string `json:"webhookId"`
+	Offset    int32  `json:"offset"`
+}
+
+// DeliveryAttemptsPrune
+//
+//	DELETE FROM `webhook_delivery_attempt`
+//	WHERE `webhook_id` = ? AND `id` <= (
+//	  SELECT `cutoff`.`id` FROM (
+//	    SELECT `id` FROM `webhook_delivery_attempt`
+//	    WHERE `webhook_id` = ?
+//	    ORDER BY `id` DESC
+//	    LIMIT 1 OFFSET ?
+//	  ) AS `cutoff`
+//	)
+func (q *Queries) DeliveryAttemptsPrune(ctx context.Context, arg *DeliveryAttemptsPruneParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, DeliveryAttemptsPrune, arg.WebhookID, arg.WebhookID, arg.Offset)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const WebhooksActivate = `-- name: WebhooksActivate :execrows
+UPDATE ` + "`" + `webhook` + "`" + ` SET ` + "`" + `is_active` + "`" + ` = true WHERE ` + "`" + `id` + "`" + ` = ?
+`
+
+// WebhooksActivate
+//
+//	UPDATE `webhook` SET `is_active` = true WHERE `id` = ?
+func (q *Queries) WebhooksActivate(ctx context.Context, id string) (int64, error) {
+	result, err := q.db.ExecContext(ctx, WebhooksActivate, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const WebhooksDeactivate = `-- name: WebhooksDeactivate :execrows
+UPDATE ` + "`" + `webhook` + "`" + ` SET ` + "`" + `is_active` + "`" + ` = false WHERE ` + "`" + `id` + "`" + ` = ?
+`
+
+// WebhooksDeactivate
+//
+//	UPDATE `webhook` SET `is_active` = false WHERE `id` = ?
+func (q *Queries) WebhooksDeactivate(ctx context.Context, id string) (int64, error) {
+	result, err := q.db.ExecContext(ctx, WebhooksDeactivate, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const WebhooksDelete = `-- name: WebhooksDelete :execrows
+DELETE FROM ` + "`" + `webhook` + "`" + ` WHERE ` + "`" + `id` + "`" + ` = ?
+`
+
+// WebhooksDelete
+//
+//	DELETE FROM `webhook` WHERE `id` = ?
+func (q *Queries) WebhooksDelete(ctx context.Context, id string) (int64, error) {
+	result, err := q.db.ExecContext(ctx, WebhooksDelete, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const WebhooksFindManyByShard = `-- name: WebhooksFindManyByShard :many
+SELECT ` + "`" + `id` + "`" + `, ` + "`" + `is_active` + "`" + ` FROM ` + "`" + `webhook` + "`" + `
+WHERE ` + "`" + `blockchain_id` + "`" + ` = ? AND ` + "`" + `shard_id` + "`" + ` = ? AND ` + "`" + `id` + "`" + ` > ?
+ORDER BY ` + "`" + `id` + "`" + ` ASC
+LIMIT ?
+`
+
+type WebhooksFindManyByShardParams struct {
+	BlockchainID string `json:"blockchainId"`
+	ShardID      int32  `json:"shardId"`
+	Cursor       string `json:"cursor"`
+	Limit        int32  `json:"limit"`
+}
+
+type WebhooksFindManyByShardRow struct {
+	ID       string `json:"id"`
+	IsActive bool   `json:"isActive"`
+}
+
+// WebhooksFindManyByShard
+//
+//	SELECT `id`, `is_active` FROM `webhook`
+//	WHERE `blockchain_id` = ? AND `shard_id` = ? AND `id` > ?
+//	ORDER BY `id` ASC
+//	LIMIT ?
+func (q *Queries) WebhooksFindManyByShard(ctx context.Context, arg *WebhooksFindManyByShardParams) ([]*WebhooksFindManyByShardRow, error) {
+	rows, err := q.db.QueryContext(ctx, WebhooksFindManyByShard,
+		arg.BlockchainID,
+		arg.ShardID,
+		arg.Cursor,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []*WebhooksFindManyByShardRow{}
+	for rows.Next() {
+		var i WebhooksFindManyByShardRow
+		if err := rows.Scan(&i.ID, &i.IsActive); err != nil {
+			return nil, err
+		}
+		items = append(items, &i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const WebhooksFindOne = `-- name: WebhooksFindOne :one
-SELECT id, created_at, is_active, url, max_blocks, max_retries, timeout_ms, customer_id, blockchain_id, shard_id FROM ` + "`" + `webhook` + "`" + ` WHERE ` + "`" + `id` + "`" + ` = ? LIMIT 1
+SELECT id, created_at, is_active, url, max_blocks, max_retries, timeout_ms, customer_id, blockchain_id, shard_id, signing_secret, previous_signing_secret, previous_signing_secret_expires_at, filters, target_type, target_config, max_payload_bytes, linger_ms, start_height, verified_url, legacy_payload, encrypted_auth FROM ` + "`" + `webhook` + "`" + ` WHERE ` + "`" + `id` + "`" + ` = ? LIMIT 1
 `
 
 // WebhooksFindOne
 //
-//	SELECT id, created_at, is_active, url, max_blocks, max_retries, timeout_ms, customer_id, blockchain_id, shard_id FROM `webhook` WHERE `id` = ? LIMIT 1
+//	SELECT id, created_at, is_active, url, max_blocks, max_retries, timeout_ms, customer_id, blockchain_id, shard_id, signing_secret, previous_signing_secret, previous_signing_secret_expires_at, filters, target_type, target_config, max_payload_bytes, linger_ms, start_height, verified_url, legacy_payload, encrypted_auth FROM `webhook` WHERE `id` = ? LIMIT 1
 func (q *Queries) WebhooksFindOne(ctx context.Context, id string) (*Webhook, error) {
 	row := q.db.QueryRowContext(ctx, WebhooksFindOne, id)
 	var i Webhook
@@ -30,6 +239,69 @@ func (q *Queries) WebhooksFindOne(ctx context.Context, id string) (*Webhook, err
 		&i.CustomerID,
 		&i.BlockchainID,
 		&i.ShardID,
+		&i.SigningSecret,
+		&i.PreviousSigningSecret,
+		&i.PreviousSigningSecretExpiresAt,
+		&i.Filters,
+		&i.TargetType,
+		&i.TargetConfig,
+		&i.MaxPayloadBytes,
+		&i.LingerMs,
+		&i.StartHeight,
+		&i.VerifiedUrl,
+		&i.LegacyPayload,
+		&i.EncryptedAuth,
 	)
 	return &i, err
 }
+
+const WebhooksRotateSigningSecret = `-- name: WebhooksRotateSigningSecret :execrows
+UPDATE ` + "`" + `webhook` + "`" + `
+SET
+  ` + "`" + `previous_signing_secret` + "`" + ` = ` + "`" + `signing_secret` + "`" + `,
+  ` + "`" + `previous_signing_secret_expires_at` + "`" + ` = ?,
+  ` + "`" + `signing_secret` + "`" + ` = ?
+WHERE ` + "`" + `id` + "`" + ` = ?
+`
+
+type WebhooksRotateSigningSecretParams struct {
+	PreviousSigningSecretExpiresAt sql.NullTime `json:"previousSigningSecretExpiresAt"`
+	SigningSecret                  string       `json:"signingSecret"`
+	ID                             string       `json:"id"`
+}
+
+// WebhooksRotateSigningSecret
+//
+//	UPDATE `webhook`
+//	SET
+//	  `previous_signing_secret` = `signing_secret`,
+//	  `previous_signing_secret_expires_at` = ?,
+//	  `signing_secret` = ?
+//	WHERE `id` = ?
+func (q *Queries) WebhooksRotateSigningSecret(ctx context.Context, arg *WebhooksRotateSigningSecretParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, WebhooksRotateSigningSecret, arg.PreviousSigningSecretExpiresAt, arg.SigningSecret, arg.ID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const WebhooksVerify = `-- name: WebhooksVerify :execrows
+UPDATE ` + "`" + `webhook` + "`" + ` SET ` + "`" + `verified_url` + "`" + ` = ? WHERE ` + "`" + `id` + "`" + ` = ? AND ` + "`" + `url` + "`" + ` = ?
+`
+
+type WebhooksVerifyParams struct {
+	Url string `json:"url"`
+	ID  string `json:"id"`
+}
+
+// WebhooksVerify
+//
+//	UPDATE `webhook` SET `verified_url` = ? WHERE `id` = ? AND `url` = ?
+func (q *Queries) WebhooksVerify(ctx context.Context, arg *WebhooksVerifyParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, WebhooksVerify, arg.Url, arg.ID, arg.Url)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
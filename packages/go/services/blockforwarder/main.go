@@ -14,16 +14,16 @@ type (
 
 	BlockForwarder struct {
 		src BlockSource
-		dst *streams.BlockStream
+		dst streams.IBlockStream
 	}
 )
 
-func NewBlockForwarder(src BlockSource, dst *streams.BlockStream) *BlockForwarder {
+func NewBlockForwarder(src BlockSource, dst streams.IBlockStream) *BlockForwarder {
 	return &BlockForwarder{src, dst}
 }
 
 func (blockForwarder *BlockForwarder) Run(ctx context.Context) error {
 	return blockForwarder.src.Subscribe(ctx, func(ctx context.Context, data blockstore.BlockDocument) error {
-		return blockForwarder.dst.XAdd(ctx, streams.NewBlockStreamMsg(data.Height, data.Data))
+		return blockForwarder.dst.Publish(ctx, streams.NewBlockStreamMsg(data.Height, data.Data))
 	})
 }
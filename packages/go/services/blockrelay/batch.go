@@ -0,0 +1,101 @@
+package blockrelay
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/chris-de-leon/block-feed-prototype/webhookpayload"
+)
+
+type (
+	encodedBlock struct {
+		height uint64
+		data   []byte
+	}
+
+	// payloadFrame is everything in a payload except for the blocks, which lets the size of
+	// a payload be worked out without encoding it over and over
+	payloadFrame struct {
+		head      []byte
+		separator []byte
+		tail      []byte
+	}
+)
+
+// The frame of a legacy payload - the output is identical to json.MarshalIndent(blocks, "", " ")
+var legacyFrame = payloadFrame{
+	head:      []byte("[\n "),
+	separator: []byte(",\n "),
+	tail:      []byte("\n]"),
+}
+
+// Creates the frame of an envelope. The blocks are the last field of the envelope, so they
+// are spliced in right before the closing brace.
+func newEnvelopeFrame(payload *webhookpayload.Payload) (payloadFrame, error) {
+	envelope := *payload
+	envelope.Blocks = []json.RawMessage{}
+	encoded, err := json.Marshal(&envelope)
+	if err != nil {
+		return payloadFrame{}, err
+	}
+
+	tail := []byte("]}")
+	return payloadFrame{
+		head:      encoded[:len(encoded)-len(tail)],
+		separator: []byte(","),
+		tail:      tail,
+	}, nil
+}
+
+// Encodes a block for a payload. Legacy payloads hold each block as a JSON string, whereas
+// envelopes embed the block as is (the block must be valid JSON).
+func encodeBlock(height uint64, data []byte, legacy bool) (encodedBlock, error) {
+	if legacy {
+		encoded, err := json.Marshal(string(data))
+		if err != nil {
+			return encodedBlock{}, err
+		}
+		return encodedBlock{height: height, data: encoded}, nil
+	}
+
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, data); err != nil {
+		return encodedBlock{}, err
+	}
+	return encodedBlock{height: height, data: buf.Bytes()}, nil
+}
+
+// Gets the number of blocks (starting from the first one) that fit into a payload of at most
+// maxBytes. The first block is always included even if it is too large on its own, otherwise
+// the webhook would never make progress. A maxBytes value of zero means there is no limit.
+func fitPayload(blocks []encodedBlock, frame payloadFrame, maxBytes int) int {
+	if maxBytes <= 0 {
+		return len(blocks)
+	}
+
+	size := len(frame.head) + len(frame.tail)
+	for i, block := range blocks {
+		size += len(block.data)
+		if i != 0 {
+			size += len(frame.separator)
+		}
+		if i != 0 && size > maxBytes {
+			return i
+		}
+	}
+	return len(blocks)
+}
+
+// Builds the payload for a delivery
+func encodePayload(frame payloadFrame, blocks []encodedBlock) []byte {
+	var buf bytes.Buffer
+	buf.Write(frame.head)
+	for i, block := range blocks {
+		if i != 0 {
+			buf.Write(frame.separator)
+		}
+		buf.Write(block.data)
+	}
+	buf.Write(frame.tail)
+	return buf.Bytes()
+}
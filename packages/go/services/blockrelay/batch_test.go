@@ -0,0 +1,104 @@
+package blockrelay
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/chris-de-leon/block-feed-prototype/webhookpayload"
+)
+
+func TestBatching(t *testing.T) {
+	decoded := make([]string, 5)
+	for i := range decoded {
+		decoded[i] = fmt.Sprintf(`{"height":%d,"hash":"0x%d"}`, i, i)
+	}
+
+	// Defines a helper function that encodes the test blocks
+	encodeBlocks := func(t *testing.T, legacy bool) []encodedBlock {
+		blocks := make([]encodedBlock, len(decoded))
+		for i := range blocks {
+			block, err := encodeBlock(uint64(i), []byte(decoded[i]), legacy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			blocks[i] = block
+		}
+		return blocks
+	}
+
+	// Defines a helper function that checks how many blocks fit into a payload
+	testFit := func(t *testing.T, blocks []encodedBlock, frame payloadFrame, expected []byte) {
+		testCases := []struct {
+			name     string
+			maxBytes int
+			count    int
+		}{
+			{name: "no limit", maxBytes: 0, count: 5},
+			{name: "exact fit", maxBytes: len(expected), count: 5},
+			{name: "one byte short", maxBytes: len(expected) - 1, count: 4},
+			{name: "oversized block", maxBytes: 1, count: 1},
+		}
+
+		for _, testCase := range testCases {
+			t.Run(testCase.name, func(t *testing.T) {
+				count := fitPayload(blocks, frame, testCase.maxBytes)
+				if count != testCase.count {
+					t.Fatalf("Expected %d block(s) but got %d", testCase.count, count)
+				}
+				if testCase.maxBytes > 1 && len(encodePayload(frame, blocks[:count])) > testCase.maxBytes {
+					t.Fatalf("Payload exceeds %d bytes", testCase.maxBytes)
+				}
+			})
+		}
+	}
+
+	t.Run("legacy", func(t *testing.T) {
+		blocks := encodeBlocks(t, true)
+		expected, err := json.MarshalIndent(decoded, "", " ")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actual := encodePayload(legacyFrame, blocks); !bytes.Equal(actual, expected) {
+			t.Fatalf("Expected payload %s but got %s", expected, actual)
+		}
+		testFit(t, blocks, legacyFrame, expected)
+	})
+
+	t.Run("envelope", func(t *testing.T) {
+		payload := webhookpayload.Payload{
+			Version:    webhookpayload.Version,
+			ChainID:    "test-chain",
+			WebhookID:  "test-webhook",
+			DeliveryID: "test-delivery",
+			FromHeight: 0,
+			ToHeight:   4,
+			Timestamp:  time.Unix(1700000000, 0).UTC(),
+		}
+		for _, block := range decoded {
+			payload.Blocks = append(payload.Blocks, json.RawMessage(block))
+		}
+		expected, err := json.Marshal(&payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		blocks := encodeBlocks(t, false)
+		frame, err := newEnvelopeFrame(&payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		actual := encodePayload(frame, blocks)
+		if !bytes.Equal(actual, expected) {
+			t.Fatalf("Expected payload %s but got %s", expected, actual)
+		}
+		if parsed, err := webhookpayload.Parse(actual); err != nil {
+			t.Fatal(err)
+		} else if len(parsed.Blocks) != len(decoded) || parsed.ToHeight != 4 {
+			t.Fatalf("Unexpected payload: %+v", parsed)
+		}
+		testFit(t, blocks, frame, expected)
+	})
+}
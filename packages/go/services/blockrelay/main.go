@@ -1,47 +1,154 @@
 package blockrelay
 
 import (
-	"bytes"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"database/sql"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"log"
+	"net"
 	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/chris-de-leon/block-feed-prototype/block-stores/blockstore"
+	"github.com/chris-de-leon/block-feed-prototype/blockfilter"
+	"github.com/chris-de-leon/block-feed-prototype/common"
+	"github.com/chris-de-leon/block-feed-prototype/delivery-targets/amqptarget"
+	"github.com/chris-de-leon/block-feed-prototype/delivery-targets/deliverytarget"
+	"github.com/chris-de-leon/block-feed-prototype/delivery-targets/grpctarget"
+	"github.com/chris-de-leon/block-feed-prototype/delivery-targets/httptarget"
+	"github.com/chris-de-leon/block-feed-prototype/delivery-targets/tcptarget"
+	"github.com/chris-de-leon/block-feed-prototype/delivery-targets/wstarget"
+	"github.com/chris-de-leon/block-feed-prototype/netguard"
 	"github.com/chris-de-leon/block-feed-prototype/queries"
 	"github.com/chris-de-leon/block-feed-prototype/streams"
+	"github.com/chris-de-leon/block-feed-prototype/webhookauth"
+	"github.com/chris-de-leon/block-feed-prototype/webhookcache"
+	"github.com/chris-de-leon/block-feed-prototype/webhookpayload"
+	"github.com/chris-de-leon/block-feed-prototype/webhooksig"
+	"github.com/chris-de-leon/block-feed-prototype/webhookverify"
+
+	"github.com/google/uuid"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	DeliveryIDHeader = webhookpayload.DeliveryIDHeader
+	AttemptHeader    = "X-Block-Feed-Attempt"
+	BlockRangeHeader = "X-Block-Feed-Block-Range"
+	ReplayIDHeader   = "X-Block-Feed-Replay-ID"
+
+	// Caps how much of an error or a response body is stored in the attempt log
+	MaxAttemptLogBytes = 1024
+
+	// How often a consumer checks if the lease on a webhook has been released
+	LeasePollInterval = 500 * time.Millisecond
+)
+
+var (
+	ErrWebhookNotVerified = errors.New("webhook endpoint is not verified")
+	ErrWebhookJobDropped  = errors.New("webhook job failed with an error that can't be retried")
 )
 
 type (
 	BlockRelayOpts struct {
-		ConsumerName string
-		Concurrency  int
+		ConsumerName  string
+		Concurrency   int
+		DelayedPollMs int
+
+		// The number of delivery attempts that are kept per webhook (0 disables the attempt log)
+		AttemptLogSize int
+
+		// HTTP transport settings (see NewHTTPTransport)
+		MaxIdleConns          int
+		MaxIdleConnsPerHost   int
+		MaxConnsPerHost       int
+		IdleConnTimeoutMs     int
+		DialTimeoutMs         int
+		TLSHandshakeTimeoutMs int
+		KeepAliveMs           int
+		DisableHTTP2          bool
+
+		// The CAs that webhook servers are checked against (nil uses the system's CAs)
+		RootCAs *x509.CertPool
+
+		// Blocks connections to addresses that webhooks should not reach (nil allows all of them)
+		Guard *netguard.Guard
+
+		// Deactivates HTTP webhooks whose current URL was not verified (see webhookverify)
+		RequireVerification bool
 	}
 
 	BlockRelayParams struct {
-		WebhookStream *streams.WebhookStream
-		BlockStore    blockstore.IBlockStore
-		Queries       *queries.Queries
-		Opts          *BlockRelayOpts
+		WebhookStream  *streams.WebhookStream
+		BlockStore     blockstore.IBlockStore
+		ErrorSink      streams.ErrorSink
+		DeliveryLedger *streams.DeliveryLedger
+		DeliveryStates *streams.DeliveryStates
+		CircuitBreaker *streams.CircuitBreaker
+		DeliveryQuotas *streams.DeliveryQuotas
+		Notifier       IWebhookNotifier
+		WebhookCache   *webhookcache.WebhookCache
+		Queries        *queries.Queries
+		Opts           *BlockRelayOpts
+
+		// Decrypts the credentials of webhooks that require authentication (see webhookauth)
+		AuthCipher *webhookauth.Cipher
+		CertStore  *webhookauth.CertStore
 	}
 
 	BlockRelay struct {
-		webhookStream *streams.WebhookStream
-		blockStore    blockstore.IBlockStore
-		Queries       *queries.Queries
-		opts          *BlockRelayOpts
+		webhookStream  *streams.WebhookStream
+		blockStore     blockstore.IBlockStore
+		errorSink      streams.ErrorSink
+		deliveryLedger *streams.DeliveryLedger
+		deliveryStates *streams.DeliveryStates
+		circuitBreaker *streams.CircuitBreaker
+		deliveryQuotas *streams.DeliveryQuotas
+		notifier       IWebhookNotifier
+		webhookCache   *webhookcache.WebhookCache
+		httpClient     *http.Client
+		mtlsClients    sync.Map
+		authCipher     *webhookauth.Cipher
+		certStore      *webhookauth.CertStore
+		dialer         *net.Dialer
+		Queries        *queries.Queries
+		opts           *BlockRelayOpts
 	}
 )
 
 func NewBlockRelay(params BlockRelayParams) *BlockRelay {
-	return &BlockRelay{
-		webhookStream: params.WebhookStream,
-		blockStore:    params.BlockStore,
-		Queries:       params.Queries,
-		opts:          params.Opts,
+	service := &BlockRelay{
+		webhookStream:  params.WebhookStream,
+		blockStore:     params.BlockStore,
+		errorSink:      params.ErrorSink,
+		deliveryLedger: params.DeliveryLedger,
+		deliveryStates: params.DeliveryStates,
+		circuitBreaker: params.CircuitBreaker,
+		deliveryQuotas: params.DeliveryQuotas,
+		notifier:       params.Notifier,
+		webhookCache:   params.WebhookCache,
+		httpClient:     NewHTTPClient(params.Opts),
+		authCipher:     params.AuthCipher,
+		certStore:      params.CertStore,
+		dialer:         NewDialer(params.Opts),
+		Queries:        params.Queries,
+		opts:           params.Opts,
+	}
+
+	// Webhooks whose jobs are dropped are deactivated, otherwise the reconciler would
+	// activate them again and their jobs would fail the same way over and over
+	if params.WebhookStream != nil {
+		params.WebhookStream.OnDrop(service.deactivateDropped)
 	}
+
+	return service
 }
 
 func (service *BlockRelay) Run(ctx context.Context) error {
@@ -54,13 +161,57 @@ func (service *BlockRelay) Run(ctx context.Context) error {
 	// heights for each of these chains will most likely be drastically different, yet
 	// they will still be stored in redis. As a result, block flushing will not work
 	// correctly.
-	return service.webhookStream.Subscribe(
-		ctx,
-		service.opts.ConsumerName,
-		service.opts.Concurrency,
-		1, // each consumer should only process 1 message / webhook at a time
-		service.handleMessages,
-	)
+	eg := new(errgroup.Group)
+
+	// Processes jobs from the webhook stream
+	eg.Go(func() error {
+		return service.webhookStream.Subscribe(
+			ctx,
+			service.opts.ConsumerName,
+			service.opts.Concurrency,
+			1, // each consumer should only process 1 message / webhook at a time
+			service.handleMessages,
+		)
+	})
+
+	// Moves delayed and parked jobs back into the webhook stream once they're due
+	eg.Go(func() error {
+		return service.flushDelayed(ctx)
+	})
+
+	// Drops cached webhooks as soon as they're updated
+	if service.webhookCache != nil {
+		eg.Go(func() error {
+			return service.webhookCache.Subscribe(ctx)
+		})
+	}
+
+	// Waits for everything to come to a complete stop then returns any errors
+	return eg.Wait()
+}
+
+func (service *BlockRelay) flushDelayed(ctx context.Context) error {
+	pollMs := service.opts.DelayedPollMs
+	if pollMs <= 0 {
+		pollMs = 1000
+	}
+
+	ticker := time.NewTicker(time.Duration(pollMs) * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case now := <-ticker.C:
+			if _, err := service.webhookStream.FlushDelayed(ctx, now); err != nil && ctx.Err() == nil {
+				return err
+			}
+			if _, err := service.webhookStream.FlushParked(ctx, now); err != nil && ctx.Err() == nil {
+				return err
+			}
+		}
+	}
 }
 
 func (service *BlockRelay) handleMessages(
@@ -77,42 +228,211 @@ func (service *BlockRelay) handleMessages(
 	// Gets the message (there should only be 1)
 	msg := msgs[0]
 
+	// Processes the message and stores any errors so that the customer can see them
+	if err := service.handleMessage(ctx, msg, isBacklogMsg, metadata); err != nil {
+		service.recordError(ctx, msg, err, metadata)
+		return err
+	}
+
+	// Returns nil if no errors occurred
+	return nil
+}
+
+func (service *BlockRelay) recordError(
+	ctx context.Context,
+	msg streams.ParsedStreamMessage[streams.WebhookStreamMsgData],
+	err error,
+	metadata streams.SubscribeMetadata,
+) {
+	// Exits early if errors should not be stored
+	if service.errorSink == nil {
+		return
+	}
+
+	// Stores the error - failing to do so should not affect the delivery
+	if sinkErr := service.errorSink.Push(ctx, msg.Data.WebhookID, streams.ErrorRecord{
+		Timestamp:   time.Now().UTC(),
+		Kind:        streams.GetErrorKind(err).String(),
+		Error:       err.Error(),
+		MsgID:       msg.ID,
+		BlockHeight: msg.Data.BlockHeight,
+	}); sinkErr != nil {
+		common.LogError(metadata.Logger, sinkErr)
+	}
+}
+
+func (service *BlockRelay) handleMessage(
+	ctx context.Context,
+	msg streams.ParsedStreamMessage[streams.WebhookStreamMsgData],
+	isBacklogMsg bool,
+	metadata streams.SubscribeMetadata,
+) error {
 	// Gets the webhook data - if it no longer exists then this
 	// message will be ACK'd + deleted and we can exit early
-	webhook, err := service.Queries.WebhooksFindOne(ctx, msg.Data.WebhookID)
+	webhook, err := service.findWebhook(ctx, msg.Data.WebhookID)
 	if errors.Is(err, sql.ErrNoRows) {
+		if service.deliveryLedger != nil {
+			if err := service.deliveryLedger.Clear(ctx, msg.Data.WebhookID); err != nil {
+				return err
+			}
+		}
+		if service.deliveryStates != nil {
+			if err := service.deliveryStates.Clear(ctx, msg.Data.WebhookID); err != nil {
+				return err
+			}
+		}
+		if service.circuitBreaker != nil {
+			if err := service.circuitBreaker.Reset(ctx, msg.Data.WebhookID); err != nil {
+				return err
+			}
+		}
 		return service.webhookStream.XAckDel(ctx, msg, nil)
 	}
 	if err != nil {
 		return err
 	}
 
+	// Takes the lease on the webhook so that no other consumer can handle its jobs at the
+	// same time. The job carries the lease's fencing token, so if the lease expires before
+	// the job is acknowledged and another consumer takes over, then this consumer can no
+	// longer acknowledge or reschedule it.
+	lease, err := service.acquireLease(ctx, msg, webhook, metadata)
+	if err != nil {
+		return err
+	}
+	if lease == nil {
+		metadata.Logger.Printf("Job %s of webhook %s was already acknowledged, skipping it", msg.ID, webhook.ID)
+		return nil
+	} else {
+		msg.Data.LeaseToken = lease.Token
+	}
+	defer func() {
+		if err := service.webhookStream.ReleaseLease(ctx, lease); err != nil {
+			common.LogError(metadata.Logger, err)
+		}
+	}()
+
+	// Handles the job under the lease - jobs that can't be retried are dropped before the
+	// lease is released so that they can't be dropped by a consumer that lost the lease
+	if err := service.handleLeasedMessage(ctx, msg, webhook, isBacklogMsg, metadata); err != nil {
+		return service.dropJob(ctx, msg, err, metadata)
+	}
+	return nil
+}
+
+// Drops a job that failed with a permanent or poison error while its lease is still held.
+// The error is stored here since the job no longer goes through the stream's error handling.
+// Retryable errors are returned as is so that the job stays pending.
+func (service *BlockRelay) dropJob(
+	ctx context.Context,
+	msg streams.ParsedStreamMessage[streams.WebhookStreamMsgData],
+	err error,
+	metadata streams.SubscribeMetadata,
+) error {
+	if streams.GetErrorKind(err) == streams.ErrorKindRetryable {
+		return err
+	}
+	common.LogError(metadata.Logger, err)
+	service.recordError(ctx, msg, err, metadata)
+	return service.webhookStream.Drop(ctx, msg, err)
+}
+
+func (service *BlockRelay) handleLeasedMessage(
+	ctx context.Context,
+	msg streams.ParsedStreamMessage[streams.WebhookStreamMsgData],
+	webhook *queries.Webhook,
+	isBacklogMsg bool,
+	metadata streams.SubscribeMetadata,
+) error {
+	// If the webhook's URL was changed to one that hasn't been verified, then it is
+	// deactivated until the customer activates it again
+	if service.opts.RequireVerification {
+		if verified, err := service.isVerified(ctx, webhook); err != nil {
+			return err
+		} else if !verified {
+			metadata.Logger.Printf("Endpoint of webhook %s is not verified, deactivating it", webhook.ID)
+			return service.deactivateWebhook(ctx, msg, webhook, ErrWebhookNotVerified, metadata)
+		}
+	}
+
+	// If the webhook was paused while its job was in the stream or claimed by a consumer,
+	// then the job is set aside until the webhook is resumed
+	if held, err := service.webhookStream.Hold(ctx, msg); err != nil {
+		return err
+	} else if held {
+		metadata.Logger.Printf("Webhook %s is paused, holding its job", webhook.ID)
+		return nil
+	}
+
+	// If the webhook's cursor was moved while its job was in the stream or claimed by a
+	// consumer, then the job is rescheduled from the new height instead of being processed
+	if !msg.Data.IsReplay() {
+		if height, exists, err := service.webhookStream.GetCursorOverride(ctx, webhook.ID); err != nil {
+			return err
+		} else if exists {
+			metadata.Logger.Printf("Cursor of webhook %s was moved to height %d", webhook.ID, height)
+			return service.webhookStream.ApplyCursorOverride(ctx, msg, height)
+		}
+	}
+
 	// If the current message is a backlog message, then we should check
 	// the number of times it has been retried and take action accordingly
+	attempt := int64(1)
 	if isBacklogMsg {
 		// Gets the pending data for this message
 		pendingMsg, err := service.webhookStream.GetPendingMsg(ctx, metadata.ConsumerName, msg.ID)
 		if err != nil {
 			return err
+		} else {
+			attempt = pendingMsg.RetryCount
 		}
 
 		// If the current retry count exceeds the XMaxRetries limit, then move onto a different range of blocks
 		if pendingMsg.RetryCount >= int64(webhook.MaxRetries) {
 			// TODO: is there a better way to handle repeated errors?
-			return service.webhookStream.XAckDel(
+			if msg.Data.IsNew {
+				return service.webhookStream.XAckDel(
+					ctx,
+					msg,
+					streams.NewWebhookStreamMsg(msg.Data.WebhookID, msg.Data.BlockHeight+1, true),
+				)
+			}
+			return service.advance(ctx, msg, msg.Data.BlockHeight+1) // if we could not process [h1, h2], try [h1+1, h2+1]
+		}
+	}
+
+	// Quota leases only count against their quotas if the job ends in a successful delivery
+	delivered := false
+
+	// Backfill jobs read historical blocks from the durable store, which is slower than
+	// serving the tip of the chain. They're throttled per shard so that a webhook which is
+	// catching up can't take up every consumer and hold back the real-time jobs in the
+	// shard. A throttled job is set aside without counting against the retry limit.
+	if msg.Data.Backfill && service.deliveryQuotas != nil {
+		lease, delay, err := service.deliveryQuotas.AcquireBackfill(
+			ctx,
+			service.webhookStream.ShardNum,
+			time.Now(),
+			time.Duration(webhook.TimeoutMs)*time.Millisecond+streams.QuotaLeaseExtension,
+		)
+		if err != nil {
+			return err
+		}
+		if lease == nil {
+			metadata.Logger.Printf("Shard is over its backfill quota, retrying webhook %s in %s", webhook.ID, delay)
+			return service.webhookStream.Delay(
 				ctx,
 				msg,
-				streams.NewWebhookStreamMsg(
-					msg.Data.WebhookID,
-					msg.Data.BlockHeight+1, // if we could not process [h1, h2], try [h1+1, h2+1]
-					msg.Data.IsNew,
-				),
+				&streams.StreamMessage[streams.WebhookStreamMsgData]{Data: msg.Data},
+				time.Now().Add(delay),
 			)
 		}
+		defer service.releaseQuota(ctx, lease, &delivered, metadata)
 	}
 
 	// If we're under the retry limit, then get the relevant blocks from the block store
 	var blocks []blockstore.BlockDocument
+	var err error
 	if msg.Data.IsNew {
 		blocks, err = service.blockStore.GetLatestBlocks(
 			ctx,
@@ -120,11 +440,16 @@ func (service *BlockRelay) handleMessages(
 			int64(webhook.MaxBlocks),
 		)
 	} else {
+		// Replays never go past the end of their range
+		endHeight := msg.Data.BlockHeight + uint64(webhook.MaxBlocks) - 1
+		if msg.Data.IsReplay() && endHeight > msg.Data.ReplayUntil {
+			endHeight = msg.Data.ReplayUntil
+		}
 		blocks, err = service.blockStore.GetBlocks(
 			ctx,
 			webhook.BlockchainID,
 			msg.Data.BlockHeight,
-			msg.Data.BlockHeight+uint64(webhook.MaxBlocks)-1,
+			endHeight,
 		)
 	}
 
@@ -143,68 +468,743 @@ func (service *BlockRelay) handleMessages(
 	// NOTE: if there are no blocks to send, then this means 1 of 2 things:
 	// 1. We're trying to query a range in the future that we haven't stored
 	//    yet (i.e. the block height in the message data is larger than the
-	//    largest block height in the block store). This should never happen,
-	//    and even if it does, the code as it is now will handle it properly.
-	//    In this case, we can add the current message back to the pending set
-	//    where it will remain idle until new blocks arrive for it.
+	//    largest block height in the block store). In this case, we can add
+	//    the current message back to the pending set where it will remain idle
+	//    until new blocks arrive for it.
 	// 2. We're trying to query a range that's too far in the past. In this case,
 	//    the blocks have been evicted from the store (e.g. if using a redis-backed
-	//    block store, then this can happen when we reach memory limits). This
-	//    situation is more difficult to account for and will lead to the same
-	//    job being processed infinitely at the same block height. We need to
-	//    ensure we have a safe way to only evict blocks we know won't be used
-	//    by any message instead of having them be evicted automatically.
+	//    block store, then this can happen when we reach memory limits) or they
+	//    were never stored (e.g. a backfill that starts before the earliest block).
+	//    The missing range is skipped so that the job doesn't get stuck at the same
+	//    block height forever, except for replays which are dropped since they can't
+	//    deliver the range that was asked for.
 	//
-	// TODO: we need protection for case #2 - would it be worth it to check if
-	// a job has a height that is less than the smallest height in the cache and
-	// skip blocks?
+	// TODO: we need a safe way to only evict blocks we know won't be used by any
+	// message instead of having them be evicted automatically.
 	if len(blocks) == 0 {
-		panic("unexpectedly received 0 blocks from block store")
+		return service.handleMissingBlocks(ctx, msg, webhook, metadata)
+	}
+
+	// A backfill job that received less than a full batch has caught up with the chain, so
+	// the jobs that follow it are regular jobs
+	if msg.Data.Backfill && len(blocks) < int(webhook.MaxBlocks) {
+		metadata.Logger.Printf("Webhook %s finished backfilling at height %d", webhook.ID, blocks[len(blocks)-1].Height)
+		msg.Data.Backfill = false
+	}
+
+	// If the webhook would rather wait for a full batch than receive a partial one, then
+	// the job is set aside for the linger period. This only happens once per job - after
+	// the linger period has passed, whatever blocks are available are sent. Replays cover
+	// blocks that already exist, so they never linger.
+	if webhook.LingerMs > 0 && !msg.Data.Lingered && !msg.Data.IsReplay() && len(blocks) < int(webhook.MaxBlocks) {
+		lingeringMsg := streams.NewWebhookStreamMsg(msg.Data.WebhookID, msg.Data.BlockHeight, msg.Data.IsNew)
+		lingeringMsg.Data.Lingered = true
+		metadata.Logger.Printf("Lingering for %dms to accumulate more blocks for webhook %s", webhook.LingerMs, webhook.ID)
+		return service.webhookStream.Delay(
+			ctx,
+			msg,
+			lingeringMsg,
+			time.Now().Add(time.Duration(webhook.LingerMs)*time.Millisecond),
+		)
+	}
+
+	// Parses the webhook's filters - retrying will not fix invalid filters
+	filters, err := blockfilter.Parse(webhook.Filters)
+	if err != nil {
+		return streams.NewPermanentError(err)
+	}
+
+	// Extracts the relevant block data and drops anything the webhook isn't interested in
+	encodedBlocks := make([]encodedBlock, 0, len(blocks))
+	for _, b := range blocks {
+		data, send, err := filters.Apply(b.Data)
+		if err != nil {
+			return streams.NewPermanentError(err)
+		}
+		if !send {
+			continue
+		}
+		if block, err := encodeBlock(b.Height, data, webhook.LegacyPayload); err != nil {
+			return streams.NewPermanentError(err)
+		} else {
+			encodedBlocks = append(encodedBlocks, block)
+		}
+	}
+
+	// If nothing in this range matched the webhook's filters, then we can move onto
+	// the next range without sending a request
+	startHeight, endHeight := blocks[0].Height, blocks[len(blocks)-1].Height
+	if len(encodedBlocks) == 0 {
+		metadata.Logger.Printf("No blocks matched the filters of webhook %s, skipping blocks %d-%d", webhook.ID, startHeight, endHeight)
+		return service.advance(ctx, msg, endHeight+1)
+	}
+
+	// Sizes the payload's frame. The delivery ID and the end height may change once the range
+	// is split, but they can't get any longer, so the payload never ends up larger than this.
+	sentAt := time.Now().UTC().Truncate(time.Second)
+	frame, err := newPayloadFrame(webhook, GetDeliveryID(webhook.ID, startHeight, endHeight), startHeight, endHeight, sentAt)
+	if err != nil {
+		return streams.NewPermanentError(err)
+	}
+
+	// If the blocks don't fit into a single payload, then only the first few are sent and
+	// the rest of the range is picked up by the next job
+	if count := fitPayload(encodedBlocks, frame, int(webhook.MaxPayloadBytes)); count < len(encodedBlocks) {
+		endHeight = encodedBlocks[count].height - 1
+		encodedBlocks = encodedBlocks[:count]
+		metadata.Logger.Printf("Blocks exceed the max payload size of webhook %s, splitting range at height %d", webhook.ID, endHeight+1)
 	}
 
-	// Extracts the relevant block data
-	decodedBlocks := make([]string, len(blocks))
-	for i, b := range blocks {
-		decodedBlocks[i] = string(b.Data)
+	// Identifies this delivery by the webhook and the range of blocks being sent - the
+	// ID stays the same across retries and restarts so that receivers can dedupe it.
+	// Replays are deliberate resends, so they get IDs of their own.
+	deliveryID := GetDeliveryID(webhook.ID, startHeight, endHeight)
+	if msg.Data.IsReplay() {
+		deliveryID = GetDeliveryID(webhook.ID+":"+msg.Data.ReplayID, startHeight, endHeight)
+	}
+
+	// If this range was already delivered (e.g. the program was terminated after the
+	// request was sent but before the message was acknowledged) then we can skip it
+	if service.deliveryLedger != nil {
+		if delivered, err := service.deliveryLedger.Has(ctx, webhook.ID, deliveryID); err != nil {
+			return err
+		} else if delivered {
+			metadata.Logger.Printf("Delivery %s was already completed, skipping blocks %d-%d", deliveryID, startHeight, endHeight)
+			return service.advance(ctx, msg, endHeight+1)
+		}
 	}
 
 	// JSON encodes all the block data
-	body, err := json.MarshalIndent(decodedBlocks, "", " ")
+	frame, err = newPayloadFrame(webhook, deliveryID, startHeight, endHeight, sentAt)
+	if err != nil {
+		return streams.NewPermanentError(err)
+	}
+	body := encodePayload(frame, encodedBlocks)
+
+	// Prepares the delivery with all the blocks included in the payload
+	delivery := &deliverytarget.Delivery{
+		Body: body,
+		Headers: map[string]string{
+			webhooksig.SignatureHeader: webhooksig.Header(time.Now(), body, signingSecrets(webhook)...),
+			DeliveryIDHeader:           deliveryID,
+			AttemptHeader:              strconv.FormatInt(attempt, 10),
+			BlockRangeHeader:           fmt.Sprintf("%d-%d", startHeight, endHeight),
+		},
+	}
+	if msg.Data.IsReplay() {
+		delivery.Headers[ReplayIDHeader] = msg.Data.ReplayID
+	}
+
+	// Makes sure that neither the customer nor the destination host are over their quotas. If
+	// either of them is, then the job is set aside until the quota frees up - this does not
+	// count against the retry limit or the webhook's circuit.
+	if service.deliveryQuotas != nil {
+		lease, delay, err := service.deliveryQuotas.Acquire(
+			ctx,
+			webhook.CustomerID,
+			destinationHost(webhook.Url),
+			time.Now(),
+			time.Duration(webhook.TimeoutMs)*time.Millisecond+streams.QuotaLeaseExtension,
+		)
+		if err != nil {
+			return err
+		}
+		if lease == nil {
+			metadata.Logger.Printf("Webhook %s is over its delivery quota, retrying in %s", webhook.ID, delay)
+			return service.webhookStream.Delay(
+				ctx,
+				msg,
+				&streams.StreamMessage[streams.WebhookStreamMsgData]{Data: msg.Data},
+				time.Now().Add(delay),
+			)
+		}
+		defer service.releaseQuota(ctx, lease, &delivered, metadata)
+	}
+
+	// Applies the webhook's timeout to the delivery (including waiting for an acknowledgement)
+	deliveryCtx, cancel := context.WithTimeout(ctx, time.Duration(webhook.TimeoutMs)*time.Millisecond)
+	defer cancel()
+
+	// If the webhook's circuit is open, then this delivery is a probe
+	hasFailures := false
+	if service.circuitBreaker != nil {
+		if hasFailures, err = service.circuitBreaker.BeginDelivery(ctx, webhook.ID); err != nil {
+			return err
+		}
+	}
+
+	// Connects to the webhook's delivery target
+	target, err := service.newTarget(webhook)
+	if err != nil {
+		return classifyBlocked(err)
+	}
+	defer func() {
+		if err := target.Close(); err != nil {
+			common.LogError(metadata.Logger, err)
+		}
+	}()
+
+	// If the webhook's receiver confirms deliveries, then the delivery is prepared before
+	// it is sent. A delivery that was already prepared (or sent) may have reached the
+	// receiver before the program was terminated, so the receiver is asked about it first
+	// and the delivery is only sent again if the receiver never confirmed it.
+	confirmingTarget := service.confirmingTarget(target)
+	if confirmingTarget != nil {
+		state, err := service.deliveryStates.Get(ctx, webhook.ID, deliveryID)
+		if err != nil {
+			return err
+		}
+		if state == streams.DeliveryPrepared || state == streams.DeliverySent {
+			if confirmed, err := confirmingTarget.IsConfirmed(deliveryCtx, deliveryID); err != nil {
+				return classifyBlocked(err)
+			} else if confirmed {
+				state = streams.DeliveryConfirmed
+			}
+		}
+		if state == streams.DeliveryConfirmed {
+			metadata.Logger.Printf("Delivery %s was already confirmed, skipping blocks %d-%d", deliveryID, startHeight, endHeight)
+			return service.confirmDelivery(ctx, msg, webhook.ID, deliveryID, endHeight)
+		}
+		if err := service.deliveryStates.Set(ctx, webhook.ID, deliveryID, streams.DeliveryPrepared); err != nil {
+			return err
+		}
+	}
+
+	// Sends the delivery to the webhook's target, this is the only
+	// non-idempotent operation in this function
+	startedAt := time.Now()
+	err = classifyBlocked(target.Deliver(deliveryCtx, delivery))
+	delivered = err == nil
+
+	// Remembers that the receiver responded without confirming the delivery
+	if confirmingTarget != nil && errors.Is(err, httptarget.ErrDeliveryNotConfirmed) {
+		if err := service.deliveryStates.Set(ctx, webhook.ID, deliveryID, streams.DeliverySent); err != nil {
+			return err
+		}
+	}
+
+	// Stores the attempt so that the customer can see what was sent and how the webhook responded
+	service.recordAttempt(ctx, &queries.DeliveryAttemptsCreateParams{
+		WebhookID:   webhook.ID,
+		DeliveryID:  deliveryID,
+		StartHeight: startHeight,
+		EndHeight:   endHeight,
+		Attempt:     int32(attempt),
+		LatencyMs:   int32(time.Since(startedAt).Milliseconds()),
+	}, target, err, metadata)
+
+	// Handles any errors from the delivery
 	if err != nil {
+		// If the webhook asked us to back off, then the job is set aside until the
+		// delay has passed - this does not count against the retry limit
+		var respErr *httptarget.ResponseError
+		if errors.As(err, &respErr) && respErr.RetryAfter > 0 {
+			service.recordError(ctx, msg, err, metadata)
+			metadata.Logger.Printf("Webhook %s asked to retry after %s", webhook.ID, respErr.RetryAfter)
+			return service.webhookStream.Delay(
+				ctx,
+				msg,
+				&streams.StreamMessage[streams.WebhookStreamMsgData]{Data: msg.Data},
+				time.Now().Add(respErr.RetryAfter),
+			)
+		}
+
+		// If the webhook is unreachable, then its circuit may need to be opened
+		if service.circuitBreaker != nil && streams.GetErrorKind(err) == streams.ErrorKindRetryable {
+			return service.handleDeliveryFailure(ctx, msg, webhook, err, metadata)
+		}
+
+		// Any other failure leaves the job pending so that it counts against the retry limit
 		return err
 	}
 
-	// Prepares a context aware POST request with all the blocks included in the payload
-	req, err := http.NewRequestWithContext(ctx, "POST", webhook.Url, bytes.NewBuffer(body))
+	// A successful delivery closes the circuit
+	if hasFailures {
+		if err := service.circuitBreaker.Reset(ctx, webhook.ID); err != nil {
+			return err
+		}
+	}
+
+	// A confirmed delivery is recorded before the job is acknowledged
+	if confirmingTarget != nil {
+		return service.confirmDelivery(ctx, msg, webhook.ID, deliveryID, endHeight)
+	}
+
+	// If the program is terminated AFTER the message is processed but
+	// BEFORE the delivery is recorded (i.e. right here in the code), then
+	// the client will receive the same request multiple times. Every copy
+	// carries the same delivery ID so the client can discard duplicates.
+
+	// Records the delivery so that it is not repeated if the program is
+	// terminated before the message is acknowledged
+	if service.deliveryLedger != nil {
+		if err := service.deliveryLedger.Record(ctx, webhook.ID, deliveryID, endHeight); err != nil {
+			return err
+		}
+	}
+
+	// Marks this entry as completed
+	return service.advance(ctx, msg, endHeight+1)
+}
+
+// Handles a job whose blocks are not in the block store (see handleMessage)
+func (service *BlockRelay) handleMissingBlocks(
+	ctx context.Context,
+	msg streams.ParsedStreamMessage[streams.WebhookStreamMsgData],
+	webhook *queries.Webhook,
+	metadata streams.SubscribeMetadata,
+) error {
+	// New jobs get the latest blocks, so the store has no blocks for the chain yet
+	if msg.Data.IsNew {
+		return streams.NewRetryableError(fmt.Errorf("block store has no blocks for chain %s", webhook.BlockchainID))
+	}
+
+	// Replays can only be created for blocks that were stored, so the range was evicted
+	startHeight := msg.Data.BlockHeight
+	endHeight := startHeight + uint64(webhook.MaxBlocks) - 1
+	if msg.Data.IsReplay() {
+		return streams.NewPermanentError(fmt.Errorf("blocks %d-%d of replay %s are not in the block store", startHeight, min(endHeight, msg.Data.ReplayUntil), msg.Data.ReplayID))
+	}
+
+	// Jobs that are ahead of the chain wait in the pending set until new blocks arrive
+	latestHeight, exists, err := service.webhookStream.GetLatestBlockHeight(ctx)
 	if err != nil {
 		return err
+	}
+	if !exists || startHeight >= latestHeight {
+		metadata.Logger.Printf("Blocks %d-%d have not arrived yet, waiting for them for webhook %s", startHeight, endHeight, webhook.ID)
+		return service.webhookStream.XAckDel(ctx, msg, msg.Data.Next(startHeight))
+	}
+
+	// Jobs that are behind the store skip the missing range
+	metadata.Logger.Printf("Blocks %d-%d are not in the block store, skipping them for webhook %s", startHeight, endHeight, webhook.ID)
+	return service.advance(ctx, msg, endHeight+1)
+}
+
+// Releases a quota lease once a job is done. If the job did not end in a successful delivery
+// (e.g. it was set aside or the delivery failed), then the lease is refunded so that it does
+// not count against the quotas.
+func (service *BlockRelay) releaseQuota(
+	ctx context.Context,
+	lease *streams.QuotaLease,
+	delivered *bool,
+	metadata streams.SubscribeMetadata,
+) {
+	release := lease.Refund
+	if *delivered {
+		release = lease.Release
+	}
+	if err := release(ctx); err != nil {
+		common.LogError(metadata.Logger, err)
+	}
+}
+
+// Gets the target as a confirming target if its receiver confirms deliveries (nil otherwise)
+func (service *BlockRelay) confirmingTarget(target deliverytarget.IDeliveryTarget) deliverytarget.IConfirmingTarget {
+	if service.deliveryStates == nil {
+		return nil
+	}
+	if confirmingTarget, ok := target.(deliverytarget.IConfirmingTarget); ok && confirmingTarget.ConfirmsDeliveries() {
+		return confirmingTarget
+	}
+	return nil
+}
+
+// Marks a delivery as confirmed, records it in the ledger, and acknowledges its job. If the
+// program is terminated in between, then the next attempt sees the confirmed state (or asks
+// the receiver) instead of sending the delivery again.
+func (service *BlockRelay) confirmDelivery(
+	ctx context.Context,
+	msg streams.ParsedStreamMessage[streams.WebhookStreamMsgData],
+	webhookID string,
+	deliveryID string,
+	endHeight uint64,
+) error {
+	if err := service.deliveryStates.Set(ctx, webhookID, deliveryID, streams.DeliveryConfirmed); err != nil {
+		return err
+	}
+	if service.deliveryLedger != nil {
+		if err := service.deliveryLedger.Record(ctx, webhookID, deliveryID, endHeight); err != nil {
+			return err
+		}
+	}
+	return service.advance(ctx, msg, endHeight+1)
+}
+
+// Acknowledges a job and schedules the next one starting at the given height. Replay jobs
+// are removed instead once they've moved past the end of their range.
+func (service *BlockRelay) advance(
+	ctx context.Context,
+	msg streams.ParsedStreamMessage[streams.WebhookStreamMsgData],
+	height uint64,
+) error {
+	if msg.Data.IsReplay() && height > msg.Data.ReplayUntil {
+		return service.webhookStream.XAckDel(ctx, msg, nil)
+	}
+	return service.webhookStream.XAckDel(ctx, msg, msg.Data.Next(height))
+}
+
+// Waits until the lease on a webhook is free and then acquires it. The lease covers the
+// webhook's timeout plus some slack for reading blocks and acknowledging the job.
+//
+// A job that was reclaimed from a consumer may have been acknowledged by that consumer
+// while this one was waiting for the lease. In that case, the lease is released and a
+// nil lease is returned so that the job is skipped.
+func (service *BlockRelay) acquireLease(
+	ctx context.Context,
+	msg streams.ParsedStreamMessage[streams.WebhookStreamMsgData],
+	webhook *queries.Webhook,
+	metadata streams.SubscribeMetadata,
+) (*streams.WebhookLease, error) {
+	duration := time.Duration(webhook.TimeoutMs)*time.Millisecond + streams.WebhookLeaseExtension
+	for {
+		lease, wait, err := service.webhookStream.AcquireLease(ctx, webhook.ID, duration)
+		if err != nil {
+			return nil, err
+		}
+		if lease != nil {
+			isPending, err := service.webhookStream.IsPending(ctx, msg.ID)
+			if err != nil || !isPending {
+				if err := service.webhookStream.ReleaseLease(ctx, lease); err != nil {
+					common.LogError(metadata.Logger, err)
+				}
+				return nil, err
+			}
+			return lease, nil
+		}
+
+		// Another consumer is handling a job for this webhook - waiting here instead of
+		// returning an error keeps the job from counting against the retry limit
+		metadata.Logger.Printf("Webhook %s is leased by another consumer, waiting up to %s", webhook.ID, wait)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(min(max(wait, time.Millisecond), LeasePollInterval)):
+		}
+	}
+}
+
+// Gets a webhook from the cache if there is one, otherwise from the database
+func (service *BlockRelay) findWebhook(ctx context.Context, webhookID string) (*queries.Webhook, error) {
+	if service.webhookCache != nil {
+		return service.webhookCache.Get(ctx, webhookID)
+	}
+	return service.Queries.WebhooksFindOne(ctx, webhookID)
+}
+
+// Checks if a webhook's endpoint was verified. A cached webhook may predate its
+// verification, so the database has the final say.
+func (service *BlockRelay) isVerified(ctx context.Context, webhook *queries.Webhook) (bool, error) {
+	if webhookverify.IsVerified(webhook) {
+		return true, nil
+	}
+	if service.webhookCache == nil {
+		return false, nil
+	}
+	if current, err := service.Queries.WebhooksFindOne(ctx, webhook.ID); err != nil {
+		return false, err
 	} else {
-		req.Header.Set("Content-Type", "application/json")
+		service.webhookCache.Invalidate(webhook.ID)
+		return webhookverify.IsVerified(current), nil
 	}
+}
 
-	// Sends a synchronous POST request to the webhook URL, this is the
-	// only non-idempotent operation in this function
-	httpClient := http.Client{Timeout: time.Duration(webhook.TimeoutMs) * time.Millisecond}
-	if _, err := httpClient.Do(req); err != nil {
+func (service *BlockRelay) handleDeliveryFailure(
+	ctx context.Context,
+	msg streams.ParsedStreamMessage[streams.WebhookStreamMsgData],
+	webhook *queries.Webhook,
+	deliveryErr error,
+	metadata streams.SubscribeMetadata,
+) error {
+	// Counts the failure against the webhook's circuit
+	status, err := service.circuitBreaker.RecordFailure(ctx, webhook.ID, time.Now())
+	if err != nil {
 		return err
 	}
 
-	// If the program is terminated AFTER the message is processed but
-	// BEFORE the message is fully acknowledged (i.e. right here in the
-	// code), then the client will receive the same request multiple times.
+	// If the circuit is still closed, then the job stays pending and is retried as usual
+	if status.State != streams.CircuitOpen {
+		return deliveryErr
+	}
 
-	// Stores the start height for the new range of blocks we need to send to the
-	// webhook URL the next time this message is re-added to the stream
-	nextBlockHeight := blocks[len(blocks)-1].Height + 1
+	// From here on the job is taken out of the stream, so the error is stored here instead
+	// of being returned
+	service.recordError(ctx, msg, deliveryErr, metadata)
 
-	// Marks this entry as completed
-	return service.webhookStream.XAckDel(
+	// If the webhook has been failing for too long, then it is deactivated
+	if status.Expired {
+		metadata.Logger.Printf("Webhook %s has been failing since %s, deactivating it", webhook.ID, status.FailingSince)
+		return service.deactivateWebhook(ctx, msg, webhook, deliveryErr, metadata)
+	}
+
+	// Otherwise the job is parked until the next probe
+	metadata.Logger.Printf("Circuit of webhook %s is open after %d failure(s), parking it", webhook.ID, status.Failures)
+	return service.webhookStream.Park(
 		ctx,
 		msg,
-		streams.NewWebhookStreamMsg(
-			msg.Data.WebhookID,
-			nextBlockHeight,
-			false,
-		),
+		&streams.StreamMessage[streams.WebhookStreamMsgData]{Data: msg.Data},
+		time.Now().Add(service.circuitBreaker.ProbeInterval()),
 	)
 }
+
+func (service *BlockRelay) deactivateWebhook(
+	ctx context.Context,
+	msg streams.ParsedStreamMessage[streams.WebhookStreamMsgData],
+	webhook *queries.Webhook,
+	reason error,
+	metadata streams.SubscribeMetadata,
+) error {
+	// Marks the webhook as inactive in the database
+	if _, err := service.Queries.WebhooksDeactivate(ctx, webhook.ID); err != nil {
+		return err
+	}
+
+	// Removes the job from the stream and the webhook from the webhook set so that
+	// the customer can activate it again once their endpoint is fixed
+	if err := service.webhookStream.XAckDel(ctx, msg, nil); err != nil {
+		return err
+	}
+
+	// Forgets the webhook's failures so that it starts with a closed circuit if it's activated again
+	if service.circuitBreaker != nil {
+		if err := service.circuitBreaker.Reset(ctx, webhook.ID); err != nil {
+			return err
+		}
+	}
+
+	// Lets the customer know - failing to do so should not undo the deactivation
+	if service.notifier != nil {
+		if err := service.notifier.Notify(ctx, WebhookEvent{
+			Type:       WebhookEventDeactivated,
+			WebhookID:  webhook.ID,
+			CustomerID: webhook.CustomerID,
+			Reason:     reason.Error(),
+			Timestamp:  time.Now().UTC(),
+		}); err != nil {
+			common.LogError(metadata.Logger, err)
+		}
+	}
+
+	return nil
+}
+
+// Deactivates the webhooks whose jobs were dropped from the stream (see WebhookStream.OnDrop)
+func (service *BlockRelay) deactivateDropped(ctx context.Context, webhookIDs []string, logger *log.Logger) error {
+	for _, webhookID := range webhookIDs {
+		webhook, err := service.findWebhook(ctx, webhookID)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		// Marks the webhook as inactive in the database
+		if _, err := service.Queries.WebhooksDeactivate(ctx, webhook.ID); err != nil {
+			return err
+		}
+		if service.webhookCache != nil {
+			service.webhookCache.Invalidate(webhook.ID)
+		}
+
+		// Lets the customer know - failing to do so should not undo the deactivation
+		if service.notifier != nil {
+			if err := service.notifier.Notify(ctx, WebhookEvent{
+				Type:       WebhookEventDeactivated,
+				WebhookID:  webhook.ID,
+				CustomerID: webhook.CustomerID,
+				Reason:     ErrWebhookJobDropped.Error(),
+				Timestamp:  time.Now().UTC(),
+			}); err != nil {
+				common.LogError(logger, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (service *BlockRelay) recordAttempt(
+	ctx context.Context,
+	params *queries.DeliveryAttemptsCreateParams,
+	target deliverytarget.IDeliveryTarget,
+	deliveryErr error,
+	metadata streams.SubscribeMetadata,
+) {
+	// Exits early if attempts should not be stored
+	if service.opts.AttemptLogSize <= 0 {
+		return
+	}
+
+	// Adds the outcome of the attempt
+	if deliveryErr != nil {
+		params.Error = sql.NullString{String: common.Truncate(deliveryErr.Error(), MaxAttemptLogBytes), Valid: true}
+	}
+	if responseTarget, ok := target.(deliverytarget.IResponseTarget); ok {
+		if resp := responseTarget.Response(); resp != nil {
+			params.StatusCode = sql.NullInt32{Int32: int32(resp.StatusCode), Valid: true}
+			params.ResponseBody = sql.NullString{String: common.Truncate(resp.Body, MaxAttemptLogBytes), Valid: true}
+		}
+	}
+
+	// Stores the attempt and removes the oldest ones - failing to do so should not affect the delivery
+	if err := service.Queries.DeliveryAttemptsCreate(ctx, params); err != nil {
+		common.LogError(metadata.Logger, err)
+		return
+	}
+	if _, err := service.Queries.DeliveryAttemptsPrune(ctx, &queries.DeliveryAttemptsPruneParams{
+		WebhookID: params.WebhookID,
+		Offset:    int32(service.opts.AttemptLogSize),
+	}); err != nil {
+		common.LogError(metadata.Logger, err)
+	}
+}
+
+// Derives a delivery ID from the webhook ID and the range of blocks being delivered
+func GetDeliveryID(webhookID string, startHeight uint64, endHeight uint64) string {
+	return uuid.NewSHA1(uuid.NameSpaceURL, []byte(fmt.Sprintf("%s:%d-%d", webhookID, startHeight, endHeight))).String()
+}
+
+// Creates the frame of a webhook's payload - legacy payloads have no metadata
+func newPayloadFrame(webhook *queries.Webhook, deliveryID string, startHeight uint64, endHeight uint64, sentAt time.Time) (payloadFrame, error) {
+	if webhook.LegacyPayload {
+		return legacyFrame, nil
+	}
+	return newEnvelopeFrame(&webhookpayload.Payload{
+		Version:    webhookpayload.Version,
+		ChainID:    webhook.BlockchainID,
+		WebhookID:  webhook.ID,
+		DeliveryID: deliveryID,
+		FromHeight: startHeight,
+		ToHeight:   endHeight,
+		Timestamp:  sentAt,
+	})
+}
+
+// Gets the host that a webhook delivers to - URLs without a scheme (e.g. TCP targets) are
+// treated as a host and port
+func destinationHost(rawUrl string) string {
+	if parsed, err := url.Parse(rawUrl); err == nil && parsed.Host != "" {
+		return parsed.Hostname()
+	}
+	if host, _, err := net.SplitHostPort(rawUrl); err == nil {
+		return host
+	}
+	return rawUrl
+}
+
+// Gets the secrets that a request should be signed with - while a secret is being rotated
+// the request is signed with both the new and the old secret until the old one expires
+func signingSecrets(webhook *queries.Webhook) []string {
+	secrets := []string{webhook.SigningSecret}
+	if webhook.PreviousSigningSecret.Valid && webhook.PreviousSigningSecretExpiresAt.Valid {
+		if time.Now().Before(webhook.PreviousSigningSecretExpiresAt.Time) {
+			secrets = append(secrets, webhook.PreviousSigningSecret.String)
+		}
+	}
+	return secrets
+}
+
+// Creates the delivery target for a webhook - invalid target configs and URLs that the
+// guard does not allow are permanent errors
+func (service *BlockRelay) newTarget(webhook *queries.Webhook) (deliverytarget.IDeliveryTarget, error) {
+	// Only HTTP and WebSocket targets have URLs (the others are plain addresses)
+	isUrl := webhook.TargetType == deliverytarget.TargetTypeHttp || webhook.TargetType == deliverytarget.TargetTypeWebSocket
+	if isUrl && service.opts.Guard != nil {
+		if err := service.opts.Guard.CheckURL(webhook.Url); err != nil {
+			return nil, streams.NewPermanentError(err)
+		}
+	}
+
+	// Decrypts the webhook's credentials - only HTTP targets support them
+	auth, err := service.decryptAuth(webhook)
+	if err != nil {
+		return nil, err
+	}
+	if auth != nil && webhook.TargetType != deliverytarget.TargetTypeHttp {
+		return nil, streams.NewPermanentError(fmt.Errorf("target type \"%s\" does not support authentication", webhook.TargetType))
+	}
+
+	switch webhook.TargetType {
+	case deliverytarget.TargetTypeHttp:
+		var opts httptarget.HttpTargetOpts
+		if err := parseTargetConfig(webhook.TargetConfig, &opts); err != nil {
+			return nil, err
+		} else {
+			opts.Auth = auth
+		}
+		client, err := service.clientFor(auth)
+		if err != nil {
+			return nil, err
+		}
+		return httptarget.NewHttpTarget(client, webhook.Url, &opts), nil
+	case deliverytarget.TargetTypeWebSocket:
+		return wstarget.NewWebSocketTarget(service.dialer, webhook.Url), nil
+	case deliverytarget.TargetTypeTcp:
+		return tcptarget.NewTcpTarget(service.dialer, webhook.Url), nil
+	case deliverytarget.TargetTypeGrpc:
+		var opts grpctarget.GrpcTargetOpts
+		if err := parseTargetConfig(webhook.TargetConfig, &opts); err != nil {
+			return nil, err
+		}
+		return grpctarget.NewGrpcTarget(service.dialer, webhook.Url, &opts)
+	case deliverytarget.TargetTypeAmqp:
+		var opts amqptarget.AmqpTargetOpts
+		if err := parseTargetConfig(webhook.TargetConfig, &opts); err != nil {
+			return nil, err
+		}
+		return amqptarget.NewAmqpTarget(service.dialer, webhook.Url, &opts)
+	default:
+		return nil, streams.NewPermanentError(fmt.Errorf("unsupported target type \"%s\"", webhook.TargetType))
+	}
+}
+
+// Decrypts the credentials of a webhook (nil if it has none). A webhook's credentials can't be
+// used without the key that encrypted them, which retrying will not fix.
+func (service *BlockRelay) decryptAuth(webhook *queries.Webhook) (*webhookauth.Config, error) {
+	if !webhook.EncryptedAuth.Valid {
+		return nil, nil
+	}
+	if service.authCipher == nil {
+		return nil, streams.NewPermanentError(errors.New("webhook has credentials but no decryption key was configured"))
+	}
+	auth, err := service.authCipher.Decrypt(webhook.ID, webhook.EncryptedAuth.String)
+	if err != nil {
+		return nil, streams.NewPermanentError(err)
+	}
+	return auth, nil
+}
+
+// Gets the HTTP client for a webhook's credentials - webhooks with a client certificate share
+// a client with the other webhooks that use the same certificate
+func (service *BlockRelay) clientFor(auth *webhookauth.Config) (*http.Client, error) {
+	if auth == nil || auth.ClientCert == "" {
+		return service.httpClient, nil
+	}
+	if client, exists := service.mtlsClients.Load(auth.ClientCert); exists {
+		return client.(*http.Client), nil
+	}
+
+	// Checks that the certificate can be loaded before creating a client for it
+	if service.certStore == nil {
+		return nil, streams.NewPermanentError(errors.New("webhook has a client certificate but no certificate store was configured"))
+	}
+	if _, err := service.certStore.Get(auth.ClientCert); err != nil {
+		return nil, err
+	}
+
+	name := auth.ClientCert
+	client, _ := service.mtlsClients.LoadOrStore(name, NewMTLSClient(service.opts, func() (*tls.Certificate, error) {
+		return service.certStore.Get(name)
+	}))
+	return client.(*http.Client), nil
+}
+
+func parseTargetConfig(raw json.RawMessage, opts any) error {
+	if len(raw) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(raw, opts); err != nil {
+		return streams.NewPermanentError(fmt.Errorf("invalid target config: %w", err))
+	}
+	return nil
+}
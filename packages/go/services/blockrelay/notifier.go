@@ -0,0 +1,72 @@
+package blockrelay
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	WebhookEventDeactivated = "webhook.deactivated"
+)
+
+type (
+	// WebhookEvent describes something that happened to a webhook which the customer
+	// should be told about
+	WebhookEvent struct {
+		Type       string    `json:"type"`
+		WebhookID  string    `json:"webhookId"`
+		CustomerID string    `json:"customerId"`
+		Reason     string    `json:"reason"`
+		Timestamp  time.Time `json:"timestamp"`
+	}
+
+	// IWebhookNotifier is called when a webhook event occurs - it is up to the
+	// implementation to decide how the customer is contacted
+	IWebhookNotifier interface {
+		Notify(ctx context.Context, event WebhookEvent) error
+	}
+
+	// HttpNotifier POSTs webhook events as JSON to a URL (e.g. an internal service that
+	// emails customers)
+	HttpNotifier struct {
+		client *http.Client
+		url    string
+	}
+)
+
+func NewHttpNotifier(client *http.Client, url string) *HttpNotifier {
+	return &HttpNotifier{
+		client: client,
+		url:    url,
+	}
+}
+
+func (notifier *HttpNotifier) Notify(ctx context.Context, event WebhookEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", notifier.url, bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	} else {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := notifier.client.Do(req)
+	if err != nil {
+		return err
+	} else {
+		defer resp.Body.Close()
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("notifier responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
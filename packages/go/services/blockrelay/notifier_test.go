@@ -0,0 +1,45 @@
+package blockrelay
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHttpNotifier(t *testing.T) {
+	events := make(chan WebhookEvent, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event WebhookEvent
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		events <- event
+	}))
+	defer server.Close()
+
+	expected := WebhookEvent{
+		Type:       WebhookEventDeactivated,
+		WebhookID:  "webhook",
+		CustomerID: "customer",
+		Reason:     "connection refused",
+		Timestamp:  time.Now().UTC().Truncate(time.Second),
+	}
+
+	notifier := NewHttpNotifier(server.Client(), server.URL)
+	if err := notifier.Notify(context.Background(), expected); err != nil {
+		t.Fatal(err)
+	}
+
+	if actual := <-events; actual != expected {
+		t.Fatalf("Expected %v but got %v", expected, actual)
+	}
+
+	failing := NewHttpNotifier(server.Client(), server.URL+"/%zz")
+	if err := failing.Notify(context.Background(), expected); err == nil {
+		t.Fatal("Expected an error for an invalid URL")
+	}
+}
@@ -0,0 +1,112 @@
+package blockrelay
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/chris-de-leon/block-feed-prototype/netguard"
+	"github.com/chris-de-leon/block-feed-prototype/streams"
+)
+
+const (
+	DefaultMaxIdleConns          = 1000
+	DefaultMaxIdleConnsPerHost   = 10
+	DefaultIdleConnTimeoutMs     = 90000
+	DefaultDialTimeoutMs         = 5000
+	DefaultTLSHandshakeTimeoutMs = 5000
+	DefaultKeepAliveMs           = 30000
+)
+
+// Creates the transport that is shared by every delivery. Webhook processors send requests
+// to thousands of different hosts, so idle connections are capped per host to stop a few
+// busy hosts from hogging the pool. Zero valued options fall back to the defaults above.
+func NewHTTPTransport(opts *BlockRelayOpts) *http.Transport {
+	// A proxy would hide the webhook's address from the guard, so guarded requests are
+	// always sent directly
+	proxy := http.ProxyFromEnvironment
+	if opts.Guard != nil {
+		proxy = nil
+	}
+
+	// Trusts the system's CAs unless others were given
+	var tlsConfig *tls.Config
+	if opts.RootCAs != nil {
+		tlsConfig = &tls.Config{MinVersion: tls.VersionTLS12, RootCAs: opts.RootCAs}
+	}
+
+	dialer := NewDialer(opts)
+	return &http.Transport{
+		Proxy:                 proxy,
+		TLSClientConfig:       tlsConfig,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     !opts.DisableHTTP2,
+		MaxIdleConns:          intOrDefault(opts.MaxIdleConns, DefaultMaxIdleConns),
+		MaxIdleConnsPerHost:   intOrDefault(opts.MaxIdleConnsPerHost, DefaultMaxIdleConnsPerHost),
+		MaxConnsPerHost:       opts.MaxConnsPerHost,
+		IdleConnTimeout:       msOrDefault(opts.IdleConnTimeoutMs, DefaultIdleConnTimeoutMs),
+		TLSHandshakeTimeout:   msOrDefault(opts.TLSHandshakeTimeoutMs, DefaultTLSHandshakeTimeoutMs),
+		ExpectContinueTimeout: time.Second,
+	}
+}
+
+// Creates the dialer that is used to open connections to webhooks (for any target type)
+func NewDialer(opts *BlockRelayOpts) *net.Dialer {
+	dialer := &net.Dialer{
+		Timeout:   msOrDefault(opts.DialTimeoutMs, DefaultDialTimeoutMs),
+		KeepAlive: msOrDefault(opts.KeepAliveMs, DefaultKeepAliveMs),
+	}
+	if opts.Guard != nil {
+		return opts.Guard.Dialer(dialer)
+	}
+	return dialer
+}
+
+// Creates the client that is used to send HTTP requests to webhooks
+func NewHTTPClient(opts *BlockRelayOpts) *http.Client {
+	return newHTTPClient(opts, NewHTTPTransport(opts))
+}
+
+// Creates a client that presents a client certificate to webhooks which require mutual TLS.
+// A connection that was opened with a certificate must never be reused for webhooks that
+// don't own it, so each certificate gets a transport (and a connection pool) of its own.
+// The certificate is fetched on every handshake so that it can be rotated.
+func NewMTLSClient(opts *BlockRelayOpts, getCert func() (*tls.Certificate, error)) *http.Client {
+	transport := NewHTTPTransport(opts)
+	transport.TLSClientConfig = &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		RootCAs:    opts.RootCAs,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return getCert()
+		},
+	}
+	return newHTTPClient(opts, transport)
+}
+
+func newHTTPClient(opts *BlockRelayOpts, transport *http.Transport) *http.Client {
+	if opts.Guard != nil {
+		return &http.Client{Transport: opts.Guard.Transport(transport)}
+	}
+	return &http.Client{Transport: transport}
+}
+
+// Connections that the guard blocked will never succeed, so they are not retried
+func classifyBlocked(err error) error {
+	if errors.Is(err, netguard.ErrDestinationBlocked) && streams.GetErrorKind(err) == streams.ErrorKindRetryable {
+		return streams.NewPermanentError(err)
+	}
+	return err
+}
+
+func msOrDefault(ms int, defaultMs int) time.Duration {
+	return time.Duration(intOrDefault(ms, defaultMs)) * time.Millisecond
+}
+
+func intOrDefault(value int, defaultValue int) int {
+	if value <= 0 {
+		return defaultValue
+	}
+	return value
+}
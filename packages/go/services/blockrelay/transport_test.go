@@ -0,0 +1,172 @@
+package blockrelay
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"database/sql"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/chris-de-leon/block-feed-prototype/delivery-targets/deliverytarget"
+	"github.com/chris-de-leon/block-feed-prototype/queries"
+	"github.com/chris-de-leon/block-feed-prototype/webhookauth"
+)
+
+func TestWebhookAuth(t *testing.T) {
+	// Creates a CA and a client certificate that it signed
+	ca, caKey := newTestCert(t, "test-ca", nil, nil)
+	client, clientKey := newTestCert(t, "acme", ca, caKey)
+
+	// Stores the client certificate
+	certDir := t.TempDir()
+	writeTestCert(t, filepath.Join(certDir, "acme"), client, clientKey)
+
+	// Starts a TLS server which only accepts clients with a certificate from the CA
+	requests := make(chan *http.Request, 1)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- r
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: x509.NewCertPool()}
+	server.TLS.ClientCAs.AddCert(ca)
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	// Creates a relay that trusts the server
+	key := make([]byte, webhookauth.KeySize)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	authCipher, err := webhookauth.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(server.Certificate())
+	relay := NewBlockRelay(BlockRelayParams{
+		AuthCipher: authCipher,
+		CertStore:  webhookauth.NewCertStore(certDir),
+		Opts:       &BlockRelayOpts{RootCAs: rootCAs},
+	})
+
+	// Defines a helper function that delivers to the server as a webhook with the given credentials
+	deliver := func(t *testing.T, auth *webhookauth.Config) error {
+		webhook := &queries.Webhook{ID: "webhook-1", Url: server.URL, TargetType: deliverytarget.TargetTypeHttp}
+		if auth != nil {
+			encrypted, err := authCipher.Encrypt(webhook.ID, auth)
+			if err != nil {
+				t.Fatal(err)
+			}
+			webhook.EncryptedAuth = sql.NullString{String: encrypted, Valid: true}
+		}
+
+		target, err := relay.newTarget(webhook)
+		if err != nil {
+			return err
+		}
+		defer target.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return target.Deliver(ctx, &deliverytarget.Delivery{
+			Headers: map[string]string{DeliveryIDHeader: "delivery-1"},
+			Body:    []byte("[]"),
+		})
+	}
+
+	t.Run("presents the credentials", func(t *testing.T) {
+		if err := deliver(t, &webhookauth.Config{
+			Headers:    map[string]string{"X-Api-Key": "secret", DeliveryIDHeader: "spoofed"},
+			BasicAuth:  &webhookauth.BasicAuth{Username: "user", Password: "pass"},
+			ClientCert: "acme",
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		req := <-requests
+		if len(req.TLS.PeerCertificates) == 0 || req.TLS.PeerCertificates[0].Subject.CommonName != "acme" {
+			t.Fatal("Expected the client certificate to be presented")
+		}
+		if req.Header.Get("X-Api-Key") != "secret" {
+			t.Fatalf("Expected the custom header to be sent but got %v", req.Header)
+		}
+		if user, pass, ok := req.BasicAuth(); !ok || user != "user" || pass != "pass" {
+			t.Fatalf("Unexpected basic auth: %s %s %v", user, pass, ok)
+		}
+		if id := req.Header.Get(DeliveryIDHeader); id != "delivery-1" {
+			t.Fatalf("Expected custom headers not to replace the delivery headers but got %s", id)
+		}
+	})
+
+	t.Run("does not share certificates with other webhooks", func(t *testing.T) {
+		if err := deliver(t, nil); err == nil {
+			t.Fatal("Expected the server to reject a webhook without a client certificate")
+		}
+	})
+
+	t.Run("rejects unknown certificates", func(t *testing.T) {
+		if err := deliver(t, &webhookauth.Config{ClientCert: "unknown"}); err == nil {
+			t.Fatal("Expected an error")
+		}
+	})
+}
+
+// Creates a certificate signed by the given parent (or a self-signed CA if there is none)
+func newTestCert(t *testing.T, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+// Writes a certificate and its key in the layout of a webhookauth.CertStore
+func writeTestCert(t *testing.T, dir string, cert *x509.Certificate, key *ecdsa.PrivateKey) {
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, webhookauth.CertFileName), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, webhookauth.KeyFileName), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -16,14 +16,14 @@ type (
 	}
 
 	BlockRouterParams struct {
-		BlockStream    *streams.BlockStream
+		BlockStream    streams.IBlockStream
 		BlockStore     blockstore.IBlockStore
 		Opts           *BlockRouterOpts
 		WebhookStreams []*streams.WebhookStream
 	}
 
 	BlockRouter struct {
-		blockStream    *streams.BlockStream
+		blockStream    streams.IBlockStream
 		blockStore     blockstore.IBlockStore
 		opts           *BlockRouterOpts
 		webhookStreams []*streams.WebhookStream
@@ -69,7 +69,7 @@ func (service *BlockRouter) handleMessages(
 	}
 
 	// Idempotently adds the blocks to the block store
-	if err := service.blockStore.PutBlocks(ctx, service.blockStream.Chain, blocks); err != nil {
+	if err := service.blockStore.PutBlocks(ctx, service.blockStream.Chain(), blocks); err != nil {
 		return err
 	}
 
@@ -86,6 +86,6 @@ func (service *BlockRouter) handleMessages(
 	if err := eg.Wait(); err != nil {
 		return err
 	} else {
-		return service.blockStream.XAckDel(ctx, msgIDs)
+		return service.blockStream.Ack(ctx, msgIDs)
 	}
 }
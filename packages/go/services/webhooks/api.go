@@ -0,0 +1,168 @@
+package webhooks
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/chris-de-leon/block-feed-prototype/common"
+	"github.com/chris-de-leon/block-feed-prototype/streams"
+)
+
+type (
+	WebhookApiOpts struct {
+		// Requests must carry this token as a bearer token (an empty token rejects every request)
+		Token string
+	}
+
+	// WebhookApi exposes the lifecycle operations of a WebhookService over HTTP so that the
+	// dashboard doesn't have to change MySQL and redis on its own. The caller is expected to
+	// check that the customer owns the webhook before making a request.
+	//
+	//  POST   /webhooks/{id}/activate
+	//  POST   /webhooks/{id}/pause
+	//  POST   /webhooks/{id}/resume
+	//  POST   /webhooks/{id}/cursor  {"height": 123}
+	//  POST   /webhooks/{id}/replay  {"startHeight": 100, "endHeight": 200} -> {"replayId": "..."}
+	//  DELETE /webhooks/{id}
+	//
+	// Errors are returned as {"error": "..."} with a status code that reflects their cause.
+	WebhookApi struct {
+		service *WebhookService
+		opts    *WebhookApiOpts
+	}
+
+	setCursorRequest struct {
+		Height uint64 `json:"height"`
+	}
+
+	replayRequest struct {
+		StartHeight uint64 `json:"startHeight"`
+		EndHeight   uint64 `json:"endHeight"`
+	}
+
+	replayResponse struct {
+		ReplayID string `json:"replayId"`
+	}
+
+	errorResponse struct {
+		Error string `json:"error"`
+	}
+
+	// Wraps errors that are caused by a malformed request
+	requestError struct {
+		err error
+	}
+)
+
+func NewWebhookApi(service *WebhookService, opts *WebhookApiOpts) *WebhookApi {
+	return &WebhookApi{
+		service: service,
+		opts:    opts,
+	}
+}
+
+// Creates the handler that serves the API
+func (api *WebhookApi) Handler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("POST /webhooks/{id}/activate", func(w http.ResponseWriter, r *http.Request) {
+		api.respond(w, nil, api.service.Activate(r.Context(), r.PathValue("id")))
+	})
+
+	mux.HandleFunc("POST /webhooks/{id}/pause", func(w http.ResponseWriter, r *http.Request) {
+		api.respond(w, nil, api.service.Pause(r.Context(), r.PathValue("id")))
+	})
+
+	mux.HandleFunc("POST /webhooks/{id}/resume", func(w http.ResponseWriter, r *http.Request) {
+		api.respond(w, nil, api.service.Resume(r.Context(), r.PathValue("id")))
+	})
+
+	mux.HandleFunc("POST /webhooks/{id}/cursor", func(w http.ResponseWriter, r *http.Request) {
+		var req setCursorRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			api.respond(w, nil, &requestError{err})
+			return
+		}
+		api.respond(w, nil, api.service.SetCursor(r.Context(), r.PathValue("id"), req.Height))
+	})
+
+	mux.HandleFunc("POST /webhooks/{id}/replay", func(w http.ResponseWriter, r *http.Request) {
+		var req replayRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			api.respond(w, nil, &requestError{err})
+			return
+		}
+		replayID, err := api.service.Replay(r.Context(), r.PathValue("id"), req.StartHeight, req.EndHeight)
+		api.respond(w, &replayResponse{ReplayID: replayID}, err)
+	})
+
+	mux.HandleFunc("DELETE /webhooks/{id}", func(w http.ResponseWriter, r *http.Request) {
+		api.respond(w, nil, api.service.Delete(r.Context(), r.PathValue("id")))
+	})
+
+	return api.authorize(mux)
+}
+
+// Rejects requests that don't carry the API token
+func (api *WebhookApi) authorize(next http.Handler) http.Handler {
+	expected := []byte("Bearer " + api.opts.Token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if api.opts.Token == "" || subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			writeJSON(w, http.StatusUnauthorized, &errorResponse{Error: "unauthorized"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Writes the result of an operation - nil bodies are sent as 204 No Content
+func (api *WebhookApi) respond(w http.ResponseWriter, body any, err error) {
+	if err != nil {
+		status := GetStatusCode(err)
+		if status == http.StatusInternalServerError {
+			common.LogError(nil, err)
+		}
+		writeJSON(w, status, &errorResponse{Error: err.Error()})
+		return
+	}
+	if body == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeJSON(w, http.StatusOK, body)
+}
+
+// Maps an error from the service to the status code that is sent back to the caller
+func GetStatusCode(err error) int {
+	var reqErr *requestError
+	switch {
+	case errors.As(err, &reqErr):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrWebhookNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrWebhookNotPaused), errors.Is(err, streams.ErrWebhookNotActive):
+		return http.StatusConflict
+	case errors.Is(err, ErrWebhookNotVerified), errors.Is(err, streams.ErrHeightOutOfRange):
+		return http.StatusUnprocessableEntity
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		common.LogError(nil, err)
+	}
+}
+
+func (e *requestError) Error() string {
+	return "invalid request body: " + e.err.Error()
+}
+
+func (e *requestError) Unwrap() error {
+	return e.err
+}
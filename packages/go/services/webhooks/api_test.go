@@ -0,0 +1,69 @@
+package webhooks
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/chris-de-leon/block-feed-prototype/streams"
+)
+
+func TestWebhookApi(t *testing.T) {
+	t.Run("rejects requests without the token", func(t *testing.T) {
+		handler := NewWebhookApi(&WebhookService{}, &WebhookApiOpts{Token: "secret"}).Handler()
+		for _, header := range []string{"", "Bearer wrong", "secret"} {
+			req := httptest.NewRequest(http.MethodPost, "/webhooks/1/pause", nil)
+			if header != "" {
+				req.Header.Set("Authorization", header)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != http.StatusUnauthorized {
+				t.Fatalf("Expected %d for %q but got %d", http.StatusUnauthorized, header, rec.Code)
+			}
+		}
+	})
+
+	t.Run("rejects every request without a configured token", func(t *testing.T) {
+		handler := NewWebhookApi(&WebhookService{}, &WebhookApiOpts{}).Handler()
+		for _, header := range []string{"", "Bearer ", "Bearer"} {
+			req := httptest.NewRequest(http.MethodPost, "/webhooks/1/pause", nil)
+			if header != "" {
+				req.Header.Set("Authorization", header)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != http.StatusUnauthorized {
+				t.Fatalf("Expected %d for %q but got %d", http.StatusUnauthorized, header, rec.Code)
+			}
+		}
+	})
+
+	t.Run("rejects malformed bodies", func(t *testing.T) {
+		handler := NewWebhookApi(&WebhookService{}, &WebhookApiOpts{Token: "secret"}).Handler()
+		req := httptest.NewRequest(http.MethodPost, "/webhooks/1/replay", nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("Expected %d but got %d", http.StatusBadRequest, rec.Code)
+		}
+	})
+
+	t.Run("maps errors to status codes", func(t *testing.T) {
+		for err, expected := range map[error]int{
+			ErrWebhookNotFound:    http.StatusNotFound,
+			ErrWebhookNotPaused:   http.StatusConflict,
+			ErrWebhookNotVerified: http.StatusUnprocessableEntity,
+			fmt.Errorf("%w: too high", streams.ErrHeightOutOfRange): http.StatusUnprocessableEntity,
+			streams.ErrWebhookNotActive:                             http.StatusConflict,
+			errors.New("connection refused"):                        http.StatusInternalServerError,
+		} {
+			if status := GetStatusCode(err); status != expected {
+				t.Fatalf("Expected %d for %q but got %d", expected, err, status)
+			}
+		}
+	})
+}
@@ -0,0 +1,289 @@
+package webhooks
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/chris-de-leon/block-feed-prototype/block-stores/blockstore"
+	"github.com/chris-de-leon/block-feed-prototype/queries"
+	"github.com/chris-de-leon/block-feed-prototype/streams"
+	"github.com/chris-de-leon/block-feed-prototype/webhookauth"
+	"github.com/chris-de-leon/block-feed-prototype/webhookcache"
+	"github.com/chris-de-leon/block-feed-prototype/webhookverify"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Gives an endpoint a little longer than the webhook's timeout to answer a challenge
+const VerificationTimeoutExtension = 5 * time.Second
+
+var (
+	ErrWebhookNotFound    = errors.New("webhook not found")
+	ErrWebhookNotPaused   = errors.New("webhook is not paused")
+	ErrWebhookNotVerified = errors.New("webhook endpoint could not be verified")
+)
+
+type (
+	WebhookServiceOpts struct {
+		ChainID string
+	}
+
+	WebhookServiceParams struct {
+		// One webhook stream per shard of the chain (indexed by shard ID)
+		WebhookStreams []*streams.WebhookStream
+		RedisClient    *redis.ClusterClient
+		Queries        *queries.Queries
+		Opts           *WebhookServiceOpts
+
+		// Challenges endpoints before their webhooks are activated (nil skips verification)
+		Verifier *webhookverify.EndpointVerifier
+
+		// Decrypts the credentials that are presented to endpoints during verification
+		AuthCipher *webhookauth.Cipher
+
+		// Checks that the blocks a cursor or a replay starts from are still stored (nil skips the check)
+		BlockStore blockstore.IBlockStore
+	}
+
+	// WebhookService manages the lifecycle of the webhooks on a single chain. The is_active
+	// column in MySQL is the source of truth - each operation updates MySQL first and then
+	// applies the change to redis. If the redis half fails, then the operation can be safely
+	// retried, and the WebhookReconciler finishes it otherwise.
+	WebhookService struct {
+		webhookStreams []*streams.WebhookStream
+		redisClient    *redis.ClusterClient
+		queries        *queries.Queries
+		verifier       *webhookverify.EndpointVerifier
+		authCipher     *webhookauth.Cipher
+		blockStore     blockstore.IBlockStore
+		opts           *WebhookServiceOpts
+	}
+)
+
+func NewWebhookService(params WebhookServiceParams) *WebhookService {
+	return &WebhookService{
+		webhookStreams: params.WebhookStreams,
+		redisClient:    params.RedisClient,
+		queries:        params.Queries,
+		verifier:       params.Verifier,
+		authCipher:     params.AuthCipher,
+		blockStore:     params.BlockStore,
+		opts:           params.Opts,
+	}
+}
+
+// Activates a webhook so that it receives new blocks as they arrive. A paused webhook is
+// resumed from where it left off. The webhook's endpoint must pass verification first.
+func (service *WebhookService) Activate(ctx context.Context, webhookID string) error {
+	webhook, stream, err := service.find(ctx, webhookID)
+	if err != nil {
+		return err
+	}
+
+	if err := service.Verify(ctx, webhook); err != nil {
+		return err
+	}
+
+	if _, err := service.queries.WebhooksActivate(ctx, webhook.ID); err != nil {
+		return err
+	}
+
+	_, err = stream.Activate(ctx, NewActivationJob(webhook))
+	return err
+}
+
+// Pauses a webhook - its position is kept so that no blocks are skipped once it is resumed
+func (service *WebhookService) Pause(ctx context.Context, webhookID string) error {
+	webhook, stream, err := service.find(ctx, webhookID)
+	if err != nil {
+		return err
+	}
+
+	if _, err := service.queries.WebhooksDeactivate(ctx, webhook.ID); err != nil {
+		return err
+	}
+
+	// A webhook that isn't active in redis has no job to pause
+	if err := stream.Pause(ctx, webhook.ID); err != nil && !errors.Is(err, streams.ErrWebhookNotActive) {
+		return err
+	}
+	return nil
+}
+
+// Resumes a paused webhook from where it left off
+func (service *WebhookService) Resume(ctx context.Context, webhookID string) error {
+	webhook, stream, err := service.find(ctx, webhookID)
+	if err != nil {
+		return err
+	}
+
+	if isPaused, err := stream.IsPaused(ctx, webhook.ID); err != nil {
+		return err
+	} else if !isPaused {
+		return ErrWebhookNotPaused
+	}
+
+	// The webhook's URL may have changed while it was paused
+	if err := service.Verify(ctx, webhook); err != nil {
+		return err
+	}
+
+	if _, err := service.queries.WebhooksActivate(ctx, webhook.ID); err != nil {
+		return err
+	}
+
+	_, err = stream.Activate(ctx, NewActivationJob(webhook))
+	return err
+}
+
+// Deletes a webhook. Jobs that are still in the stream are discarded by the processors
+// once they see that the webhook no longer exists.
+func (service *WebhookService) Delete(ctx context.Context, webhookID string) error {
+	webhook, stream, err := service.find(ctx, webhookID)
+	if err != nil {
+		return err
+	}
+
+	if _, err := service.queries.WebhooksDelete(ctx, webhook.ID); err != nil {
+		return err
+	}
+
+	if err := stream.Remove(ctx, webhook.ID); err != nil {
+		return err
+	}
+
+	// Stops processors from using their cached copy of the webhook
+	return webhookcache.Publish(ctx, service.redisClient, webhook.ID)
+}
+
+// Moves the cursor of a webhook to the given height (see WebhookStream.SetCursor)
+func (service *WebhookService) SetCursor(ctx context.Context, webhookID string, height uint64) error {
+	webhook, stream, err := service.find(ctx, webhookID)
+	if err != nil {
+		return err
+	}
+
+	// A cursor that is one block past the latest block waits for it to arrive, so only
+	// heights up to the latest block need to be in the store
+	if latestHeight, exists, err := stream.GetLatestBlockHeight(ctx); err != nil {
+		return err
+	} else if exists && height <= latestHeight {
+		if err := service.checkStored(ctx, height); err != nil {
+			return err
+		}
+	}
+
+	_, err = stream.SetCursor(ctx, webhook.ID, height)
+	return err
+}
+
+// Resends a range of blocks to a webhook once (see WebhookStream.Replay)
+func (service *WebhookService) Replay(ctx context.Context, webhookID string, startHeight uint64, endHeight uint64) (string, error) {
+	webhook, stream, err := service.find(ctx, webhookID)
+	if err != nil {
+		return "", err
+	}
+
+	if err := service.checkStored(ctx, startHeight); err != nil {
+		return "", err
+	}
+
+	return stream.Replay(ctx, webhook.ID, startHeight, endHeight)
+}
+
+// Challenges a webhook's endpoint unless its current URL was already verified (see the
+// webhookverify package). The URL is only stored as verified if it hasn't changed since
+// the webhook was read.
+func (service *WebhookService) Verify(ctx context.Context, webhook *queries.Webhook) error {
+	if service.verifier == nil || webhookverify.IsVerified(webhook) {
+		return nil
+	}
+
+	// Decrypts the webhook's credentials (if it has any)
+	var auth *webhookauth.Config
+	if webhook.EncryptedAuth.Valid {
+		if service.authCipher == nil {
+			return fmt.Errorf("webhook %s has credentials but no key was configured to decrypt them", webhook.ID)
+		}
+		decrypted, err := service.authCipher.Decrypt(webhook.ID, webhook.EncryptedAuth.String)
+		if err != nil {
+			return err
+		} else {
+			auth = decrypted
+		}
+	}
+
+	verifyCtx, cancel := context.WithTimeout(ctx, time.Duration(webhook.TimeoutMs)*time.Millisecond+VerificationTimeoutExtension)
+	defer cancel()
+	if err := service.verifier.Verify(verifyCtx, webhook.Url, webhook.SigningSecret, auth); err != nil {
+		return fmt.Errorf("%w: %w", ErrWebhookNotVerified, err)
+	}
+
+	if count, err := service.queries.WebhooksVerify(ctx, &queries.WebhooksVerifyParams{ID: webhook.ID, Url: webhook.Url}); err != nil {
+		return err
+	} else if count == 0 {
+		return fmt.Errorf("%w: webhook %s was modified during verification", ErrWebhookNotVerified, webhook.ID)
+	}
+
+	// Lets the relays know that the webhook was verified
+	webhook.VerifiedUrl = sql.NullString{String: webhook.Url, Valid: true}
+	return webhookcache.Publish(ctx, service.redisClient, webhook.ID)
+}
+
+// Makes sure that the block at the given height is still in the block store. Blocks are only
+// removed from the bottom of the store, so the blocks that come after it are there as well.
+func (service *WebhookService) checkStored(ctx context.Context, height uint64) error {
+	if service.blockStore == nil {
+		return nil
+	}
+
+	blocks, err := service.blockStore.GetBlocks(ctx, service.opts.ChainID, height, height)
+	if err != nil {
+		return err
+	}
+	if len(blocks) == 0 {
+		return fmt.Errorf("%w: block %d is not in the block store", streams.ErrHeightOutOfRange, height)
+	}
+	return nil
+}
+
+// Creates the first job of a webhook - webhooks with a start height backfill the blocks from
+// that height onwards, and the rest start from the latest block
+func NewActivationJob(webhook *queries.Webhook) *streams.StreamMessage[streams.WebhookStreamMsgData] {
+	if webhook.StartHeight.Valid {
+		return streams.NewBackfillStreamMsg(webhook.ID, uint64(webhook.StartHeight.Int64))
+	}
+	return streams.NewWebhookStreamMsg(webhook.ID, 0, true)
+}
+
+// Gets a webhook along with the stream of the shard that it belongs to
+func (service *WebhookService) find(ctx context.Context, webhookID string) (*queries.Webhook, *streams.WebhookStream, error) {
+	webhook, err := service.queries.WebhooksFindOne(ctx, webhookID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, ErrWebhookNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if webhook.BlockchainID != service.opts.ChainID {
+		return nil, nil, fmt.Errorf("webhook %s belongs to chain %s, not %s", webhook.ID, webhook.BlockchainID, service.opts.ChainID)
+	}
+
+	stream, err := service.stream(webhook.ShardID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return webhook, stream, nil
+}
+
+func (service *WebhookService) stream(shardID int32) (*streams.WebhookStream, error) {
+	if shardID < 0 || int(shardID) >= len(service.webhookStreams) {
+		return nil, fmt.Errorf("shard %d does not exist on chain %s", shardID, service.opts.ChainID)
+	}
+	return service.webhookStreams[shardID], nil
+}
@@ -0,0 +1,171 @@
+package webhooks
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"os"
+	"time"
+
+	"github.com/chris-de-leon/block-feed-prototype/common"
+	"github.com/chris-de-leon/block-feed-prototype/queries"
+	"github.com/chris-de-leon/block-feed-prototype/streams"
+	"github.com/chris-de-leon/block-feed-prototype/webhookcache"
+)
+
+type (
+	WebhookReconcilerOpts struct {
+		IntervalMs int
+		BatchSize  int32
+	}
+
+	// WebhookReconciler repairs drift between MySQL and redis (e.g. if an operation failed
+	// after MySQL was updated, or if the dashboard activated a webhook in redis but failed
+	// to update MySQL). A webhook is expected to be in redis and unpaused if and only if it
+	// exists and its is_active column is true.
+	WebhookReconciler struct {
+		service *WebhookService
+		logger  *log.Logger
+		opts    *WebhookReconcilerOpts
+	}
+)
+
+func NewWebhookReconciler(service *WebhookService, opts *WebhookReconcilerOpts) *WebhookReconciler {
+	return &WebhookReconciler{
+		service: service,
+		logger:  log.New(os.Stdout, "[webhook-reconciler] ", log.LstdFlags),
+		opts:    opts,
+	}
+}
+
+// Reconciles every shard periodically until the context is cancelled
+func (reconciler *WebhookReconciler) Run(ctx context.Context) error {
+	ticker := time.NewTicker(time.Duration(reconciler.opts.IntervalMs) * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if repaired, err := reconciler.Reconcile(ctx); err != nil && ctx.Err() == nil {
+				common.LogError(reconciler.logger, err)
+			} else if repaired != 0 {
+				reconciler.logger.Printf("Repaired %d webhook(s)", repaired)
+			}
+		}
+	}
+}
+
+// Reconciles every shard once and returns the number of webhooks that were repaired
+func (reconciler *WebhookReconciler) Reconcile(ctx context.Context) (int, error) {
+	repaired := 0
+	for _, stream := range reconciler.service.webhookStreams {
+		count, err := reconciler.reconcileShard(ctx, stream)
+		repaired += count
+		if err != nil {
+			return repaired, err
+		}
+	}
+	return repaired, nil
+}
+
+func (reconciler *WebhookReconciler) reconcileShard(ctx context.Context, stream *streams.WebhookStream) (int, error) {
+	// NOTE: redis is read before MySQL. Operations update MySQL before redis, so if one
+	// happens while the shard is being read, then the reconciler either sees it in both
+	// places or sees a half finished operation and finishes it - the repairs below are
+	// idempotent so finishing it twice is harmless.
+	states, err := stream.GetWebhookStates(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	// Compares every webhook in the shard against its state in redis
+	drifted := []string{}
+	cursor := ""
+	for {
+		webhooks, err := reconciler.service.queries.WebhooksFindManyByShard(ctx, &queries.WebhooksFindManyByShardParams{
+			BlockchainID: reconciler.service.opts.ChainID,
+			ShardID:      stream.ShardNum,
+			Cursor:       cursor,
+			Limit:        reconciler.opts.BatchSize,
+		})
+		if err != nil {
+			return 0, err
+		}
+
+		for _, webhook := range webhooks {
+			isPaused, exists := states[webhook.ID]
+			delete(states, webhook.ID)
+			if webhook.IsActive != (exists && !isPaused) {
+				drifted = append(drifted, webhook.ID)
+			}
+		}
+
+		if len(webhooks) < int(reconciler.opts.BatchSize) {
+			break
+		} else {
+			cursor = webhooks[len(webhooks)-1].ID
+		}
+	}
+
+	// Anything left over is in redis but not in MySQL
+	for webhookID := range states {
+		drifted = append(drifted, webhookID)
+	}
+
+	// Repairs the webhooks that drifted
+	for i, webhookID := range drifted {
+		if err := reconciler.repair(ctx, stream, webhookID); err != nil {
+			return i, err
+		}
+	}
+	return len(drifted), nil
+}
+
+// Makes redis match the current state of a webhook in MySQL. The webhook is read again in
+// case it changed after the shard was compared.
+func (reconciler *WebhookReconciler) repair(ctx context.Context, stream *streams.WebhookStream, webhookID string) error {
+	webhook, err := reconciler.service.queries.WebhooksFindOne(ctx, webhookID)
+	if errors.Is(err, sql.ErrNoRows) {
+		reconciler.logger.Printf("Removing deleted webhook %s from shard %d", webhookID, stream.ShardNum)
+		if err := stream.Remove(ctx, webhookID); err != nil {
+			return err
+		}
+		return webhookcache.Publish(ctx, reconciler.service.redisClient, webhookID)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Webhooks that moved to another chain or shard are removed from this one
+	if webhook.BlockchainID != reconciler.service.opts.ChainID || webhook.ShardID != stream.ShardNum {
+		reconciler.logger.Printf("Removing webhook %s from shard %d", webhookID, stream.ShardNum)
+		return stream.Remove(ctx, webhookID)
+	}
+
+	// Webhooks that were activated without going through the service (e.g. by the dashboard)
+	// are only activated in redis once their endpoint is verified, otherwise they're turned
+	// off again
+	if webhook.IsActive {
+		if err := reconciler.service.Verify(ctx, webhook); errors.Is(err, ErrWebhookNotVerified) {
+			reconciler.logger.Printf("Deactivating webhook %s: %v", webhookID, err)
+			if _, err := reconciler.service.queries.WebhooksDeactivate(ctx, webhookID); err != nil {
+				return err
+			}
+		} else if err != nil {
+			return err
+		} else {
+			reconciler.logger.Printf("Activating webhook %s in shard %d", webhookID, stream.ShardNum)
+			_, err := stream.Activate(ctx, NewActivationJob(webhook))
+			return err
+		}
+	}
+
+	reconciler.logger.Printf("Pausing webhook %s in shard %d", webhookID, stream.ShardNum)
+	if err := stream.Pause(ctx, webhookID); err != nil && !errors.Is(err, streams.ErrWebhookNotActive) {
+		return err
+	}
+	return nil
+}
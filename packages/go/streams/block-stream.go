@@ -1,6 +1,8 @@
 package streams
 
 import (
+	"context"
+
 	"github.com/redis/go-redis/v9"
 )
 
@@ -15,9 +17,37 @@ type (
 		Height uint64
 	}
 
+	// IBlockStream defines the set of operations that the block forwarder and
+	// block router use to move blocks between each other. Implementations must
+	// deliver blocks to subscribers in the same order that they were published.
+	IBlockStream interface {
+		// Returns the ID of the chain that this stream carries blocks for
+		Chain() string
+
+		// Appends a block to the end of the stream
+		Publish(ctx context.Context, msg *StreamMessage[BlockStreamMsgData]) error
+
+		// Marks the given messages as fully processed so that they are never redelivered
+		Ack(ctx context.Context, msgIDs []string) error
+
+		// Continuously reads blocks from the stream and passes them to the handler
+		Subscribe(
+			ctx context.Context,
+			consumerName string,
+			concurrency int,
+			batchSize int64,
+			handler func(
+				ctx context.Context,
+				msgs []ParsedStreamMessage[BlockStreamMsgData],
+				isBacklogMsg bool,
+				metadata SubscribeMetadata,
+			) error,
+		) error
+	}
+
 	BlockStream struct {
 		*RedisStream[BlockStreamMsgData]
-		Chain string
+		chain string
 	}
 )
 
@@ -30,10 +60,22 @@ func NewBlockStreamMsg(height uint64, block []byte) *StreamMessage[BlockStreamMs
 	}
 }
 
-func NewBlockStream(client *redis.Client, chain string) *BlockStream {
-	redisStream := NewRedisStream[BlockStreamMsgData](client, BlockStreamName, BlockStreamConsumerGroupName)
+func NewBlockStream(client *redis.Client, chain string, opts *RedisStreamOpts) *BlockStream {
+	redisStream := NewRedisStream[BlockStreamMsgData](client, BlockStreamName, BlockStreamConsumerGroupName, opts)
 	return &BlockStream{
 		redisStream,
 		chain,
 	}
 }
+
+func (stream *BlockStream) Chain() string {
+	return stream.chain
+}
+
+func (stream *BlockStream) Publish(ctx context.Context, msg *StreamMessage[BlockStreamMsgData]) error {
+	return stream.XAdd(ctx, msg)
+}
+
+func (stream *BlockStream) Ack(ctx context.Context, msgIDs []string) error {
+	return stream.XAckDel(ctx, msgIDs)
+}
@@ -0,0 +1,152 @@
+package streams
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	CircuitClosed   CircuitState = "closed"
+	CircuitOpen     CircuitState = "open"
+	CircuitHalfOpen CircuitState = "half-open"
+)
+
+type (
+	CircuitState string
+
+	CircuitBreakerOpts struct {
+		// The number of consecutive failures that opens the circuit
+		FailureThreshold int64
+
+		// How long a webhook is parked between probes while its circuit is open
+		ProbeInterval time.Duration
+
+		// How long a webhook can keep failing before it should be deactivated
+		FailureWindow time.Duration
+	}
+
+	CircuitStatus struct {
+		State        CircuitState
+		Failures     int64
+		FailingSince time.Time
+
+		// True if the webhook has been failing for longer than the failure window
+		Expired bool
+	}
+
+	// CircuitBreaker tracks the health of each webhook in a shard. Every webhook starts
+	// out with a closed circuit. Consecutive failed deliveries are counted, and once the
+	// failure threshold is reached the circuit opens. While the circuit is open, the job
+	// for the webhook is parked (see WebhookStream.Park) instead of being retried. Once
+	// the probe interval passes, the job is moved back into the stream and the circuit
+	// becomes half-open - if that delivery succeeds then the circuit is closed again,
+	// otherwise it opens again and the job is parked until the next probe.
+	//
+	// The state of each circuit is stored in a hash so that it survives restarts and is
+	// shared by every processor in the shard. Webhooks with a closed circuit and no recent
+	// failures do not have a hash at all.
+	CircuitBreaker struct {
+		client  *redis.ClusterClient
+		shardID int32
+		opts    *CircuitBreakerOpts
+	}
+)
+
+func NewCircuitBreaker(client *redis.ClusterClient, shardID int32, opts *CircuitBreakerOpts) *CircuitBreaker {
+	return &CircuitBreaker{
+		client:  client,
+		shardID: shardID,
+		opts:    opts,
+	}
+}
+
+func (breaker *CircuitBreaker) ProbeInterval() time.Duration {
+	return breaker.opts.ProbeInterval
+}
+
+// Prepares a webhook's circuit for a delivery. If the circuit is open, then the delivery is
+// a probe and the circuit becomes half-open. The return value is false if the webhook has
+// no recent failures, in which case a successful delivery does not need to call Reset.
+func (breaker *CircuitBreaker) BeginDelivery(ctx context.Context, webhookID string) (bool, error) {
+	script := redis.NewScript(`
+    local circuit_key = KEYS[1]
+
+    if redis.call("HGET", circuit_key, "state") == "open" then
+      redis.call("HSET", circuit_key, "state", "half-open")
+    end
+    return redis.call("EXISTS", circuit_key)
+  `)
+
+	exists, err := script.Run(ctx, breaker.client, []string{GetCircuitBreakerKey(breaker.shardID, webhookID)}).Int64()
+	if err != nil {
+		return false, err
+	}
+	return exists == 1, nil
+}
+
+// Records a failed delivery and returns the new status of the circuit
+func (breaker *CircuitBreaker) RecordFailure(ctx context.Context, webhookID string, now time.Time) (*CircuitStatus, error) {
+	// This script increments the number of consecutive failures and opens the circuit if
+	// the failure threshold was reached or if the failed delivery was a probe. The time of
+	// the first failure is only set once so that the failure window is measured from the
+	// start of the outage rather than from the latest failure.
+	script := redis.NewScript(`
+    local circuit_key = KEYS[1]
+    local now_ms = ARGV[1]
+    local failure_threshold = tonumber(ARGV[2])
+
+    local failures = redis.call("HINCRBY", circuit_key, "failures", 1)
+    redis.call("HSETNX", circuit_key, "failing_since", now_ms)
+
+    local state = redis.call("HGET", circuit_key, "state")
+    if state == "half-open" or state == "open" or failures >= failure_threshold then
+      state = "open"
+    else
+      state = "closed"
+    end
+    redis.call("HSET", circuit_key, "state", state)
+
+    return {state, tostring(failures), redis.call("HGET", circuit_key, "failing_since")}
+  `)
+
+	result, err := script.Run(ctx, breaker.client,
+		[]string{GetCircuitBreakerKey(breaker.shardID, webhookID)},
+		[]any{now.UnixMilli(), breaker.opts.FailureThreshold},
+	).StringSlice()
+	if err != nil {
+		return nil, err
+	}
+	if len(result) != 3 {
+		return nil, fmt.Errorf("unexpected circuit breaker result: %v", result)
+	}
+	return breaker.parseStatus(result[0], result[1], result[2], now)
+}
+
+// Closes a webhook's circuit and forgets its failures
+func (breaker *CircuitBreaker) Reset(ctx context.Context, webhookID string) error {
+	return breaker.client.Del(ctx, GetCircuitBreakerKey(breaker.shardID, webhookID)).Err()
+}
+
+func (breaker *CircuitBreaker) parseStatus(state string, failures string, failingSince string, now time.Time) (*CircuitStatus, error) {
+	failureCount, err := strconv.ParseInt(failures, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	failingSinceMs, err := strconv.ParseInt(failingSince, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &CircuitStatus{
+		State:        CircuitState(state),
+		Failures:     failureCount,
+		FailingSince: time.UnixMilli(failingSinceMs),
+	}
+	status.Expired = status.State == CircuitOpen && now.Sub(status.FailingSince) >= breaker.opts.FailureWindow
+	return status, nil
+}
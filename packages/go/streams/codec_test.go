@@ -0,0 +1,72 @@
+package streams
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestCodecs(t *testing.T) {
+	msg := NewBlockStreamMsg(10, bytes.Repeat([]byte{0xff}, 1024))
+
+	// Checks that a message survives a round trip through every codec
+	for name := range codecs {
+		t.Run(name, func(t *testing.T) {
+			codec, err := GetCodec(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			data, err := msg.Encode(codec)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			parsed, err := ParseMessage[BlockStreamMsgData](redis.XMessage{
+				ID:     "0-1",
+				Values: map[string]any{GetDataField(): string(data), CodecField: codec.Name()},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if parsed.Height != msg.Data.Height || !bytes.Equal(parsed.Block, msg.Data.Block) {
+				t.Fatalf("Expected %v but got %v", msg.Data, *parsed)
+			}
+		})
+	}
+
+	// Checks that entries without a codec tag are decoded as JSON
+	t.Run("untagged", func(t *testing.T) {
+		data, err := msg.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		parsed, err := ParseMessage[BlockStreamMsgData](redis.XMessage{
+			ID:     "0-1",
+			Values: map[string]any{GetDataField(): string(data)},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if parsed.Height != msg.Data.Height || !bytes.Equal(parsed.Block, msg.Data.Block) {
+			t.Fatalf("Expected %v but got %v", msg.Data, *parsed)
+		}
+	})
+
+	// Checks that MessagePack does not inflate the block bytes like JSON does
+	t.Run("size", func(t *testing.T) {
+		jsonData, err := msg.Encode(JsonCodec{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		msgpackData, err := msg.Encode(MsgpackCodec{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(msgpackData) >= len(jsonData) {
+			t.Fatalf("Expected msgpack payload (%d bytes) to be smaller than JSON payload (%d bytes)", len(msgpackData), len(jsonData))
+		}
+	})
+}
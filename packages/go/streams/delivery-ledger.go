@@ -0,0 +1,73 @@
+package streams
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	DeliveryLedgerKey = "delivery-ledger"
+)
+
+type (
+	// DeliveryLedger remembers the block ranges that were successfully delivered to
+	// each webhook in a shard. If a webhook processor crashes after a request is sent
+	// but before the job is acknowledged, then the job will be processed again once
+	// it is claimed from the backlog. The ledger allows the processor to recognize
+	// that the range was already delivered and skip straight to acknowledging it.
+	//
+	// Each webhook gets a sorted set where the members are delivery IDs and the scores
+	// are the last block height of the delivered range. Only the most recent entries
+	// are kept since older ranges will never be retried.
+	DeliveryLedger struct {
+		client     *redis.ClusterClient
+		shardID    int32
+		maxEntries int64
+	}
+)
+
+func GetDeliveryLedgerKey(shardID int32, webhookID string) string {
+	return NamespaceJoin(ShardIdKey(shardID), DeliveryLedgerKey, webhookID)
+}
+
+func NewDeliveryLedger(client *redis.ClusterClient, shardID int32, maxEntries int64) *DeliveryLedger {
+	return &DeliveryLedger{
+		client:     client,
+		shardID:    shardID,
+		maxEntries: maxEntries,
+	}
+}
+
+// Checks if a delivery was already recorded in the ledger
+func (ledger *DeliveryLedger) Has(ctx context.Context, webhookID string, deliveryID string) (bool, error) {
+	err := ledger.client.ZScore(ctx, GetDeliveryLedgerKey(ledger.shardID, webhookID), deliveryID).Err()
+	if errors.Is(err, redis.Nil) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Records a successful delivery and evicts the oldest entries from the ledger
+func (ledger *DeliveryLedger) Record(ctx context.Context, webhookID string, deliveryID string, endHeight uint64) error {
+	key := GetDeliveryLedgerKey(ledger.shardID, webhookID)
+	_, err := ledger.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZAdd(ctx, key, redis.Z{Score: float64(endHeight), Member: deliveryID})
+		pipe.ZRemRangeByRank(ctx, key, 0, -(ledger.maxEntries + 1))
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record delivery \"%s\": %w", deliveryID, err)
+	}
+	return nil
+}
+
+// Removes every delivery that was recorded for a webhook
+func (ledger *DeliveryLedger) Clear(ctx context.Context, webhookID string) error {
+	return ledger.client.Del(ctx, GetDeliveryLedgerKey(ledger.shardID, webhookID)).Err()
+}
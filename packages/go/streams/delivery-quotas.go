@@ -0,0 +1,304 @@
+package streams
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	QuotaKey            = "quota"
+	QuotaScopeCustomer  = "customer"
+	QuotaScopeHost      = "host"
+	QuotaScopeBackfill  = "backfill"
+	QuotaRateLimitKey   = "rate-limit"
+	QuotaInFlightKey    = "in-flight"
+	InFlightRetryDelay  = time.Second
+	QuotaLeaseExtension = 10 * time.Second
+)
+
+type (
+	QuotaOpts struct {
+		// The number of deliveries per second that are allowed (0 means there is no limit)
+		RatePerSecond float64
+
+		// The number of deliveries that can be made in a burst before the rate limit kicks
+		// in (defaults to the rate limit rounded up)
+		Burst int64
+
+		// The number of deliveries that can be in progress at the same time (0 means there
+		// is no limit)
+		MaxInFlight int64
+	}
+
+	DeliveryQuotasOpts struct {
+		Customer QuotaOpts
+		Host     QuotaOpts
+
+		// Limits the backfill jobs of each shard (see AcquireBackfill)
+		Backfill QuotaOpts
+	}
+
+	// DeliveryQuotas limits how quickly and how many deliveries can be sent to a single
+	// customer or a single destination host. Each limit is a token bucket combined with
+	// a cap on the number of deliveries that are in progress. The limits are stored in
+	// redis so that they're shared by every processor on every shard.
+	//
+	// Deliveries that are in progress are tracked in a sorted set where the members are
+	// lease IDs and the scores are the times at which the leases expire. Leases are
+	// normally released once a delivery is done, but if a processor crashes before it
+	// can do so then the lease expires on its own and the slot is freed up.
+	DeliveryQuotas struct {
+		client *redis.ClusterClient
+		opts   *DeliveryQuotasOpts
+	}
+
+	// QuotaLease represents a delivery that was let through by the quotas - it must be
+	// released (or refunded) once the delivery is done
+	QuotaLease struct {
+		quotas *DeliveryQuotas
+		id     string
+		scopes []quotaScope
+	}
+
+	quotaScope struct {
+		name string
+		id   string
+		opts QuotaOpts
+	}
+)
+
+// NOTE: the keys for each scope share a hash tag so that a single script can check both
+// of the limits for the scope (keys for different scopes may live on different nodes).
+func GetQuotaKeys(scope string, id string) (rateLimitKey string, inFlightKey string) {
+	tag := fmt.Sprintf("{%s:%s}", scope, id)
+	return NamespaceJoin(QuotaKey, tag, QuotaRateLimitKey), NamespaceJoin(QuotaKey, tag, QuotaInFlightKey)
+}
+
+func NewDeliveryQuotas(client *redis.ClusterClient, opts *DeliveryQuotasOpts) *DeliveryQuotas {
+	return &DeliveryQuotas{
+		client: client,
+		opts:   opts,
+	}
+}
+
+// Tries to reserve a delivery for a customer and a host. If either of them is over its
+// quota, then a nil lease is returned along with how long the caller should wait before
+// trying again. The lease expires on its own once the given duration has passed.
+func (quotas *DeliveryQuotas) Acquire(
+	ctx context.Context,
+	customerID string,
+	host string,
+	now time.Time,
+	duration time.Duration,
+) (*QuotaLease, time.Duration, error) {
+	return quotas.acquireScopes(ctx, []quotaScope{
+		{name: QuotaScopeCustomer, id: customerID, opts: quotas.opts.Customer},
+		{name: QuotaScopeHost, id: host, opts: quotas.opts.Host},
+	}, now, duration)
+}
+
+// Tries to reserve a slot for a backfill job in the given shard. Backfill jobs share the
+// stream with real-time jobs, so this keeps them from taking up every consumer in the shard
+// while they catch up. If the shard is over its backfill quota, then a nil lease is returned
+// along with how long the caller should wait before trying again.
+func (quotas *DeliveryQuotas) AcquireBackfill(
+	ctx context.Context,
+	shardID int32,
+	now time.Time,
+	duration time.Duration,
+) (*QuotaLease, time.Duration, error) {
+	return quotas.acquireScopes(ctx, []quotaScope{
+		{name: QuotaScopeBackfill, id: strconv.FormatInt(int64(shardID), 10), opts: quotas.opts.Backfill},
+	}, now, duration)
+}
+
+func (quotas *DeliveryQuotas) acquireScopes(
+	ctx context.Context,
+	scopes []quotaScope,
+	now time.Time,
+	duration time.Duration,
+) (*QuotaLease, time.Duration, error) {
+	lease := &QuotaLease{quotas: quotas, id: uuid.NewString(), scopes: []quotaScope{}}
+
+	// Checks each scope in turn - if a scope is over its quota, then the scopes that
+	// were already reserved are released again
+	for _, scope := range scopes {
+		if scope.opts.RatePerSecond <= 0 && scope.opts.MaxInFlight <= 0 {
+			continue
+		}
+
+		delay, err := quotas.acquire(ctx, scope.name, scope.id, scope.opts, lease.id, now, duration)
+		if err != nil || delay > 0 {
+			if releaseErr := lease.Release(ctx); releaseErr != nil && err == nil {
+				err = releaseErr
+			}
+			if err != nil {
+				return nil, 0, err
+			}
+			return nil, delay, nil
+		}
+
+		lease.scopes = append(lease.scopes, scope)
+	}
+
+	return lease, 0, nil
+}
+
+func (quotas *DeliveryQuotas) acquire(
+	ctx context.Context,
+	scope string,
+	id string,
+	opts QuotaOpts,
+	leaseID string,
+	now time.Time,
+	duration time.Duration,
+) (time.Duration, error) {
+	// This script performs the following:
+	//
+	//  First, expired leases are removed from the in-flight set. If the number of
+	//  leases left is at the limit, then the caller has to wait for a slot to free
+	//  up. Since we can't know when that will be, a fixed delay is returned.
+	//
+	//  Next, the token bucket is refilled based on how much time has passed since it
+	//  was last updated. If there's less than one token left, then the caller has to
+	//  wait until the bucket has refilled enough to afford one.
+	//
+	//  Finally, a token is taken from the bucket and the lease is added to the in-flight
+	//  set. The script returns the number of milliseconds the caller should wait, where
+	//  0 means the delivery can go ahead.
+	//
+	script := redis.NewScript(`
+    local rate_limit_key = KEYS[1]
+    local in_flight_key = KEYS[2]
+    local now_ms = tonumber(ARGV[1])
+    local rate = tonumber(ARGV[2])
+    local burst = tonumber(ARGV[3])
+    local max_in_flight = tonumber(ARGV[4])
+    local lease_id = ARGV[5]
+    local lease_expires_at_ms = tonumber(ARGV[6])
+    local in_flight_retry_ms = tonumber(ARGV[7])
+
+    if max_in_flight > 0 then
+      redis.call("ZREMRANGEBYSCORE", in_flight_key, "-inf", now_ms)
+      if redis.call("ZCARD", in_flight_key) >= max_in_flight then
+        return in_flight_retry_ms
+      end
+    end
+
+    if rate > 0 then
+      local bucket = redis.call("HMGET", rate_limit_key, "tokens", "updated_at")
+      local tokens = tonumber(bucket[1]) or burst
+      local updated_at = tonumber(bucket[2]) or now_ms
+      tokens = math.min(burst, tokens + math.max(0, now_ms - updated_at) * rate / 1000)
+      if tokens < 1 then
+        return math.ceil((1 - tokens) * 1000 / rate)
+      end
+      redis.call("HSET", rate_limit_key, "tokens", tostring(tokens - 1), "updated_at", now_ms)
+      redis.call("PEXPIRE", rate_limit_key, math.ceil(burst * 1000 / rate))
+    end
+
+    if max_in_flight > 0 then
+      redis.call("ZADD", in_flight_key, lease_expires_at_ms, lease_id)
+      local last_lease = redis.call("ZRANGE", in_flight_key, -1, -1, "WITHSCORES")
+      redis.call("PEXPIREAT", in_flight_key, last_lease[2])
+    end
+
+    return 0
+  `)
+
+	// Executes the script
+	rateLimitKey, inFlightKey := GetQuotaKeys(scope, id)
+	delayMs, err := script.Run(ctx, quotas.client,
+		[]string{
+			rateLimitKey,
+			inFlightKey,
+		},
+		[]any{
+			now.UnixMilli(),
+			opts.RatePerSecond,
+			getBurst(opts),
+			opts.MaxInFlight,
+			leaseID,
+			now.Add(duration).UnixMilli(),
+			InFlightRetryDelay.Milliseconds(),
+		},
+	).Int64()
+	if err != nil {
+		return 0, err
+	}
+
+	// Returns how long the caller should wait (if at all)
+	return time.Duration(delayMs) * time.Millisecond, nil
+}
+
+// Frees up the in-flight slots that were reserved by the lease. Tokens that were taken
+// from the rate limits are not given back (see Refund).
+func (lease *QuotaLease) Release(ctx context.Context) error {
+	for _, scope := range lease.scopes {
+		_, inFlightKey := GetQuotaKeys(scope.name, scope.id)
+		if err := lease.quotas.client.ZRem(ctx, inFlightKey, lease.id).Err(); err != nil {
+			return err
+		}
+	}
+	lease.scopes = []quotaScope{}
+	return nil
+}
+
+// Frees up the in-flight slots that were reserved by the lease and gives back the tokens
+// that were taken from the rate limits. This should be used instead of Release when the
+// lease did not result in a delivery (e.g. the job was set aside or the delivery failed)
+// so that it doesn't count against the quotas.
+func (lease *QuotaLease) Refund(ctx context.Context) error {
+	// This script removes the lease from the in-flight set and puts a token back in the
+	// bucket (without going over the burst size). If the bucket has already expired, then
+	// it is full and there's nothing to give back.
+	script := redis.NewScript(`
+    local rate_limit_key = KEYS[1]
+    local in_flight_key = KEYS[2]
+    local lease_id = ARGV[1]
+    local burst = tonumber(ARGV[2])
+
+    redis.call("ZREM", in_flight_key, lease_id)
+
+    local tokens = tonumber(redis.call("HGET", rate_limit_key, "tokens"))
+    if tokens ~= nil then
+      redis.call("HSET", rate_limit_key, "tokens", tostring(math.min(burst, tokens + 1)))
+    end
+
+    return 0
+  `)
+
+	// Refunds each scope in turn
+	for _, scope := range lease.scopes {
+		rateLimitKey, inFlightKey := GetQuotaKeys(scope.name, scope.id)
+		if err := script.Run(ctx, lease.quotas.client,
+			[]string{
+				rateLimitKey,
+				inFlightKey,
+			},
+			[]any{
+				lease.id,
+				getBurst(scope.opts),
+			},
+		).Err(); err != nil {
+			return err
+		}
+	}
+
+	lease.scopes = []quotaScope{}
+	return nil
+}
+
+// Uses the rate limit as the burst size if none was provided
+func getBurst(opts QuotaOpts) int64 {
+	if opts.Burst > 0 {
+		return opts.Burst
+	}
+	return int64(math.Max(1, math.Ceil(opts.RatePerSecond)))
+}
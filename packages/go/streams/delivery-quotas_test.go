@@ -0,0 +1,53 @@
+package streams
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDeliveryQuotas(t *testing.T) {
+	// Defines helper variables
+	ctx := context.Background()
+	client := newTestRedisCluster(t)
+	quotas := NewDeliveryQuotas(client, &DeliveryQuotasOpts{
+		Customer: QuotaOpts{RatePerSecond: 0.001, Burst: 1, MaxInFlight: 1},
+	})
+
+	// Defines a helper function that tries to acquire the customer's only token
+	acquire := func(t *testing.T, customerID string, now time.Time) *QuotaLease {
+		lease, _, err := quotas.Acquire(ctx, customerID, "example.com", now, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return lease
+	}
+
+	t.Run("Release keeps the token", func(t *testing.T) {
+		now := time.Now()
+		lease := acquire(t, "customer-1", now)
+		if lease == nil {
+			t.Fatal("Expected the first delivery to be let through")
+		}
+		if err := lease.Release(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if lease := acquire(t, "customer-1", now); lease != nil {
+			t.Fatal("Expected a released lease to count against the rate limit")
+		}
+	})
+
+	t.Run("Refund gives back the token and the in-flight slot", func(t *testing.T) {
+		now := time.Now()
+		lease := acquire(t, "customer-2", now)
+		if lease == nil {
+			t.Fatal("Expected the first delivery to be let through")
+		}
+		if err := lease.Refund(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if lease := acquire(t, "customer-2", now); lease == nil {
+			t.Fatal("Expected a refunded lease not to count against the quotas")
+		}
+	})
+}
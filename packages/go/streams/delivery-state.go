@@ -0,0 +1,82 @@
+package streams
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	DeliveryStateKey = "delivery-state"
+
+	// The delivery is about to be sent - the receiver may or may not have received it
+	DeliveryPrepared DeliveryState = "prepared"
+
+	// The receiver responded to the delivery but did not confirm it
+	DeliverySent DeliveryState = "sent"
+
+	// The receiver confirmed the delivery
+	DeliveryConfirmed DeliveryState = "confirmed"
+)
+
+type (
+	DeliveryState string
+
+	// DeliveryStates tracks the delivery that is in progress for each webhook in a shard
+	// whose receiver confirms deliveries (see deliverytarget.IConfirmingTarget). A delivery
+	// is prepared before it is sent and confirmed before its job is acknowledged, so if a
+	// processor crashes in between, then the processor that handles the job next knows that
+	// the receiver may have already received it and can ask the receiver before resending.
+	//
+	// Jobs of the same webhook are never handled at the same time (see WebhookLease), so
+	// each webhook only needs a hash holding the ID and the state of its latest delivery.
+	DeliveryStates struct {
+		client  *redis.ClusterClient
+		shardID int32
+	}
+)
+
+func GetDeliveryStateKey(shardID int32, webhookID string) string {
+	return NamespaceJoin(ShardIdKey(shardID), DeliveryStateKey, webhookID)
+}
+
+func NewDeliveryStates(client *redis.ClusterClient, shardID int32) *DeliveryStates {
+	return &DeliveryStates{
+		client:  client,
+		shardID: shardID,
+	}
+}
+
+// Gets the state of a delivery - an empty state is returned if the delivery is not the
+// latest delivery of the webhook
+func (states *DeliveryStates) Get(ctx context.Context, webhookID string, deliveryID string) (DeliveryState, error) {
+	values, err := states.client.HMGet(ctx, GetDeliveryStateKey(states.shardID, webhookID), "id", "state").Result()
+	if errors.Is(err, redis.Nil) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if id, ok := values[0].(string); !ok || id != deliveryID {
+		return "", nil
+	}
+	if state, ok := values[1].(string); ok {
+		return DeliveryState(state), nil
+	}
+	return "", nil
+}
+
+// Moves a delivery into the given state
+func (states *DeliveryStates) Set(ctx context.Context, webhookID string, deliveryID string, state DeliveryState) error {
+	if err := states.client.HSet(ctx, GetDeliveryStateKey(states.shardID, webhookID), "id", deliveryID, "state", string(state)).Err(); err != nil {
+		return fmt.Errorf("failed to move delivery \"%s\" to state \"%s\": %w", deliveryID, state, err)
+	}
+	return nil
+}
+
+// Removes the delivery state of a webhook
+func (states *DeliveryStates) Clear(ctx context.Context, webhookID string) error {
+	return states.client.Del(ctx, GetDeliveryStateKey(states.shardID, webhookID)).Err()
+}
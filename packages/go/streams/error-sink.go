@@ -0,0 +1,86 @@
+package streams
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	ErrorSinkKey = "errors"
+)
+
+type (
+	ErrorRecord struct {
+		Timestamp   time.Time `json:"timestamp"`
+		Kind        string    `json:"kind"`
+		Error       string    `json:"error"`
+		MsgID       string    `json:"msgId"`
+		BlockHeight uint64    `json:"blockHeight"`
+	}
+
+	// ErrorSink stores the most recent errors that occurred while delivering
+	// blocks to a webhook so that they can be shown to the webhook's owner
+	ErrorSink interface {
+		// Stores an error for the webhook
+		Push(ctx context.Context, webhookID string, record ErrorRecord) error
+
+		// Lists the errors that were stored for the webhook from newest to oldest
+		List(ctx context.Context, webhookID string) ([]ErrorRecord, error)
+	}
+
+	// RedisErrorSink keeps the last N errors of each webhook in a capped redis list
+	RedisErrorSink struct {
+		client    redis.Cmdable
+		maxErrors int64
+	}
+)
+
+func GetErrorSinkKey(webhookID string) string {
+	return NamespaceJoin(ErrorSinkKey, webhookID)
+}
+
+func NewRedisErrorSink(client redis.Cmdable, maxErrors int64) *RedisErrorSink {
+	return &RedisErrorSink{
+		client:    client,
+		maxErrors: maxErrors,
+	}
+}
+
+func (sink *RedisErrorSink) Push(ctx context.Context, webhookID string, record ErrorRecord) error {
+	// JSON encodes the record
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	// Prepends the record to the list then evicts the oldest records
+	key := GetErrorSinkKey(webhookID)
+	_, err = sink.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.LPush(ctx, key, data)
+		pipe.LTrim(ctx, key, 0, sink.maxErrors-1)
+		return nil
+	})
+	return err
+}
+
+func (sink *RedisErrorSink) List(ctx context.Context, webhookID string) ([]ErrorRecord, error) {
+	// Gets the raw records
+	rawRecords, err := sink.client.LRange(ctx, GetErrorSinkKey(webhookID), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	// Parses the records
+	records := make([]ErrorRecord, len(rawRecords))
+	for i, rawRecord := range rawRecords {
+		if err := json.Unmarshal([]byte(rawRecord), &records[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	// Returns the records
+	return records, nil
+}
@@ -0,0 +1,76 @@
+package streams
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Handlers passed to Subscribe can classify the errors they return so that the
+// stream knows what to do with the messages that failed:
+//
+//   - Retryable errors leave the messages in the pending entries list, which means
+//     they'll be redelivered as backlog messages. Errors that were not classified
+//     are treated as retryable.
+//
+//   - Permanent errors mean that the messages will never be processed successfully.
+//     They are moved to a dead letter stream (see GetDeadLetterStreamKey) where they
+//     can be inspected later, then they're acknowledged and deleted from the stream.
+//
+//   - Poison errors mean that the messages are malformed or otherwise worthless. They
+//     are acknowledged and deleted from the stream without being stored anywhere.
+const (
+	ErrorKindRetryable ErrorKind = iota
+	ErrorKindPermanent
+	ErrorKindPoison
+)
+
+type (
+	ErrorKind int
+
+	StreamError struct {
+		Kind ErrorKind
+		Err  error
+	}
+)
+
+func NewRetryableError(err error) error {
+	return &StreamError{Kind: ErrorKindRetryable, Err: err}
+}
+
+func NewPermanentError(err error) error {
+	return &StreamError{Kind: ErrorKindPermanent, Err: err}
+}
+
+func NewPoisonError(err error) error {
+	return &StreamError{Kind: ErrorKindPoison, Err: err}
+}
+
+// Gets the kind of an error - errors that were not classified are retryable
+func GetErrorKind(err error) ErrorKind {
+	var streamErr *StreamError
+	if errors.As(err, &streamErr) {
+		return streamErr.Kind
+	}
+	return ErrorKindRetryable
+}
+
+func (kind ErrorKind) String() string {
+	switch kind {
+	case ErrorKindRetryable:
+		return "retryable"
+	case ErrorKindPermanent:
+		return "permanent"
+	case ErrorKindPoison:
+		return "poison"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(kind))
+	}
+}
+
+func (err *StreamError) Error() string {
+	return fmt.Sprintf("%s error: %v", err.Kind, err.Err)
+}
+
+func (err *StreamError) Unwrap() error {
+	return err.Err
+}
@@ -0,0 +1,367 @@
+package streams
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chris-de-leon/block-feed-prototype/common"
+
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// NOTE: some important things to be aware of here:
+//
+//   - Each chain gets its own topic with exactly one partition. Kafka only guarantees
+//     ordering within a partition, and the block router expects to receive blocks in
+//     the same order that the block forwarder published them. Every record is also keyed
+//     by the chain ID so that ordering is preserved even if the topic was created ahead
+//     of time with more than one partition.
+//
+//   - Offsets are never committed automatically. The block router calls Ack once the
+//     blocks have been stored and the webhook streams have been flushed, and only then
+//     are the offsets committed to the consumer group. If the router crashes before it
+//     calls Ack, then the uncommitted records will be redelivered when it restarts.
+//
+//   - Kafka does not have an equivalent of the redis pending entries list. If the handler
+//     returns an error, the same batch is handed back to the handler (with isBacklogMsg set
+//     to true) until it is processed successfully or the context is cancelled. There is
+//     no dead letter topic, so batches that fail with a permanent or poison error (see
+//     errors.go) are committed and skipped. Records that can't be parsed are logged and
+//     skipped as well - they're committed along with the records that come after them,
+//     or right away if none of the polled records could be parsed.
+//
+//   - Failed fetches and failed batches are retried with an exponential backoff (starting
+//     at RetryMinMs and capped at RetryMaxMs) so that the consumer doesn't spin while the
+//     broker or a downstream dependency is unavailable.
+//
+//   - Records carry the name of the codec that was used to encode them in a record header
+//     (see codec.go). Records without the header are always JSON encoded.
+const (
+	KafkaTopicSeparator = "."
+)
+
+type (
+	KafkaBlockStreamOpts struct {
+		Codec      string
+		RetryMinMs int
+		RetryMaxMs int
+	}
+
+	KafkaBlockStream struct {
+		client    *kgo.Client
+		opts      *KafkaBlockStreamOpts
+		logger    *log.Logger
+		topic     string
+		chain     string
+		pending   map[string]*kgo.Record
+		pendingMu sync.Mutex
+		topicMu   sync.Mutex
+		hasTopic  bool
+	}
+)
+
+func GetKafkaBlockStreamTopic(chain string) string {
+	return strings.Join([]string{Namespace, BlockStreamName, chain}, KafkaTopicSeparator)
+}
+
+// Returns the client options that a block stream consumer needs - these should
+// be passed to kgo.NewClient along with the seed brokers
+func KafkaBlockStreamConsumerOpts(chain string) []kgo.Opt {
+	return []kgo.Opt{
+		kgo.ConsumerGroup(BlockStreamConsumerGroupName),
+		kgo.ConsumeTopics(GetKafkaBlockStreamTopic(chain)),
+		kgo.DisableAutoCommit(),
+		kgo.BlockRebalanceOnPoll(),
+	}
+}
+
+func NewKafkaBlockStream(client *kgo.Client, chain string, opts *KafkaBlockStreamOpts) *KafkaBlockStream {
+	options := &KafkaBlockStreamOpts{}
+	if opts != nil {
+		*options = *opts
+	}
+
+	if options.RetryMinMs <= 0 {
+		options.RetryMinMs = 100
+	}
+
+	if options.RetryMaxMs < options.RetryMinMs {
+		options.RetryMaxMs = max(10000, options.RetryMinMs)
+	}
+
+	topic := GetKafkaBlockStreamTopic(chain)
+	return &KafkaBlockStream{
+		logger:  log.New(os.Stdout, fmt.Sprintf("[%s] ", topic), log.LstdFlags),
+		client:  client,
+		opts:    options,
+		topic:   topic,
+		chain:   chain,
+		pending: map[string]*kgo.Record{},
+	}
+}
+
+func (stream *KafkaBlockStream) Chain() string {
+	return stream.chain
+}
+
+func (stream *KafkaBlockStream) Topic() string {
+	return stream.topic
+}
+
+func (stream *KafkaBlockStream) Publish(ctx context.Context, msg *StreamMessage[BlockStreamMsgData]) error {
+	// Makes sure the topic exists before writing to it
+	if err := stream.ensureTopic(ctx); err != nil {
+		return err
+	}
+
+	// Encodes the data using the configured codec
+	codec, err := GetCodec(stream.opts.Codec)
+	if err != nil {
+		return err
+	}
+	data, err := msg.Encode(codec)
+	if err != nil {
+		return err
+	}
+
+	// Synchronously writes the record to the topic
+	return stream.client.ProduceSync(ctx, &kgo.Record{
+		Topic:   stream.topic,
+		Key:     []byte(stream.chain),
+		Value:   data,
+		Headers: []kgo.RecordHeader{{Key: CodecField, Value: []byte(codec.Name())}},
+	}).FirstErr()
+}
+
+func (stream *KafkaBlockStream) Ack(ctx context.Context, msgIDs []string) error {
+	// Collects the records that correspond to the input message IDs
+	stream.pendingMu.Lock()
+	records := make([]*kgo.Record, 0, len(msgIDs))
+	for _, msgID := range msgIDs {
+		if record, exists := stream.pending[msgID]; exists {
+			records = append(records, record)
+		}
+	}
+	stream.pendingMu.Unlock()
+
+	// Exits early if there's nothing to commit
+	if len(records) == 0 {
+		return nil
+	}
+
+	// Commits the offsets of the records to the consumer group
+	if err := stream.client.CommitRecords(ctx, records...); err != nil {
+		return err
+	}
+
+	// Forgets about the committed records
+	stream.pendingMu.Lock()
+	for _, msgID := range msgIDs {
+		delete(stream.pending, msgID)
+	}
+	stream.pendingMu.Unlock()
+
+	// Returns nil if no errors occurred
+	return nil
+}
+
+func (stream *KafkaBlockStream) Subscribe(
+	ctx context.Context,
+	consumerName string,
+	concurrency int,
+	batchSize int64,
+	handler func(
+		ctx context.Context,
+		msgs []ParsedStreamMessage[BlockStreamMsgData],
+		isBacklogMsg bool,
+		metadata SubscribeMetadata,
+	) error,
+) error {
+	// Records within a partition must be processed in order by one consumer
+	if concurrency != 1 {
+		return fmt.Errorf("kafka block stream only supports a concurrency of 1 but got %d", concurrency)
+	}
+
+	// Creates the topic if one doesn't already exist
+	if err := stream.ensureTopic(ctx); err != nil {
+		return err
+	} else {
+		stream.logger.Printf("Consumer group \"%s\" is ready on topic \"%s\"\n", BlockStreamConsumerGroupName, stream.topic)
+	}
+
+	// Continuously processes records from the topic until the context resolves
+	// or a non-recoverable error occurs - failed fetches are retried with a backoff
+	for failures := 0; ; {
+		select {
+		case <-ctx.Done():
+			return nil
+		default:
+			var streamErr *StreamError
+			if err := stream.processNewRecords(ctx, consumerName, batchSize, handler); errors.As(err, &streamErr) && streamErr.Kind == ErrorKindRetryable {
+				common.LogError(stream.logger, err)
+				if err := sleep(ctx, stream.retryDelay(failures)); err != nil {
+					return nil
+				}
+				failures += 1
+			} else if err != nil && ctx.Err() != nil {
+				return nil
+			} else if err != nil {
+				return err
+			} else {
+				failures = 0
+			}
+		}
+	}
+}
+
+// Gets how long to wait before the next retry - the delay doubles with each consecutive
+// failure until it reaches RetryMaxMs
+func (stream *KafkaBlockStream) retryDelay(failures int) time.Duration {
+	delayMs := stream.opts.RetryMaxMs
+	if failures < 32 {
+		delayMs = min(stream.opts.RetryMinMs<<failures, stream.opts.RetryMaxMs)
+	}
+	return time.Duration(delayMs) * time.Millisecond
+}
+
+func (stream *KafkaBlockStream) processNewRecords(
+	ctx context.Context,
+	consumerName string,
+	count int64,
+	handler func(
+		ctx context.Context,
+		msgs []ParsedStreamMessage[BlockStreamMsgData],
+		isBacklogMsg bool,
+		metadata SubscribeMetadata,
+	) error,
+) error {
+	// Rebalances are blocked from the time records are polled until we're done
+	// processing them so that partitions aren't revoked in the middle of a batch
+	defer stream.client.AllowRebalance()
+
+	// Blocks until new records are ready - a closed client can't be polled again, so
+	// this is reported as a terminal error instead of letting the caller spin
+	fetches := stream.client.PollRecords(ctx, int(count))
+	if fetches.IsClientClosed() {
+		return kgo.ErrClientClosed
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// Gets the records from the poll result - fetch errors are retried by the caller
+	// unless some records were still received
+	records := fetches.Records()
+	if err := fetches.Err(); err != nil && len(records) == 0 {
+		return NewRetryableError(err)
+	} else if err != nil {
+		common.LogError(stream.logger, err)
+	}
+	if len(records) == 0 {
+		return nil
+	} else {
+		stream.logger.Printf("Successfully received %d record(s)", len(records))
+	}
+
+	// Parses the record(s) and keeps track of them until they're acknowledged - records
+	// that can't be parsed will never succeed, so they're skipped instead of stopping the
+	// consumer on every restart
+	parsedMsgs := make([]ParsedStreamMessage[BlockStreamMsgData], 0, len(records))
+	msgIDs := make([]string, 0, len(records))
+	stream.pendingMu.Lock()
+	for _, record := range records {
+		msgID := fmt.Sprintf("%d-%d", record.Partition, record.Offset)
+		data, err := parseRecord[BlockStreamMsgData](record)
+		if err != nil {
+			common.LogError(stream.logger, fmt.Errorf("skipping record \"%s\" that could not be parsed: %w", msgID, err))
+			continue
+		}
+
+		stream.pending[msgID] = record
+		msgIDs = append(msgIDs, msgID)
+		parsedMsgs = append(parsedMsgs, ParsedStreamMessage[BlockStreamMsgData]{
+			ID:   msgID,
+			Data: *data,
+		})
+	}
+	stream.pendingMu.Unlock()
+
+	// If none of the records could be parsed, then they're committed right away since
+	// there's no acknowledgement that would commit them later
+	if len(parsedMsgs) == 0 {
+		return stream.client.CommitRecords(ctx, records...)
+	}
+
+	// Processes the record(s) - if an error occurs then the same batch is retried
+	// (after a backoff) so that no blocks are skipped
+	isBacklogMsg := false
+	for failures := 0; ; failures++ {
+		if err := handler(ctx, parsedMsgs, isBacklogMsg, SubscribeMetadata{
+			ConsumerName: consumerName,
+			Logger:       stream.logger,
+		}); err != nil {
+			common.LogError(stream.logger, err)
+			isBacklogMsg = true
+			if GetErrorKind(err) != ErrorKindRetryable {
+				return stream.Ack(ctx, msgIDs)
+			}
+		} else {
+			stream.logger.Printf("Successfully processed %d record(s)", len(parsedMsgs))
+			return nil
+		}
+
+		if err := sleep(ctx, stream.retryDelay(failures)); err != nil {
+			return err
+		}
+	}
+}
+
+func (stream *KafkaBlockStream) ensureTopic(ctx context.Context) error {
+	stream.topicMu.Lock()
+	defer stream.topicMu.Unlock()
+
+	// Exits early if we've already confirmed that the topic exists
+	if stream.hasTopic {
+		return nil
+	}
+
+	// Creates the topic (using the broker's default replication factor)
+	_, err := kadm.NewClient(stream.client).CreateTopic(ctx, 1, -1, nil, stream.topic)
+	if err != nil && !errors.Is(err, kerr.TopicAlreadyExists) {
+		return err
+	}
+
+	// Caches the result so that we don't need to issue the request again
+	stream.hasTopic = true
+	return nil
+}
+
+func parseRecord[T any](record *kgo.Record) (*T, error) {
+	// Records without a codec header are always JSON encoded
+	codecName := ""
+	for _, header := range record.Headers {
+		if header.Key == CodecField {
+			codecName = string(header.Value)
+		}
+	}
+
+	codec, err := GetCodec(codecName)
+	if err != nil {
+		return nil, err
+	}
+
+	var parsedMsg T
+	if err := codec.Unmarshal(record.Value, &parsedMsg); err != nil {
+		return nil, err
+	}
+
+	return &parsedMsg, nil
+}
@@ -0,0 +1,231 @@
+package streams
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/chris-de-leon/block-feed-prototype/testutils/containers"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+func TestKafkaBlockStream(t *testing.T) {
+	// Defines helper variables
+	const chainID = "dummy-chain"
+	const numBlocks = 10
+	ctx := context.Background()
+
+	// Starts a container
+	container, err := containers.NewRedpandaContainer(ctx, t)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Creates a producer client
+	producer, err := kgo.NewClient(kgo.SeedBrokers(container.Conn.Url))
+	if err != nil {
+		t.Fatal(err)
+	} else {
+		t.Cleanup(producer.Close)
+	}
+
+	// Creates a block stream for the producer
+	producerStream := NewKafkaBlockStream(producer, chainID, &KafkaBlockStreamOpts{Codec: CodecMsgpack})
+
+	// Publishes some fake blocks
+	t.Run("Publish Blocks", func(t *testing.T) {
+		for i := range numBlocks {
+			if err := producerStream.Publish(ctx, NewBlockStreamMsg(uint64(i), []byte{})); err != nil {
+				t.Fatal(err)
+			}
+		}
+	})
+
+	// Consumes the blocks, fails the first batch once, and checks that all blocks arrive in order
+	t.Run("Subscribe (ordered + at least once)", func(t *testing.T) {
+		consumer, err := kgo.NewClient(append(KafkaBlockStreamConsumerOpts(chainID), kgo.SeedBrokers(container.Conn.Url))...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer consumer.Close()
+
+		timeoutCtx, cancel := context.WithTimeout(ctx, time.Duration(30)*time.Second)
+		defer cancel()
+
+		consumerStream := NewKafkaBlockStream(consumer, chainID, nil)
+		heights := []uint64{}
+		failed := false
+		if err := consumerStream.Subscribe(timeoutCtx, "test", 1, 3, func(
+			ctx context.Context,
+			msgs []ParsedStreamMessage[BlockStreamMsgData],
+			isBacklogMsg bool,
+			metadata SubscribeMetadata,
+		) error {
+			if !failed {
+				failed = true
+				return errors.New("simulated failure")
+			}
+
+			msgIDs := make([]string, len(msgs))
+			for i, msg := range msgs {
+				heights = append(heights, msg.Data.Height)
+				msgIDs[i] = msg.ID
+			}
+
+			if err := consumerStream.Ack(ctx, msgIDs); err != nil {
+				return err
+			}
+
+			if len(heights) == numBlocks {
+				cancel()
+			}
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(heights) != numBlocks {
+			t.Fatalf("Expected %d blocks but received %d", numBlocks, len(heights))
+		}
+		for i, height := range heights {
+			if height != uint64(i) {
+				t.Fatalf("Expected blocks to be received in order but got: %v", heights)
+			}
+		}
+	})
+
+	// Checks that the committed offsets are respected by a new consumer
+	t.Run("Subscribe (committed offsets)", func(t *testing.T) {
+		if err := producerStream.Publish(ctx, NewBlockStreamMsg(numBlocks, []byte{})); err != nil {
+			t.Fatal(err)
+		}
+
+		consumer, err := kgo.NewClient(append(KafkaBlockStreamConsumerOpts(chainID), kgo.SeedBrokers(container.Conn.Url))...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer consumer.Close()
+
+		timeoutCtx, cancel := context.WithTimeout(ctx, time.Duration(30)*time.Second)
+		defer cancel()
+
+		consumerStream := NewKafkaBlockStream(consumer, chainID, nil)
+		heights := []uint64{}
+		if err := consumerStream.Subscribe(timeoutCtx, "test", 1, 100, func(
+			ctx context.Context,
+			msgs []ParsedStreamMessage[BlockStreamMsgData],
+			isBacklogMsg bool,
+			metadata SubscribeMetadata,
+		) error {
+			for _, msg := range msgs {
+				heights = append(heights, msg.Data.Height)
+			}
+			cancel()
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(heights) != 1 || heights[0] != numBlocks {
+			t.Fatalf("Expected only block %d to be redelivered but got: %v", numBlocks, heights)
+		}
+	})
+
+	// Checks that records which can't be parsed are skipped instead of stopping the consumer
+	t.Run("Subscribe (malformed record)", func(t *testing.T) {
+		const malformedChainID = "malformed-chain"
+		malformedStream := NewKafkaBlockStream(producer, malformedChainID, nil)
+		if err := malformedStream.Publish(ctx, NewBlockStreamMsg(0, []byte{})); err != nil {
+			t.Fatal(err)
+		}
+		if err := producer.ProduceSync(ctx, &kgo.Record{
+			Topic: malformedStream.Topic(),
+			Key:   []byte(malformedChainID),
+			Value: []byte("not a block"),
+		}).FirstErr(); err != nil {
+			t.Fatal(err)
+		}
+		if err := malformedStream.Publish(ctx, NewBlockStreamMsg(1, []byte{})); err != nil {
+			t.Fatal(err)
+		}
+
+		consumer, err := kgo.NewClient(append(KafkaBlockStreamConsumerOpts(malformedChainID), kgo.SeedBrokers(container.Conn.Url))...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer consumer.Close()
+
+		timeoutCtx, cancel := context.WithTimeout(ctx, time.Duration(30)*time.Second)
+		defer cancel()
+
+		// Polls one record at a time so that the malformed record makes up a batch on its own
+		consumerStream := NewKafkaBlockStream(consumer, malformedChainID, nil)
+		heights := []uint64{}
+		if err := consumerStream.Subscribe(timeoutCtx, "test", 1, 1, func(
+			ctx context.Context,
+			msgs []ParsedStreamMessage[BlockStreamMsgData],
+			isBacklogMsg bool,
+			metadata SubscribeMetadata,
+		) error {
+			msgIDs := make([]string, len(msgs))
+			for i, msg := range msgs {
+				heights = append(heights, msg.Data.Height)
+				msgIDs[i] = msg.ID
+			}
+			if err := consumerStream.Ack(ctx, msgIDs); err != nil {
+				return err
+			}
+			if len(heights) == 2 {
+				cancel()
+			}
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(heights) != 2 || heights[0] != 0 || heights[1] != 1 {
+			t.Fatalf("Expected blocks 0 and 1 but got: %v", heights)
+		}
+	})
+
+	// Checks that a closed client stops the consumer instead of being polled in a loop
+	t.Run("Subscribe (closed client)", func(t *testing.T) {
+		consumer, err := kgo.NewClient(append(KafkaBlockStreamConsumerOpts(chainID), kgo.SeedBrokers(container.Conn.Url))...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		consumerStream := NewKafkaBlockStream(consumer, chainID, nil)
+		if err := consumerStream.ensureTopic(ctx); err != nil {
+			t.Fatal(err)
+		}
+		consumer.Close()
+
+		timeoutCtx, cancel := context.WithTimeout(ctx, time.Duration(30)*time.Second)
+		defer cancel()
+
+		if err := consumerStream.Subscribe(timeoutCtx, "test", 1, 1, func(
+			ctx context.Context,
+			msgs []ParsedStreamMessage[BlockStreamMsgData],
+			isBacklogMsg bool,
+			metadata SubscribeMetadata,
+		) error {
+			return nil
+		}); !errors.Is(err, kgo.ErrClientClosed) {
+			t.Fatalf("Expected kgo.ErrClientClosed but got: %v", err)
+		}
+	})
+}
+
+func TestKafkaBlockStreamRetryDelay(t *testing.T) {
+	stream := NewKafkaBlockStream(nil, "dummy-chain", &KafkaBlockStreamOpts{RetryMinMs: 100, RetryMaxMs: 1000})
+	for failures, expected := range []time.Duration{100, 200, 400, 800, 1000, 1000} {
+		if delay := stream.retryDelay(failures); delay != expected*time.Millisecond {
+			t.Fatalf("Expected a delay of %dms after %d failure(s) but got %v", expected, failures, delay)
+		}
+	}
+	if delay := stream.retryDelay(100); delay != time.Second {
+		t.Fatalf("Expected the delay to be capped but got %v", delay)
+	}
+}
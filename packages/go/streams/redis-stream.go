@@ -7,6 +7,7 @@ import (
 	"log"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/chris-de-leon/block-feed-prototype/common"
 
@@ -14,25 +15,89 @@ import (
 	"golang.org/x/sync/errgroup"
 )
 
+const (
+	// Entries are never trimmed from the stream
+	TrimStrategyNone = ""
+
+	// The stream is capped at a fixed number of entries - the oldest entries are
+	// evicted even if they have not been processed yet
+	TrimStrategyMaxLen = "maxlen"
+
+	// Entries are evicted once the consumer group has acknowledged them - entries
+	// that have not been delivered or are still pending are never evicted
+	TrimStrategyMinID = "minid"
+
+	// XADD blocks until the stream length falls below the backpressure threshold
+	BackpressureModePause = "pause"
+
+	// XADD sleeps longer the further the stream length is above the backpressure
+	// threshold, but never blocks indefinitely
+	BackpressureModeSlow = "slow"
+
+	// Dead letter streams are capped (approximately) at this many entries
+	DeadLetterStreamKey    = "dead-letter"
+	DeadLetterStreamMaxLen = 10000
+)
+
 type (
+	RedisStreamOpts struct {
+		TrimStrategy          string
+		TrimMaxLen            int64
+		TrimApprox            bool
+		BackpressureThreshold int64
+		BackpressureMode      string
+		BackpressurePollMs    int
+		Codec                 string
+	}
+
 	RedisStream[T any] struct {
 		client            Streamable
 		logger            *log.Logger
 		name              string
 		consumerGroupName string
+		opts              *RedisStreamOpts
+
+		// Called after messages are dropped from the stream because of a permanent
+		// or poison error (only the messages that could be parsed are passed in)
+		onDrop func(ctx context.Context, msgs []ParsedStreamMessage[T]) error
 	}
 )
 
+// Dead letter streams live next to the stream they belong to so that they hash
+// to the same slot when the stream name contains a hash tag
+func GetDeadLetterStreamKey(name string) string {
+	return strings.Join([]string{name, DeadLetterStreamKey}, Separator)
+}
+
 func NewRedisStream[T any](
 	client Streamable,
 	name string,
 	consumerGroupName string,
+	opts *RedisStreamOpts,
 ) *RedisStream[T] {
+	options := &RedisStreamOpts{}
+	if opts != nil {
+		*options = *opts
+	}
+
+	if options.TrimStrategy == TrimStrategyMaxLen && options.TrimMaxLen <= 0 {
+		options.TrimStrategy = TrimStrategyNone
+	}
+
+	if options.BackpressureMode == "" {
+		options.BackpressureMode = BackpressureModePause
+	}
+
+	if options.BackpressurePollMs <= 0 {
+		options.BackpressurePollMs = 100
+	}
+
 	return &RedisStream[T]{
 		logger:            log.New(os.Stdout, fmt.Sprintf("[%s] ", name), log.LstdFlags),
 		client:            client,
 		name:              name,
 		consumerGroupName: consumerGroupName,
+		opts:              options,
 	}
 }
 
@@ -44,19 +109,175 @@ func (stream *RedisStream[T]) ConsumerGroupName() string {
 	return stream.consumerGroupName
 }
 
+func (stream *RedisStream[T]) DeadLetterStreamName() string {
+	return GetDeadLetterStreamKey(stream.name)
+}
+
 func (stream *RedisStream[T]) XAdd(ctx context.Context, msg *StreamMessage[T]) error {
-	// JSON encodes the data
-	data, err := msg.MarshalBinary()
+	// Encodes the data using the configured codec
+	codec, err := GetCodec(stream.opts.Codec)
+	if err != nil {
+		return err
+	}
+	data, err := msg.Encode(codec)
 	if err != nil {
 		return err
 	}
 
-	// Adds the data to the stream
-	return stream.client.XAdd(ctx, &redis.XAddArgs{
+	// Waits for the consumers to catch up if the stream is too large
+	if err := stream.applyBackpressure(ctx); err != nil {
+		return err
+	}
+
+	// Prepares the XADD arguments - if the stream is capped at a fixed length,
+	// then redis can trim the stream as part of the XADD command
+	args := &redis.XAddArgs{
 		ID:     "*",
 		Stream: stream.name,
-		Values: map[string]any{GetDataField(): data},
-	}).Err()
+		Values: map[string]any{GetDataField(): data, CodecField: codec.Name()},
+	}
+	if stream.opts.TrimStrategy == TrimStrategyMaxLen {
+		args.MaxLen = stream.opts.TrimMaxLen
+		args.Approx = stream.opts.TrimApprox
+	}
+
+	// Adds the data to the stream
+	if err := stream.client.XAdd(ctx, args).Err(); err != nil {
+		return err
+	}
+
+	// Trims any entries that the consumer group has already acknowledged
+	if stream.opts.TrimStrategy == TrimStrategyMinID {
+		return stream.Trim(ctx)
+	}
+
+	// Returns nil if no errors occurred
+	return nil
+}
+
+// Trims the stream according to the trimming strategy that the stream was configured
+// with. This is called automatically by XAdd, but streams that are written to by lua
+// scripts must call it explicitly.
+func (stream *RedisStream[T]) Trim(ctx context.Context) error {
+	// This script performs the following:
+	//
+	//  If the stream is capped at a fixed length, then the stream is trimmed
+	//  to that length.
+	//
+	//  If the stream is trimmed by ID, then we look up the last ID that was
+	//  delivered to the consumer group as well as the smallest ID that has
+	//  been delivered but not acknowledged yet. Every entry with an ID that
+	//  is smaller than both of these has been acknowledged and can be safely
+	//  evicted. If the consumer group does not exist yet, then none of the
+	//  entries have been read and nothing is trimmed.
+	//
+	script := redis.NewScript(`
+    local stream_key = KEYS[1]
+    local consumer_group_name = ARGV[1]
+    local strategy = ARGV[2]
+    local max_len = ARGV[3]
+    local approx = ARGV[4] == "1"
+
+    local function xtrim(kind, threshold)
+      if approx then
+        return redis.call("XTRIM", stream_key, kind, "~", threshold)
+      else
+        return redis.call("XTRIM", stream_key, kind, threshold)
+      end
+    end
+
+    if strategy == "` + TrimStrategyMaxLen + `" then
+      return xtrim("MAXLEN", max_len)
+    end
+
+    local groups = redis.pcall("XINFO", "GROUPS", stream_key)
+    if type(groups) ~= "table" or groups.err ~= nil then
+      return 0
+    end
+
+    local last_delivered_id = nil
+    for _, group in ipairs(groups) do
+      local name = nil
+      local last_id = nil
+      for i = 1, #group, 2 do
+        if group[i] == "name" then name = group[i + 1] end
+        if group[i] == "last-delivered-id" then last_id = group[i + 1] end
+      end
+      if name == consumer_group_name then
+        last_delivered_id = last_id
+      end
+    end
+
+    if last_delivered_id == nil then
+      return 0
+    end
+
+    local pending = redis.call("XPENDING", stream_key, consumer_group_name)
+    if tonumber(pending[1]) > 0 then
+      return xtrim("MINID", pending[2])
+    else
+      return xtrim("MINID", last_delivered_id)
+    end
+  `)
+
+	// Exits early if the stream should not be trimmed
+	if stream.opts.TrimStrategy == TrimStrategyNone {
+		return nil
+	}
+
+	// Executes the script
+	approx := 0
+	if stream.opts.TrimApprox {
+		approx = 1
+	}
+	if err := script.Run(ctx, stream.client,
+		[]string{stream.name},
+		[]any{
+			stream.consumerGroupName,
+			stream.opts.TrimStrategy,
+			stream.opts.TrimMaxLen,
+			approx,
+		},
+	).Err(); err != nil && !errors.Is(err, redis.Nil) {
+		return err
+	} else {
+		return nil
+	}
+}
+
+func (stream *RedisStream[T]) applyBackpressure(ctx context.Context) error {
+	// Exits early if backpressure is disabled
+	if stream.opts.BackpressureThreshold <= 0 {
+		return nil
+	}
+
+	// Checks the stream length until it falls below the threshold
+	pollInterval := time.Duration(stream.opts.BackpressurePollMs) * time.Millisecond
+	for isPaused := false; ; isPaused = true {
+		length, err := stream.client.XLen(ctx, stream.name).Result()
+		if err != nil {
+			return err
+		}
+		if length < stream.opts.BackpressureThreshold {
+			return nil
+		}
+
+		// In slow mode, we wait longer the further we are above the threshold then
+		// add the message regardless of the stream length
+		if stream.opts.BackpressureMode == BackpressureModeSlow {
+			factor := length / stream.opts.BackpressureThreshold
+			stream.logger.Printf("Stream length (%d) exceeds backpressure threshold (%d), slowing down by %dx\n", length, stream.opts.BackpressureThreshold, factor)
+			return sleep(ctx, time.Duration(factor)*pollInterval)
+		}
+
+		// In pause mode, we wait until the consumers have caught up
+		if !isPaused {
+			stream.logger.Printf("Stream length (%d) exceeds backpressure threshold (%d), pausing\n", length, stream.opts.BackpressureThreshold)
+		}
+		if err := sleep(ctx, pollInterval); err != nil {
+			return err
+		}
+	}
 }
 
 func (stream *RedisStream[T]) XAckDel(
@@ -121,6 +342,22 @@ func (stream *RedisStream[T]) GetPendingMsg(
 	}
 }
 
+// Checks if a message is still pending in the consumer group (i.e. it was delivered to a
+// consumer but hasn't been acknowledged yet)
+func (stream *RedisStream[T]) IsPending(ctx context.Context, msgID string) (bool, error) {
+	pendingMsgs, err := stream.client.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: stream.name,
+		Group:  stream.consumerGroupName,
+		Start:  msgID,
+		End:    msgID,
+		Count:  1,
+	}).Result()
+	if err != nil {
+		return false, err
+	}
+	return len(pendingMsgs) != 0, nil
+}
+
 func (stream *RedisStream[T]) Subscribe(
 	ctx context.Context,
 	consumerName string,
@@ -249,18 +486,13 @@ func (stream *RedisStream[T]) processNewMsgs(
 		stream.logger.Printf("Successfully received %d message(s)", len(msgs))
 	}
 
-	// Parses the message(s)
-	parsedMsgs := make([]ParsedStreamMessage[T], len(msgs))
-	for i, msg := range msgs {
-		data, err := ParseMessage[T](msg)
-		if err != nil {
-			return err
-		} else {
-			parsedMsgs[i] = ParsedStreamMessage[T]{
-				ID:   msg.ID,
-				Data: *data,
-			}
-		}
+	// Parses the message(s) - messages that cannot be parsed are dropped
+	rawMsgs, parsedMsgs, err := stream.parseMessages(ctx, msgs)
+	if err != nil {
+		return err
+	}
+	if len(parsedMsgs) == 0 {
+		return nil
 	}
 
 	// Processes the message(s)
@@ -268,11 +500,9 @@ func (stream *RedisStream[T]) processNewMsgs(
 		ConsumerName: consumerName,
 		Logger:       stream.logger,
 	}); err != nil {
-		// TODO: we may want to store this error in the database for the client to see
-		common.LogError(stream.logger, err)
-		return nil
+		return stream.handleError(ctx, rawMsgs, parsedMsgs, err)
 	} else {
-		stream.logger.Printf("Successfully processed %d stream message(s)", len(msgs))
+		stream.logger.Printf("Successfully processed %d stream message(s)", len(parsedMsgs))
 	}
 
 	// Returns nil if no errors occurred
@@ -324,33 +554,149 @@ func (stream *RedisStream[T]) processBacklogMsgs(
 			stream.logger.Printf("Successfully received %d stream message(s)", len(msgs))
 		}
 
-		// Parses the message(s)
-		parsedMsgs := make([]ParsedStreamMessage[T], len(msgs))
-		for i, msg := range msgs {
-			data, err := ParseMessage[T](msg)
-			if err != nil {
-				return err
-			} else {
-				parsedMsgs[i] = ParsedStreamMessage[T]{
-					ID:   msg.ID,
-					Data: *data,
+		// Parses the message(s) - messages that cannot be parsed are dropped
+		rawMsgs, parsedMsgs, err := stream.parseMessages(ctx, msgs)
+		if err != nil {
+			return err
+		}
+
+		// Processes the message(s)
+		if len(parsedMsgs) != 0 {
+			if err := handler(ctx, parsedMsgs, true, SubscribeMetadata{
+				ConsumerName: consumerName,
+				Logger:       stream.logger,
+			}); err != nil {
+				if err := stream.handleError(ctx, rawMsgs, parsedMsgs, err); err != nil {
+					return err
 				}
+			} else {
+				stream.logger.Printf("Successfully processed %d stream message(s)", len(parsedMsgs))
 			}
 		}
 
-		// Processes the message
-		if err := handler(ctx, parsedMsgs, true, SubscribeMetadata{
-			ConsumerName: consumerName,
-			Logger:       stream.logger,
-		}); err != nil {
-			// TODO: we may want to store this somewhere for the client to see
-			common.LogError(stream.logger, err)
+		// Moves onto the next backlog item
+		cursorId = msgs[len(msgs)-1].ID
+	}
+}
+
+// Parses the messages and returns the ones that were parsed successfully (along with
+// their raw counterparts). Messages that cannot be parsed will never be processed, so
+// they are treated as poison and dropped from the stream.
+func (stream *RedisStream[T]) parseMessages(
+	ctx context.Context,
+	msgs []redis.XMessage,
+) ([]redis.XMessage, []ParsedStreamMessage[T], error) {
+	rawMsgs := make([]redis.XMessage, 0, len(msgs))
+	parsedMsgs := make([]ParsedStreamMessage[T], 0, len(msgs))
+	poisonMsgIDs := []string{}
+	for _, msg := range msgs {
+		data, err := ParseMessage[T](msg)
+		if err != nil {
+			common.LogError(stream.logger, NewPoisonError(fmt.Errorf("failed to parse message \"%s\": %w", msg.ID, err)))
+			poisonMsgIDs = append(poisonMsgIDs, msg.ID)
 		} else {
-			stream.logger.Printf("Successfully processed %d stream message(s)", len(msgs))
+			rawMsgs = append(rawMsgs, msg)
+			parsedMsgs = append(parsedMsgs, ParsedStreamMessage[T]{
+				ID:   msg.ID,
+				Data: *data,
+			})
 		}
+	}
 
-		// Moves onto the next backlog item
-		cursorId = msgs[len(msgs)-1].ID
+	if len(poisonMsgIDs) != 0 {
+		if err := stream.XAckDel(ctx, poisonMsgIDs); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return rawMsgs, parsedMsgs, nil
+}
+
+// Acts on an error returned by a handler according to its kind (see errors.go)
+func (stream *RedisStream[T]) handleError(
+	ctx context.Context,
+	rawMsgs []redis.XMessage,
+	parsedMsgs []ParsedStreamMessage[T],
+	err error,
+) error {
+	// Logs the error
+	common.LogError(stream.logger, err)
+
+	// Gets the IDs of the messages that failed
+	msgIDs := make([]string, len(rawMsgs))
+	for i, msg := range rawMsgs {
+		msgIDs[i] = msg.ID
+	}
+
+	// Retryable errors leave the messages in the pending entries list
+	switch GetErrorKind(err) {
+	case ErrorKindPermanent:
+		if err := stream.deadLetter(ctx, msgIDs, err); err != nil {
+			return err
+		} else {
+			stream.logger.Printf("Moved %d stream message(s) to dead letter stream \"%s\"", len(msgIDs), stream.DeadLetterStreamName())
+		}
+	case ErrorKindPoison:
+		if err := stream.XAckDel(ctx, msgIDs); err != nil {
+			return err
+		} else {
+			stream.logger.Printf("Dropped %d poison stream message(s)", len(msgIDs))
+		}
+	default:
+		return nil
+	}
+
+	// Lets the owner of the stream clean up after the dropped messages
+	if stream.onDrop != nil {
+		return stream.onDrop(ctx, parsedMsgs)
+	}
+
+	// Returns nil if no errors occurred
+	return nil
+}
+
+func (stream *RedisStream[T]) deadLetter(
+	ctx context.Context,
+	msgIDs []string,
+	cause error,
+) error {
+	// This script copies each message (along with the error that caused it to be
+	// dead lettered) to the dead letter stream then acknowledges and deletes the
+	// message from the original stream in one atomic operation
+	deadLetterScript := redis.NewScript(`
+    local stream_key = KEYS[1]
+    local dead_letter_stream_key = KEYS[2]
+    local consumer_group_name = ARGV[1]
+    local cause = ARGV[2]
+    local max_len = ARGV[3]
+
+    for i = 4, #ARGV do
+      local msg_id = ARGV[i]
+      local entries = redis.call("XRANGE", stream_key, msg_id, msg_id)
+      if #entries ~= 0 then
+        redis.call("XADD", dead_letter_stream_key, "MAXLEN", "~", max_len, "*", "MsgID", msg_id, "Error", cause, unpack(entries[1][2]))
+      end
+      redis.call("XACK", stream_key, consumer_group_name, msg_id)
+      redis.call("XDEL", stream_key, msg_id)
+    end
+  `)
+
+	// Executes the script
+	args := make([]any, 0, len(msgIDs)+3)
+	args = append(args, stream.consumerGroupName, cause.Error(), DeadLetterStreamMaxLen)
+	for _, msgID := range msgIDs {
+		args = append(args, msgID)
+	}
+	if err := deadLetterScript.Run(ctx, stream.client,
+		[]string{
+			stream.name,
+			stream.DeadLetterStreamName(),
+		},
+		args,
+	).Err(); err != nil && !errors.Is(err, redis.Nil) {
+		return err
+	} else {
+		return nil
 	}
 }
 
@@ -0,0 +1,213 @@
+package streams
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	testredis "github.com/chris-de-leon/block-feed-prototype/testutils/clients/redis"
+	"github.com/chris-de-leon/block-feed-prototype/testutils/containers"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestRedisStream(t *testing.T) {
+	// Defines helper variables
+	const consumerGroupName = "test-group"
+	ctx := context.Background()
+	client := newTestRedisCluster(t)
+
+	// Defines a helper function that creates a stream along with its consumer group
+	newStream := func(t *testing.T, opts *RedisStreamOpts) *RedisStream[BlockStreamMsgData] {
+		stream := NewRedisStream[BlockStreamMsgData](client, "{"+t.Name()+"}", consumerGroupName, opts)
+		if err := client.XGroupCreateMkStream(ctx, stream.Name(), consumerGroupName, "0").Err(); err != nil {
+			t.Fatal(err)
+		}
+		return stream
+	}
+
+	// Defines a helper function that adds blocks to a stream
+	addBlocks := func(t *testing.T, stream *RedisStream[BlockStreamMsgData], heights ...uint64) {
+		for _, height := range heights {
+			if err := stream.XAdd(ctx, NewBlockStreamMsg(height, []byte{})); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// Defines a helper function that reads (but doesn't acknowledge) messages
+	readMsgs := func(t *testing.T, stream *RedisStream[BlockStreamMsgData], count int64) []string {
+		result, err := client.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    consumerGroupName,
+			Consumer: "test-consumer",
+			Streams:  []string{stream.Name(), ">"},
+			Count:    count,
+		}).Result()
+		if err != nil {
+			t.Fatal(err)
+		}
+		msgIDs := []string{}
+		for _, msg := range result[0].Messages {
+			msgIDs = append(msgIDs, msg.ID)
+		}
+		return msgIDs
+	}
+
+	// Defines a helper function that checks that the given messages are still in the stream
+	assertExists := func(t *testing.T, stream *RedisStream[BlockStreamMsgData], msgIDs []string) {
+		for _, msgID := range msgIDs {
+			msgs, err := client.XRange(ctx, stream.Name(), msgID, msgID).Result()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(msgs) != 1 {
+				t.Fatalf("Expected message %s to still be in the stream", msgID)
+			}
+		}
+	}
+
+	// Defines a helper function that checks the length of a stream
+	assertLen := func(t *testing.T, stream *RedisStream[BlockStreamMsgData], expected int64) {
+		length, err := client.XLen(ctx, stream.Name()).Result()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if length != expected {
+			t.Fatalf("Expected the stream to have %d message(s) but got %d", expected, length)
+		}
+	}
+
+	t.Run("Trim (minid keeps pending messages)", func(t *testing.T) {
+		stream := newStream(t, &RedisStreamOpts{TrimStrategy: TrimStrategyMinID})
+		addBlocks(t, stream, 0, 1, 2, 3, 4)
+
+		// Reads 3 messages and only acknowledges the 2nd one - the 1st and 3rd are still pending
+		msgIDs := readMsgs(t, stream, 3)
+		if err := client.XAck(ctx, stream.Name(), consumerGroupName, msgIDs[1]).Err(); err != nil {
+			t.Fatal(err)
+		}
+
+		// Nothing before the oldest pending message can be trimmed
+		addBlocks(t, stream, 5)
+		assertExists(t, stream, []string{msgIDs[0], msgIDs[2]})
+		assertLen(t, stream, 6)
+
+		// Once the oldest pending message is acknowledged, everything before the 3rd message is trimmed
+		if err := client.XAck(ctx, stream.Name(), consumerGroupName, msgIDs[0]).Err(); err != nil {
+			t.Fatal(err)
+		}
+		addBlocks(t, stream, 6)
+		assertExists(t, stream, msgIDs[2:])
+		assertLen(t, stream, 5)
+
+		// Messages that were never delivered are never trimmed
+		if err := client.XAck(ctx, stream.Name(), consumerGroupName, msgIDs[2]).Err(); err != nil {
+			t.Fatal(err)
+		}
+		if err := stream.Trim(ctx); err != nil {
+			t.Fatal(err)
+		}
+		assertLen(t, stream, 5)
+	})
+
+	t.Run("Trim (minid without a consumer group)", func(t *testing.T) {
+		stream := NewRedisStream[BlockStreamMsgData](client, "{"+t.Name()+"}", consumerGroupName, &RedisStreamOpts{TrimStrategy: TrimStrategyMinID})
+		addBlocks(t, stream, 0, 1, 2)
+		assertLen(t, stream, 3)
+	})
+
+	t.Run("Trim (maxlen)", func(t *testing.T) {
+		stream := newStream(t, &RedisStreamOpts{TrimStrategy: TrimStrategyMaxLen, TrimMaxLen: 2})
+		addBlocks(t, stream, 0, 1, 2, 3)
+		assertLen(t, stream, 2)
+	})
+
+	t.Run("Backpressure (pause)", func(t *testing.T) {
+		stream := newStream(t, &RedisStreamOpts{
+			BackpressureThreshold: 3,
+			BackpressureMode:      BackpressureModePause,
+			BackpressurePollMs:    10,
+		})
+
+		// Messages are added right away while the stream is below the threshold
+		addBlocks(t, stream, 0, 1, 2)
+		msgIDs := readMsgs(t, stream, 3)
+
+		// Once the threshold is reached, XADD blocks
+		done := make(chan error, 1)
+		go func() {
+			done <- stream.XAdd(ctx, NewBlockStreamMsg(3, []byte{}))
+		}()
+		select {
+		case err := <-done:
+			t.Fatalf("Expected XADD to block but it returned: %v", err)
+		case <-time.After(200 * time.Millisecond):
+		}
+
+		// XADD resumes once the consumers catch up
+		if err := stream.XAckDel(ctx, msgIDs[:1]); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatal(err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Expected XADD to resume once the stream fell below the threshold")
+		}
+		assertLen(t, stream, 3)
+	})
+
+	t.Run("Backpressure (pause respects the context)", func(t *testing.T) {
+		stream := newStream(t, &RedisStreamOpts{BackpressureThreshold: 1, BackpressurePollMs: 10})
+		addBlocks(t, stream, 0)
+
+		timeoutCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		defer cancel()
+		if err := stream.XAdd(timeoutCtx, NewBlockStreamMsg(1, []byte{})); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("Expected context.DeadlineExceeded but got: %v", err)
+		}
+		assertLen(t, stream, 1)
+	})
+
+	t.Run("Backpressure (slow)", func(t *testing.T) {
+		stream := newStream(t, &RedisStreamOpts{
+			BackpressureThreshold: 2,
+			BackpressureMode:      BackpressureModeSlow,
+			BackpressurePollMs:    100,
+		})
+
+		// Below the threshold there is no delay
+		start := time.Now()
+		addBlocks(t, stream, 0, 1)
+		if elapsed := time.Since(start); elapsed >= 100*time.Millisecond {
+			t.Fatalf("Expected no delay below the threshold but XADD took %v", elapsed)
+		}
+
+		// At twice the threshold, XADD is delayed by two poll intervals but still succeeds
+		addBlocks(t, stream, 2, 3)
+		start = time.Now()
+		addBlocks(t, stream, 4)
+		if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+			t.Fatalf("Expected XADD to be delayed by at least 200ms but it took %v", elapsed)
+		}
+		assertLen(t, stream, 5)
+	})
+}
+
+// Starts a redis cluster and returns a client that's connected to it
+func newTestRedisCluster(t *testing.T) *redis.ClusterClient {
+	container, err := containers.NewRedisClusterContainer(context.Background(), t, containers.REDIS_CLUSTER_MIN_NODES)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := testredis.GetRedisClusterClient(t, container.Conn.Url)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return client
+}
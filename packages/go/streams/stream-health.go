@@ -0,0 +1,183 @@
+package streams
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/sync/errgroup"
+)
+
+type (
+	// NOTE: durations are reported in milliseconds
+	ConsumerHealth struct {
+		Name       string `json:"name"`
+		Pending    int64  `json:"pending"`
+		IdleMs     int64  `json:"idleMs"`
+		InactiveMs int64  `json:"inactiveMs"`
+	}
+
+	// NOTE: redis reports a lag of 0 when it cannot determine the lag of a consumer
+	// group (e.g. if entries were deleted from the stream before they were read)
+	ConsumerGroupHealth struct {
+		Name            string           `json:"name"`
+		Lag             int64            `json:"lag"`
+		Pending         int64            `json:"pending"`
+		LastDeliveredID string           `json:"lastDeliveredId"`
+		Consumers       []ConsumerHealth `json:"consumers"`
+	}
+
+	StreamHealth struct {
+		Name   string                `json:"name"`
+		Length int64                 `json:"length"`
+		Groups []ConsumerGroupHealth `json:"groups"`
+	}
+
+	WebhookShardHealth struct {
+		ShardID           int32        `json:"shardId"`
+		Stream            StreamHealth `json:"stream"`
+		WebhookSetSize    int64        `json:"webhookSetSize"`
+		PendingSetSize    int64        `json:"pendingSetSize"`
+		DelayedSetSize    int64        `json:"delayedSetSize"`
+		ParkedSetSize     int64        `json:"parkedSetSize"`
+		LatestBlockHeight *uint64      `json:"latestBlockHeight"`
+	}
+)
+
+func (stream *RedisStream[T]) Health(ctx context.Context) (*StreamHealth, error) {
+	// Gets the number of entries in the stream
+	length, err := stream.client.XLen(ctx, stream.name).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	// Gets the consumer groups - if the stream doesn't exist yet then there's nothing left to report
+	groups, err := stream.client.XInfoGroups(ctx, stream.name).Result()
+	if err != nil && isNoSuchKeyErr(err) {
+		return &StreamHealth{Name: stream.name, Length: length, Groups: []ConsumerGroupHealth{}}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Gets the consumers in each group
+	groupHealth := make([]ConsumerGroupHealth, len(groups))
+	for i, group := range groups {
+		consumers, err := stream.client.XInfoConsumers(ctx, stream.name, group.Name).Result()
+		if err != nil {
+			return nil, err
+		}
+
+		consumerHealth := make([]ConsumerHealth, len(consumers))
+		for j, consumer := range consumers {
+			consumerHealth[j] = ConsumerHealth{
+				Name:       consumer.Name,
+				Pending:    consumer.Pending,
+				IdleMs:     consumer.Idle.Milliseconds(),
+				InactiveMs: consumer.Inactive.Milliseconds(),
+			}
+		}
+
+		groupHealth[i] = ConsumerGroupHealth{
+			Name:            group.Name,
+			Lag:             group.Lag,
+			Pending:         group.Pending,
+			LastDeliveredID: group.LastDeliveredID,
+			Consumers:       consumerHealth,
+		}
+	}
+
+	// Returns the health of the stream
+	return &StreamHealth{
+		Name:   stream.name,
+		Length: length,
+		Groups: groupHealth,
+	}, nil
+}
+
+func (stream *WebhookStream) ShardHealth(ctx context.Context) (*WebhookShardHealth, error) {
+	// Gets the health of the stream itself
+	streamHealth, err := stream.Health(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Gets the number of active webhooks in this shard
+	webhookSetSize, err := stream.client.SCard(ctx, GetWebhookSetKey(stream.ShardNum)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	// Gets the number of webhooks that are waiting for new blocks
+	pendingSetSize, err := stream.client.ZCard(ctx, GetPendingSetKey(stream.ShardNum)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	// Gets the number of webhooks that are waiting to be retried later
+	delayedSetSize, err := stream.client.ZCard(ctx, GetDelayedSetKey(stream.ShardNum)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	// Gets the number of webhooks whose circuit is open
+	parkedSetSize, err := stream.client.ZCard(ctx, GetParkedSetKey(stream.ShardNum)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	// Gets the latest block height that was flushed to this shard (if any)
+	var latestBlockHeight *uint64 = nil
+	rawHeight, err := stream.client.Get(ctx, GetLatestBlockHeightKey(stream.ShardNum)).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, err
+	}
+	if err == nil {
+		height, err := strconv.ParseUint(rawHeight, 10, 64)
+		if err != nil {
+			return nil, err
+		} else {
+			latestBlockHeight = &height
+		}
+	}
+
+	// Returns the health of the shard
+	return &WebhookShardHealth{
+		ShardID:           stream.ShardNum,
+		Stream:            *streamHealth,
+		WebhookSetSize:    webhookSetSize,
+		PendingSetSize:    pendingSetSize,
+		DelayedSetSize:    delayedSetSize,
+		ParkedSetSize:     parkedSetSize,
+		LatestBlockHeight: latestBlockHeight,
+	}, nil
+}
+
+// Reports the health of every webhook shard for a chain in ascending order of shard ID
+func GetWebhookShardsHealth(ctx context.Context, client *redis.ClusterClient, shardCount int32) ([]WebhookShardHealth, error) {
+	shards := make([]WebhookShardHealth, shardCount)
+	eg := new(errgroup.Group)
+	for shardID := range shardCount {
+		eg.Go(func() error {
+			health, err := NewWebhookStream(client, shardID, nil).ShardHealth(ctx)
+			if err != nil {
+				return err
+			} else {
+				shards[shardID] = *health
+				return nil
+			}
+		})
+	}
+
+	if err := eg.Wait(); err != nil {
+		return nil, err
+	} else {
+		return shards, nil
+	}
+}
+
+func isNoSuchKeyErr(err error) bool {
+	return strings.Contains(err.Error(), "no such key")
+}
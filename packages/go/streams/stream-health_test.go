@@ -0,0 +1,81 @@
+package streams
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestStreamHealth(t *testing.T) {
+	// Defines helper variables
+	const consumerGroupName = "test-group"
+	const consumerName = "test-consumer"
+	ctx := context.Background()
+	client := newTestRedisCluster(t)
+	stream := NewRedisStream[BlockStreamMsgData](client, "{test-health}", consumerGroupName, nil)
+
+	t.Run("Health (missing stream)", func(t *testing.T) {
+		health, err := stream.Health(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if health.Length != 0 || len(health.Groups) != 0 {
+			t.Fatalf("Expected an empty report but got: %+v", health)
+		}
+	})
+
+	t.Run("Health (consumer group)", func(t *testing.T) {
+		// Adds 3 messages and reads 2 of them without acknowledging them
+		if err := client.XGroupCreateMkStream(ctx, stream.Name(), consumerGroupName, "0").Err(); err != nil {
+			t.Fatal(err)
+		}
+		for i := range 3 {
+			if err := stream.XAdd(ctx, NewBlockStreamMsg(uint64(i), []byte{})); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := client.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    consumerGroupName,
+			Consumer: consumerName,
+			Streams:  []string{stream.Name(), ">"},
+			Count:    2,
+		}).Err(); err != nil {
+			t.Fatal(err)
+		}
+
+		// Gives the consumer some time to become idle
+		time.Sleep(100 * time.Millisecond)
+
+		health, err := stream.Health(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if health.Length != 3 || len(health.Groups) != 1 {
+			t.Fatalf("Expected 3 messages and 1 consumer group but got: %+v", health)
+		}
+
+		group := health.Groups[0]
+		if group.Name != consumerGroupName || group.Pending != 2 || group.Lag != 1 {
+			t.Fatalf("Expected 2 pending messages and a lag of 1 but got: %+v", group)
+		}
+		if len(group.Consumers) != 1 || group.Consumers[0].Name != consumerName || group.Consumers[0].Pending != 2 {
+			t.Fatalf("Unexpected consumers: %+v", group.Consumers)
+		}
+		if idleMs := group.Consumers[0].IdleMs; idleMs < 100 || idleMs > 60000 {
+			t.Fatalf("Expected the consumer to be idle for at least 100ms but got %dms", idleMs)
+		}
+
+		// Durations are reported in milliseconds
+		data, err := json.Marshal(health)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(data), `"idleMs":`) || !strings.Contains(string(data), `"inactiveMs":`) {
+			t.Fatalf("Expected durations to be reported in milliseconds but got: %s", data)
+		}
+	})
+}
@@ -7,6 +7,7 @@ import (
 	"log"
 	"reflect"
 	"strings"
+	"time"
 
 	"github.com/redis/go-redis/v9"
 	"golang.org/x/exp/constraints"
@@ -60,6 +61,9 @@ type (
 		XPendingExt(ctx context.Context, a *redis.XPendingExtArgs) *redis.XPendingExtCmd
 		XReadGroup(ctx context.Context, a *redis.XReadGroupArgs) *redis.XStreamSliceCmd
 		XAdd(ctx context.Context, args *redis.XAddArgs) *redis.StringCmd
+		XLen(ctx context.Context, stream string) *redis.IntCmd
+		XInfoGroups(ctx context.Context, key string) *redis.XInfoGroupsCmd
+		XInfoConsumers(ctx context.Context, key string, group string) *redis.XInfoConsumersCmd
 	}
 
 	ParsedStreamMessage[T any] struct {
@@ -81,6 +85,14 @@ const (
 	Separator            = ":"
 	Namespace            = "block-feed"
 	PendingSetKey        = "pending-set"
+	DelayedSetKey        = "delayed-set"
+	ParkedSetKey         = "parked-set"
+	JobIndexKey          = "job-index"
+	CircuitBreakerKey    = "circuit-breaker"
+	CursorOverrideKey    = "cursor-override"
+	PausedJobsKey        = "paused-jobs"
+	WebhookLeaseKey      = "webhook-lease"
+	WebhookFenceKey      = "webhook-fence"
 	LatestBlockHeightKey = "latest-block-height"
 	WebhookSet           = "webhook-set"
 )
@@ -95,6 +107,10 @@ func (m StreamMessage[T]) MarshalBinary() ([]byte, error) {
 	return json.Marshal(m.Data)
 }
 
+func (m StreamMessage[T]) Encode(codec StreamCodec) ([]byte, error) {
+	return codec.Marshal(m.Data)
+}
+
 func GetDataField() string {
 	return dataField
 }
@@ -107,8 +123,19 @@ func ParseMessage[T any](msg redis.XMessage) (*T, error) {
 		return nil, fmt.Errorf("key \"%s\" does not exist in map: %v", dataField, values)
 	}
 
+	// Entries without a codec tag are always JSON encoded
+	codecName := ""
+	if rawCodec, exists := values[CodecField]; exists {
+		codecName = fmt.Sprint(rawCodec)
+	}
+
+	codec, err := GetCodec(codecName)
+	if err != nil {
+		return nil, err
+	}
+
 	var parsedMsg T
-	if err := json.Unmarshal([]byte(fmt.Sprint(rawData)), &parsedMsg); err != nil {
+	if err := codec.Unmarshal([]byte(fmt.Sprint(rawData)), &parsedMsg); err != nil {
 		return nil, err
 	}
 
@@ -127,6 +154,38 @@ func GetPendingSetKey[T constraints.Signed](shardID T) string {
 	return NamespaceJoin(ShardIdKey(shardID), PendingSetKey)
 }
 
+func GetDelayedSetKey[T constraints.Signed](shardID T) string {
+	return NamespaceJoin(ShardIdKey(shardID), DelayedSetKey)
+}
+
+func GetParkedSetKey[T constraints.Signed](shardID T) string {
+	return NamespaceJoin(ShardIdKey(shardID), ParkedSetKey)
+}
+
+func GetJobIndexKey[T constraints.Signed](shardID T) string {
+	return NamespaceJoin(ShardIdKey(shardID), JobIndexKey)
+}
+
+func GetCircuitBreakerKey[T constraints.Signed](shardID T, webhookID string) string {
+	return NamespaceJoin(ShardIdKey(shardID), CircuitBreakerKey, webhookID)
+}
+
+func GetCursorOverrideKey[T constraints.Signed](shardID T, webhookID string) string {
+	return NamespaceJoin(ShardIdKey(shardID), CursorOverrideKey, webhookID)
+}
+
+func GetWebhookLeaseKey[T constraints.Signed](shardID T, webhookID string) string {
+	return NamespaceJoin(ShardIdKey(shardID), WebhookLeaseKey, webhookID)
+}
+
+func GetWebhookFenceKey[T constraints.Signed](shardID T, webhookID string) string {
+	return NamespaceJoin(ShardIdKey(shardID), WebhookFenceKey, webhookID)
+}
+
+func GetPausedJobsKey[T constraints.Signed](shardID T) string {
+	return NamespaceJoin(ShardIdKey(shardID), PausedJobsKey)
+}
+
 func GetLatestBlockHeightKey[T constraints.Signed](shardID T) string {
 	return NamespaceJoin(ShardIdKey(shardID), LatestBlockHeightKey)
 }
@@ -138,3 +197,15 @@ func ShardIdKey[T constraints.Signed](shardID T) string {
 func NamespaceJoin(strs ...string) string {
 	return strings.Join(append([]string{Namespace}, strs...), Separator)
 }
+
+// Sleeps for the given duration or until the context is cancelled
+func sleep(ctx context.Context, duration time.Duration) error {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
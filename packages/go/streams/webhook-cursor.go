@@ -0,0 +1,251 @@
+package streams
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	ErrWebhookNotActive = errors.New("webhook is not active in this shard")
+	ErrHeightOutOfRange = errors.New("block height is out of range")
+)
+
+// Moves the cursor of a webhook (i.e. the height of the next block that it will receive).
+//
+// A webhook's job is always in exactly one place: the pending set, the delayed set, the
+// parked set, the stream, or the pending entries list of a consumer that is processing it.
+// If the job is resting in one of the sets, then it is replaced by a job that starts from
+// the new height in one atomic operation and true is returned.
+//
+// Jobs in the stream can't be looked up efficiently and claimed jobs belong to a consumer,
+// so in these cases the new height is stored as a cursor override and false is returned.
+// Processors check for an override before handling a job (see ApplyCursorOverride), so the
+// override takes effect the next time the job is handled. If a consumer is in the middle
+// of a delivery when the cursor is moved, then that delivery still completes.
+//
+// The cursor can't be moved past the block after the latest one. Heights whose blocks are
+// no longer in the block store can't be checked here, so the caller should make sure that
+// they are still available.
+func (stream *WebhookStream) SetCursor(ctx context.Context, webhookID string, height uint64) (bool, error) {
+	// This script performs the following:
+	//
+	//  First, we make sure that the webhook is active in this shard and that the new
+	//  height is at most one block past the latest block.
+	//
+	//  Next, the job index is used to find the webhook's job in the pending, delayed,
+	//  and parked sets. Replay jobs for the same webhook are skipped.
+	//
+	//  If the job is found, it is removed from its set and a new job is added to the
+	//  stream (or the pending set if the new height hasn't been reached yet). Any old
+	//  override is removed since it no longer applies.
+	//
+	//  Otherwise, the new height is stored as an override.
+	//
+	script := redis.NewScript(jobIndexScript + `
+    local webhook_set_key = KEYS[1]
+    local latest_block_height_key = KEYS[2]
+    local pending_set_key = KEYS[3]
+    local delayed_set_key = KEYS[4]
+    local parked_set_key = KEYS[5]
+    local webhook_stream_key = KEYS[6]
+    local cursor_override_key = KEYS[7]
+    local job_index_key = KEYS[8]
+    local webhook_id = ARGV[1]
+    local webhook_stream_msg_data_field = ARGV[2]
+    local new_block_height = tonumber(ARGV[3])
+    local webhook_stream_new_msg_data = ARGV[4]
+
+    if redis.call("SISMEMBER", webhook_set_key, webhook_id) == 0 then
+      return -1
+    end
+
+    local latest_block_height = redis.call("GET", latest_block_height_key)
+    if latest_block_height ~= false and new_block_height > tonumber(latest_block_height) + 1 then
+      return -2
+    end
+
+    local jobs = find_jobs(job_index_key, { pending_set_key, delayed_set_key, parked_set_key }, webhook_id, false)
+    if #jobs ~= 0 then
+      redis.call("ZREM", jobs[1][1], jobs[1][2])
+      unindex_job(job_index_key, jobs[1][2])
+      redis.call("DEL", cursor_override_key)
+
+      if latest_block_height ~= false and new_block_height < tonumber(latest_block_height) then
+        redis.call("XADD", webhook_stream_key, "*", webhook_stream_msg_data_field, webhook_stream_new_msg_data)
+      else
+        redis.call("ZADD", pending_set_key, new_block_height, webhook_stream_new_msg_data)
+        index_job(job_index_key, webhook_stream_new_msg_data)
+      end
+      return 1
+    end
+
+    redis.call("SET", cursor_override_key, new_block_height)
+    return 0
+  `)
+
+	// Executes the script
+	result, err := script.Run(ctx, stream.client,
+		[]string{
+			GetWebhookSetKey(stream.ShardNum),
+			GetLatestBlockHeightKey(stream.ShardNum),
+			GetPendingSetKey(stream.ShardNum),
+			GetDelayedSetKey(stream.ShardNum),
+			GetParkedSetKey(stream.ShardNum),
+			stream.Name(),
+			GetCursorOverrideKey(stream.ShardNum, webhookID),
+			GetJobIndexKey(stream.ShardNum),
+		},
+		[]any{
+			webhookID,
+			GetDataField(),
+			height,
+			NewWebhookStreamMsg(webhookID, height, false),
+		},
+	).Int64()
+	if err != nil {
+		return false, err
+	}
+	if result == -1 {
+		return false, ErrWebhookNotActive
+	}
+	if result == -2 {
+		return false, fmt.Errorf("%w: cursor can't be moved past the latest block (%d)", ErrHeightOutOfRange, height)
+	}
+
+	// Trims the stream in case the job was moved into it
+	if result == 1 {
+		return true, stream.Trim(ctx)
+	}
+	return false, nil
+}
+
+// Gets the height of the latest block that was flushed to this shard (see Flush)
+func (stream *WebhookStream) GetLatestBlockHeight(ctx context.Context) (uint64, bool, error) {
+	rawHeight, err := stream.client.Get(ctx, GetLatestBlockHeightKey(stream.ShardNum)).Result()
+	if errors.Is(err, redis.Nil) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+
+	height, err := strconv.ParseUint(rawHeight, 10, 64)
+	if err != nil {
+		return 0, false, err
+	}
+	return height, true, nil
+}
+
+// Gets the cursor override of a webhook (if any)
+func (stream *WebhookStream) GetCursorOverride(ctx context.Context, webhookID string) (uint64, bool, error) {
+	rawHeight, err := stream.client.Get(ctx, GetCursorOverrideKey(stream.ShardNum, webhookID)).Result()
+	if errors.Is(err, redis.Nil) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+
+	height, err := strconv.ParseUint(rawHeight, 10, 64)
+	if err != nil {
+		return 0, false, err
+	}
+	return height, true, nil
+}
+
+// Applies the cursor override of a webhook to its job. The job is acknowledged and replaced
+// by a job that starts from the override's height, and the override is removed in the same
+// atomic operation. The override is only removed if it still has the given height, otherwise
+// it was moved again in the meantime and it still needs to be applied.
+func (stream *WebhookStream) ApplyCursorOverride(
+	ctx context.Context,
+	oldMsg ParsedStreamMessage[WebhookStreamMsgData],
+	height uint64,
+) error {
+	return stream.reschedule(
+		ctx,
+		oldMsg,
+		NewWebhookStreamMsg(oldMsg.Data.WebhookID, height, false),
+		strconv.FormatUint(height, 10),
+	)
+}
+
+// Resends the blocks in the range [startHeight, endHeight] to a webhook once. The replay
+// runs alongside the webhook's regular job and does not move its cursor. Each replay gets
+// its own delivery IDs so that receivers don't discard the blocks as duplicates. The ID
+// of the replay is returned.
+//
+// The range can't go past the latest block. Like SetCursor, the caller should make sure
+// that the blocks in the range are still in the block store.
+func (stream *WebhookStream) Replay(ctx context.Context, webhookID string, startHeight uint64, endHeight uint64) (string, error) {
+	if endHeight < startHeight {
+		return "", fmt.Errorf("%w: invalid replay range %d-%d", ErrHeightOutOfRange, startHeight, endHeight)
+	}
+
+	// Adds the replay job to the stream if the webhook is active in this shard and the
+	// blocks in the range have already arrived
+	script := redis.NewScript(`
+    local webhook_set_key = KEYS[1]
+    local webhook_stream_key = KEYS[2]
+    local latest_block_height_key = KEYS[3]
+    local webhook_id = ARGV[1]
+    local webhook_stream_msg_data_field = ARGV[2]
+    local webhook_stream_new_msg_data = ARGV[3]
+    local end_block_height = tonumber(ARGV[4])
+
+    if redis.call("SISMEMBER", webhook_set_key, webhook_id) == 0 then
+      return 0
+    end
+
+    local latest_block_height = redis.call("GET", latest_block_height_key)
+    if latest_block_height == false or end_block_height > tonumber(latest_block_height) then
+      return -1
+    end
+
+    redis.call("XADD", webhook_stream_key, "*", webhook_stream_msg_data_field, webhook_stream_new_msg_data)
+    return 1
+  `)
+
+	// Creates the replay job
+	replayID := uuid.NewString()
+	msg := &StreamMessage[WebhookStreamMsgData]{
+		Data: WebhookStreamMsgData{
+			WebhookID:   webhookID,
+			BlockHeight: startHeight,
+			ReplayID:    replayID,
+			ReplayUntil: endHeight,
+		},
+	}
+
+	// Executes the script
+	added, err := script.Run(ctx, stream.client,
+		[]string{
+			GetWebhookSetKey(stream.ShardNum),
+			stream.Name(),
+			GetLatestBlockHeightKey(stream.ShardNum),
+		},
+		[]any{
+			webhookID,
+			GetDataField(),
+			msg,
+			endHeight,
+		},
+	).Int64()
+	if err != nil {
+		return "", err
+	}
+	if added == 0 {
+		return "", ErrWebhookNotActive
+	}
+	if added == -1 {
+		return "", fmt.Errorf("%w: replay range %d-%d goes past the latest block", ErrHeightOutOfRange, startHeight, endHeight)
+	}
+
+	// Trims the stream now that a job was added to it
+	return replayID, stream.Trim(ctx)
+}
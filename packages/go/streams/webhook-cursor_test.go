@@ -0,0 +1,228 @@
+package streams
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestWebhookCursor(t *testing.T) {
+	// Defines helper variables
+	const latestHeight = 10
+	ctx := context.Background()
+	client := newTestRedisCluster(t)
+	stream := NewWebhookStream(client, 0, nil)
+
+	// Creates the consumer group and stores the latest block height
+	if err := client.XGroupCreateMkStream(ctx, stream.Name(), stream.ConsumerGroupName(), "0").Err(); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Set(ctx, GetLatestBlockHeightKey(stream.ShardNum), latestHeight, 0).Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Defines a helper function that claims the next job in the stream
+	claimJob := func(t *testing.T) ParsedStreamMessage[WebhookStreamMsgData] {
+		result, err := client.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    stream.ConsumerGroupName(),
+			Consumer: "test-consumer",
+			Streams:  []string{stream.Name(), ">"},
+			Count:    1,
+		}).Result()
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, parsedMsgs, err := stream.parseMessages(ctx, result[0].Messages)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsedMsgs[0]
+	}
+
+	// Defines a helper function that checks that a webhook has no jobs left in the job index
+	assertNotIndexed := func(t *testing.T, webhookID string) {
+		if exists, err := client.HExists(ctx, GetJobIndexKey(stream.ShardNum), webhookID).Result(); err != nil {
+			t.Fatal(err)
+		} else if exists {
+			t.Fatalf("Expected webhook %s to have no jobs in the job index", webhookID)
+		}
+	}
+
+	t.Run("SetCursor (inactive webhook)", func(t *testing.T) {
+		if _, err := stream.SetCursor(ctx, "inactive-webhook", 5); !errors.Is(err, ErrWebhookNotActive) {
+			t.Fatalf("Expected ErrWebhookNotActive but got: %v", err)
+		}
+	})
+
+	t.Run("SetCursor (job in the pending set)", func(t *testing.T) {
+		const webhookID = "pending-webhook"
+		if _, err := stream.Activate(ctx, NewWebhookStreamMsg(webhookID, 0, true)); err != nil {
+			t.Fatal(err)
+		}
+
+		// The cursor can't be moved past the next block
+		if _, err := stream.SetCursor(ctx, webhookID, latestHeight+2); !errors.Is(err, ErrHeightOutOfRange) {
+			t.Fatalf("Expected ErrHeightOutOfRange but got: %v", err)
+		}
+
+		// The job is moved from the pending set into the stream right away
+		if moved, err := stream.SetCursor(ctx, webhookID, 5); err != nil {
+			t.Fatal(err)
+		} else if !moved {
+			t.Fatal("Expected the job to be moved")
+		}
+		if count, err := client.ZCard(ctx, GetPendingSetKey(stream.ShardNum)).Result(); err != nil {
+			t.Fatal(err)
+		} else if count != 0 {
+			t.Fatalf("Expected the pending set to be empty but it has %d job(s)", count)
+		}
+		assertNotIndexed(t, webhookID)
+
+		msg := claimJob(t)
+		if msg.Data.WebhookID != webhookID || msg.Data.BlockHeight != 5 || msg.Data.IsNew {
+			t.Fatalf("Unexpected job: %+v", msg.Data)
+		}
+		if err := stream.XAckDel(ctx, msg, nil); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("SetCursor (job in the delayed set)", func(t *testing.T) {
+		const webhookID = "delayed-webhook"
+		if _, err := stream.Activate(ctx, NewWebhookStreamMsg(webhookID, 3, false)); err != nil {
+			t.Fatal(err)
+		}
+
+		// Sets the job aside
+		msg := claimJob(t)
+		if err := stream.Delay(ctx, msg, &StreamMessage[WebhookStreamMsgData]{Data: msg.Data}, time.Now().Add(time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+
+		// Moving the cursor to the next block puts the job in the pending set
+		if moved, err := stream.SetCursor(ctx, webhookID, latestHeight+1); err != nil {
+			t.Fatal(err)
+		} else if !moved {
+			t.Fatal("Expected the job to be moved")
+		}
+		if count, err := client.ZCard(ctx, GetDelayedSetKey(stream.ShardNum)).Result(); err != nil {
+			t.Fatal(err)
+		} else if count != 0 {
+			t.Fatalf("Expected the delayed set to be empty but it has %d job(s)", count)
+		}
+		if jobs, err := client.ZRangeWithScores(ctx, GetPendingSetKey(stream.ShardNum), 0, -1).Result(); err != nil {
+			t.Fatal(err)
+		} else if len(jobs) != 1 || jobs[0].Score != latestHeight+1 {
+			t.Fatalf("Expected 1 pending job at height %d but got: %v", latestHeight+1, jobs)
+		}
+
+		// Cleans up so that the pending set is empty for the other tests
+		if err := stream.Remove(ctx, webhookID); err != nil {
+			t.Fatal(err)
+		}
+		assertNotIndexed(t, webhookID)
+	})
+
+	t.Run("SetCursor (job in the stream)", func(t *testing.T) {
+		const webhookID = "streamed-webhook"
+		if _, err := stream.Activate(ctx, NewWebhookStreamMsg(webhookID, 3, false)); err != nil {
+			t.Fatal(err)
+		}
+
+		// The new height is stored as an override since the job can't be moved
+		if moved, err := stream.SetCursor(ctx, webhookID, 7); err != nil {
+			t.Fatal(err)
+		} else if moved {
+			t.Fatal("Expected the job not to be moved")
+		}
+		if height, exists, err := stream.GetCursorOverride(ctx, webhookID); err != nil {
+			t.Fatal(err)
+		} else if !exists || height != 7 {
+			t.Fatalf("Expected an override at height 7 but got %d (exists? %v)", height, exists)
+		}
+
+		// An override that was moved again in the meantime is not cleared
+		msg := claimJob(t)
+		if err := stream.ApplyCursorOverride(ctx, msg, 6); err != nil {
+			t.Fatal(err)
+		}
+		if _, exists, err := stream.GetCursorOverride(ctx, webhookID); err != nil {
+			t.Fatal(err)
+		} else if !exists {
+			t.Fatal("Expected the override to be kept")
+		}
+
+		// An override that was applied is cleared in the same operation that reschedules the job
+		msg = claimJob(t)
+		if msg.Data.BlockHeight != 6 {
+			t.Fatalf("Expected the job to be rescheduled at height 6 but got: %+v", msg.Data)
+		}
+		if err := stream.ApplyCursorOverride(ctx, msg, 7); err != nil {
+			t.Fatal(err)
+		}
+		if _, exists, err := stream.GetCursorOverride(ctx, webhookID); err != nil {
+			t.Fatal(err)
+		} else if exists {
+			t.Fatal("Expected the override to be cleared")
+		}
+		if isPending, err := stream.IsPending(ctx, msg.ID); err != nil {
+			t.Fatal(err)
+		} else if isPending {
+			t.Fatal("Expected the job to be acknowledged")
+		}
+
+		msg = claimJob(t)
+		if msg.Data.BlockHeight != 7 {
+			t.Fatalf("Expected the job to be rescheduled at height 7 but got: %+v", msg.Data)
+		}
+		if err := stream.XAckDel(ctx, msg, nil); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("GetCursorOverride (no override)", func(t *testing.T) {
+		if _, exists, err := stream.GetCursorOverride(ctx, "unknown-webhook"); err != nil {
+			t.Fatal(err)
+		} else if exists {
+			t.Fatal("Expected no override")
+		}
+	})
+
+	t.Run("Replay", func(t *testing.T) {
+		const webhookID = "replayed-webhook"
+		if _, err := stream.Replay(ctx, webhookID, 1, 2); !errors.Is(err, ErrWebhookNotActive) {
+			t.Fatalf("Expected ErrWebhookNotActive but got: %v", err)
+		}
+		if _, err := stream.Activate(ctx, NewWebhookStreamMsg(webhookID, 0, true)); err != nil {
+			t.Fatal(err)
+		}
+
+		// Ranges that are backwards or go past the latest block are rejected
+		if _, err := stream.Replay(ctx, webhookID, 5, 4); !errors.Is(err, ErrHeightOutOfRange) {
+			t.Fatalf("Expected ErrHeightOutOfRange but got: %v", err)
+		}
+		if _, err := stream.Replay(ctx, webhookID, 5, latestHeight+1); !errors.Is(err, ErrHeightOutOfRange) {
+			t.Fatalf("Expected ErrHeightOutOfRange but got: %v", err)
+		}
+
+		// The replay job is added to the stream
+		replayID, err := stream.Replay(ctx, webhookID, 5, latestHeight)
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg := claimJob(t)
+		if msg.Data.ReplayID != replayID || msg.Data.BlockHeight != 5 || msg.Data.ReplayUntil != latestHeight {
+			t.Fatalf("Unexpected job: %+v", msg.Data)
+		}
+
+		// The webhook's regular job is not affected
+		if count, err := client.ZCard(ctx, GetPendingSetKey(stream.ShardNum)).Result(); err != nil {
+			t.Fatal(err)
+		} else if count != 1 {
+			t.Fatalf("Expected the regular job to stay in the pending set but it has %d job(s)", count)
+		}
+	})
+}
@@ -0,0 +1,107 @@
+package streams
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const WebhookLeaseExtension = 10 * time.Second
+
+var ErrWebhookLeaseLost = errors.New("lease on webhook was lost")
+
+// Defines a lua function that checks if a job is still covered by the lease it was handled
+// under. Jobs that were not handled under a lease have a token of 0 and are not checked.
+const checkLeaseScript = `
+    local function check_lease(lease_key, lease_token)
+      return lease_token == "0" or redis.call("GET", lease_key) == lease_token
+    end
+`
+
+// WebhookLease gives a single consumer the exclusive right to handle the jobs of a webhook.
+// Without it, a job that is redelivered while the original consumer is still working on it
+// (e.g. after a restart) could be handled twice at the same time, and ranges could end up
+// being delivered out of order.
+//
+// Each lease has a fencing token that is larger than the token of every lease that came
+// before it. The token is stored on the job (see WebhookStreamMsgData.LeaseToken), and the
+// scripts that acknowledge or reschedule the job (XAckDel, Delay, Park, Hold, and Drop) check it
+// against the current lease. A consumer whose lease expired can therefore not move the job
+// once another consumer has taken over. The scripts also write nothing if the job was
+// already acknowledged, since a job that was handled once must not be rescheduled again.
+type WebhookLease struct {
+	WebhookID string
+	Token     int64
+}
+
+// Tries to acquire the lease on a webhook for the given duration. If another consumer holds
+// the lease, then a nil lease is returned along with the time until the lease expires.
+func (stream *WebhookStream) AcquireLease(ctx context.Context, webhookID string, duration time.Duration) (*WebhookLease, time.Duration, error) {
+	// This script performs the following:
+	//
+	//  If the lease is held, then the time until it expires is returned. Otherwise, the
+	//  fencing token is incremented and the lease is stored under the new token. Fencing
+	//  tokens start from 1 so that 0 can mean that a job is not handled under a lease.
+	//
+	script := redis.NewScript(`
+    local lease_key = KEYS[1]
+    local fence_key = KEYS[2]
+    local duration_ms = ARGV[1]
+
+    if redis.call("EXISTS", lease_key) == 1 then
+      return { 0, redis.call("PTTL", lease_key) }
+    end
+
+    local token = redis.call("INCR", fence_key)
+    redis.call("SET", lease_key, token, "PX", duration_ms)
+    return { token, 0 }
+  `)
+
+	// Executes the script
+	result, err := script.Run(ctx, stream.client,
+		[]string{
+			GetWebhookLeaseKey(stream.ShardNum, webhookID),
+			GetWebhookFenceKey(stream.ShardNum, webhookID),
+		},
+		[]any{
+			duration.Milliseconds(),
+		},
+	).Int64Slice()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Returns how long the caller should wait if the lease is held
+	if result[0] == 0 {
+		return nil, time.Duration(result[1]) * time.Millisecond, nil
+	}
+	return &WebhookLease{WebhookID: webhookID, Token: result[0]}, 0, nil
+}
+
+// Releases a lease if it is still held - a lease that expired and was acquired by another
+// consumer is left untouched
+func (stream *WebhookStream) ReleaseLease(ctx context.Context, lease *WebhookLease) error {
+	script := redis.NewScript(`
+    local lease_key = KEYS[1]
+    local lease_token = ARGV[1]
+
+    if redis.call("GET", lease_key) == lease_token then
+      redis.call("DEL", lease_key)
+    end
+  `)
+
+	// Executes the script
+	if err := script.Run(ctx, stream.client,
+		[]string{
+			GetWebhookLeaseKey(stream.ShardNum, lease.WebhookID),
+		},
+		[]any{
+			lease.Token,
+		},
+	).Err(); err != nil && !errors.Is(err, redis.Nil) {
+		return err
+	}
+	return nil
+}
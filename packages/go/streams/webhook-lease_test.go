@@ -0,0 +1,246 @@
+package streams
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestWebhookLease(t *testing.T) {
+	// Defines helper variables
+	const latestHeight = 10
+	ctx := context.Background()
+	client := newTestRedisCluster(t)
+	stream := NewWebhookStream(client, 0, nil)
+
+	// Creates the consumer group and stores the latest block height
+	if err := client.XGroupCreateMkStream(ctx, stream.Name(), stream.ConsumerGroupName(), "0").Err(); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Set(ctx, GetLatestBlockHeightKey(stream.ShardNum), latestHeight, 0).Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Defines a helper function that activates a webhook and claims its first job
+	claimJob := func(t *testing.T, webhookID string) ParsedStreamMessage[WebhookStreamMsgData] {
+		if _, err := stream.Activate(ctx, NewWebhookStreamMsg(webhookID, 3, false)); err != nil {
+			t.Fatal(err)
+		}
+		result, err := client.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    stream.ConsumerGroupName(),
+			Consumer: "test-consumer",
+			Streams:  []string{stream.Name(), ">"},
+			Count:    1,
+		}).Result()
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, parsedMsgs, err := stream.parseMessages(ctx, result[0].Messages)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsedMsgs[0]
+	}
+
+	// Defines a helper function that acquires the lease on a webhook
+	acquireLease := func(t *testing.T, webhookID string) *WebhookLease {
+		lease, _, err := stream.AcquireLease(ctx, webhookID, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lease == nil {
+			t.Fatalf("Expected the lease on webhook %s to be free", webhookID)
+		}
+		return lease
+	}
+
+	// Defines a helper function that checks that no jobs were written for a webhook
+	assertNoWrites := func(t *testing.T, webhookID string, streamLength int64) {
+		if length, err := client.XLen(ctx, stream.Name()).Result(); err != nil {
+			t.Fatal(err)
+		} else if length != streamLength {
+			t.Fatalf("Expected the stream to have %d job(s) but it has %d", streamLength, length)
+		}
+		for _, key := range []string{GetPendingSetKey(stream.ShardNum), GetDelayedSetKey(stream.ShardNum), GetParkedSetKey(stream.ShardNum)} {
+			if count, err := client.ZCard(ctx, key).Result(); err != nil {
+				t.Fatal(err)
+			} else if count != 0 {
+				t.Fatalf("Expected %s to be empty but it has %d job(s)", key, count)
+			}
+		}
+		if exists, err := client.HExists(ctx, GetJobIndexKey(stream.ShardNum), webhookID).Result(); err != nil {
+			t.Fatal(err)
+		} else if exists {
+			t.Fatalf("Expected webhook %s to have no jobs in the job index", webhookID)
+		}
+	}
+
+	t.Run("ReleaseLease (compare-and-delete)", func(t *testing.T) {
+		const webhookID = "released-webhook"
+		lease := acquireLease(t, webhookID)
+
+		// The lease can't be acquired while it is held
+		if other, wait, err := stream.AcquireLease(ctx, webhookID, time.Minute); err != nil {
+			t.Fatal(err)
+		} else if other != nil || wait <= 0 {
+			t.Fatalf("Expected the lease to be held but got %+v (wait %s)", other, wait)
+		}
+
+		// A lease with a different token doesn't release the current one
+		if err := stream.ReleaseLease(ctx, &WebhookLease{WebhookID: webhookID, Token: lease.Token + 1}); err != nil {
+			t.Fatal(err)
+		}
+		if exists, err := client.Exists(ctx, GetWebhookLeaseKey(stream.ShardNum, webhookID)).Result(); err != nil {
+			t.Fatal(err)
+		} else if exists != 1 {
+			t.Fatal("Expected the lease to be kept")
+		}
+
+		// The holder releases the lease and the next lease gets a larger token
+		if err := stream.ReleaseLease(ctx, lease); err != nil {
+			t.Fatal(err)
+		}
+		if next := acquireLease(t, webhookID); next.Token <= lease.Token {
+			t.Fatalf("Expected a token larger than %d but got %d", lease.Token, next.Token)
+		}
+	})
+
+	t.Run("Stale token", func(t *testing.T) {
+		const webhookID = "stale-webhook"
+		msg := claimJob(t, webhookID)
+		msg.Data.LeaseToken = acquireLease(t, webhookID).Token
+
+		// Simulates the lease expiring and another consumer taking over
+		if err := client.Del(ctx, GetWebhookLeaseKey(stream.ShardNum, webhookID)).Err(); err != nil {
+			t.Fatal(err)
+		}
+		current := acquireLease(t, webhookID)
+
+		// The old consumer can no longer acknowledge or reschedule the job
+		until := time.Now().Add(time.Hour)
+		for name, err := range map[string]error{
+			"XAckDel (no new job)": stream.XAckDel(ctx, msg, nil),
+			"XAckDel (new job)":    stream.XAckDel(ctx, msg, msg.Data.Next(4)),
+			"Delay":                stream.Delay(ctx, msg, msg.Data.Next(4), until),
+			"Park":                 stream.Park(ctx, msg, msg.Data.Next(4), until),
+		} {
+			if !errors.Is(err, ErrWebhookLeaseLost) {
+				t.Fatalf("Expected %s to return ErrWebhookLeaseLost but got: %v", name, err)
+			}
+		}
+		if isPending, err := stream.IsPending(ctx, msg.ID); err != nil {
+			t.Fatal(err)
+		} else if !isPending {
+			t.Fatal("Expected the job to still be pending")
+		}
+		assertNoWrites(t, webhookID, 1)
+
+		// The current holder can acknowledge the job
+		msg.Data.LeaseToken = current.Token
+		if err := stream.XAckDel(ctx, msg, nil); err != nil {
+			t.Fatal(err)
+		}
+		if err := stream.ReleaseLease(ctx, current); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("Drop (stale token)", func(t *testing.T) {
+		const webhookID = "dropped-webhook"
+		msg := claimJob(t, webhookID)
+		msg.Data.LeaseToken = acquireLease(t, webhookID).Token
+
+		// Simulates the lease expiring and another consumer taking over
+		if err := client.Del(ctx, GetWebhookLeaseKey(stream.ShardNum, webhookID)).Err(); err != nil {
+			t.Fatal(err)
+		}
+		current := acquireLease(t, webhookID)
+
+		// The old consumer fails the job with a permanent error but can't drop it
+		if err := stream.Drop(ctx, msg, NewPermanentError(errors.New("simulated failure"))); !errors.Is(err, ErrWebhookLeaseLost) {
+			t.Fatalf("Expected Drop to return ErrWebhookLeaseLost but got: %v", err)
+		}
+		if isPending, err := stream.IsPending(ctx, msg.ID); err != nil {
+			t.Fatal(err)
+		} else if !isPending {
+			t.Fatal("Expected the job to still be pending")
+		}
+		if isMember, err := client.SIsMember(ctx, GetWebhookSetKey(stream.ShardNum), webhookID).Result(); err != nil {
+			t.Fatal(err)
+		} else if !isMember {
+			t.Fatal("Expected the webhook to still be in the webhook set")
+		}
+		if length, err := client.XLen(ctx, stream.DeadLetterStreamName()).Result(); err != nil && !errors.Is(err, redis.Nil) {
+			t.Fatal(err)
+		} else if length != 0 {
+			t.Fatalf("Expected the dead letter stream to be empty but it has %d job(s)", length)
+		}
+
+		// The current holder can drop the job
+		msg.Data.LeaseToken = current.Token
+		if err := stream.Drop(ctx, msg, NewPermanentError(errors.New("simulated failure"))); err != nil {
+			t.Fatal(err)
+		}
+		if length, err := client.XLen(ctx, stream.DeadLetterStreamName()).Result(); err != nil {
+			t.Fatal(err)
+		} else if length != 1 {
+			t.Fatalf("Expected the dead letter stream to have 1 job but it has %d", length)
+		}
+		if isMember, err := client.SIsMember(ctx, GetWebhookSetKey(stream.ShardNum), webhookID).Result(); err != nil {
+			t.Fatal(err)
+		} else if isMember {
+			t.Fatal("Expected the webhook to be removed from the webhook set")
+		}
+		assertNoWrites(t, webhookID, 0)
+		if err := stream.ReleaseLease(ctx, current); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("Reclaimed job that was already acknowledged", func(t *testing.T) {
+		const webhookID = "acked-webhook"
+		msg := claimJob(t, webhookID)
+		msg.Data.LeaseToken = acquireLease(t, webhookID).Token
+
+		// Pauses the webhook while its job is in the stream so that Hold is also covered
+		if err := stream.Pause(ctx, webhookID); err != nil {
+			t.Fatal(err)
+		}
+
+		// The job is acknowledged once
+		if err := stream.XAckDel(ctx, msg, nil); err != nil {
+			t.Fatal(err)
+		}
+		if isPending, err := stream.IsPending(ctx, msg.ID); err != nil {
+			t.Fatal(err)
+		} else if isPending {
+			t.Fatal("Expected the job to be acknowledged")
+		}
+
+		// A copy of the job that was reclaimed by a consumer under the same lease can't
+		// acknowledge or reschedule it again
+		until := time.Now().Add(time.Hour)
+		for name, err := range map[string]error{
+			"XAckDel (no new job)": stream.XAckDel(ctx, msg, nil),
+			"XAckDel (new job)":    stream.XAckDel(ctx, msg, msg.Data.Next(4)),
+			"Delay":                stream.Delay(ctx, msg, msg.Data.Next(4), until),
+			"Park":                 stream.Park(ctx, msg, msg.Data.Next(4), until),
+		} {
+			if !errors.Is(err, ErrWebhookLeaseLost) {
+				t.Fatalf("Expected %s to return ErrWebhookLeaseLost but got: %v", name, err)
+			}
+		}
+		if _, err := stream.Hold(ctx, msg); !errors.Is(err, ErrWebhookLeaseLost) {
+			t.Fatalf("Expected Hold to return ErrWebhookLeaseLost but got: %v", err)
+		}
+		assertNoWrites(t, webhookID, 0)
+		if pausedJob, err := client.HGet(ctx, GetPausedJobsKey(stream.ShardNum), webhookID).Result(); err != nil {
+			t.Fatal(err)
+		} else if pausedJob != "" {
+			t.Fatalf("Expected the paused job to be left untouched but got: %s", pausedJob)
+		}
+	})
+}
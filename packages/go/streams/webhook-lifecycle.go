@@ -0,0 +1,364 @@
+package streams
+
+import (
+	"context"
+	"errors"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Defines a lua function that moves a paused job back into the stream (or the pending set
+// if there are no new blocks for it yet). A job that was paused while it was being processed
+// is stored as an empty string - it is still in the stream so there's nothing to move.
+//
+// NOTE: scripts that use this function must also include jobIndexScript.
+const resumeJobScript = `
+    local function resume_job(latest_block_height_key, pending_set_key, job_index_key, webhook_stream_key, webhook_stream_msg_data_field, job)
+      if job == "" then
+        return
+      end
+
+      local block_height = tonumber(cjson.decode(job)["BlockHeight"])
+      local latest_block_height = redis.call("GET", latest_block_height_key)
+      if latest_block_height ~= false and block_height < tonumber(latest_block_height) then
+        redis.call("XADD", webhook_stream_key, "*", webhook_stream_msg_data_field, job)
+      else
+        redis.call("ZADD", pending_set_key, block_height, job)
+        index_job(job_index_key, job)
+      end
+    end
+`
+
+// Activates webhooks so that they start receiving blocks. Each webhook is identified by its
+// first job (see NewWebhookStreamMsg and NewBackfillStreamMsg), which is only used if the
+// webhook is not already active. Webhooks that are already active are left untouched and
+// paused webhooks are resumed from where they left off. The number of webhooks that were
+// activated or resumed is returned.
+func (stream *WebhookStream) Activate(ctx context.Context, jobs ...*StreamMessage[WebhookStreamMsgData]) (int64, error) {
+	// Exits early if there are no webhooks to activate
+	if len(jobs) == 0 {
+		return 0, nil
+	}
+
+	// This script performs the following:
+	//
+	//  For each webhook, we first check if it was paused. If so, its job is removed
+	//  from the paused jobs and moved back into the stream.
+	//
+	//  Next, if the webhook is not in the webhook set, then it is added to the set and
+	//  its first job is scheduled. New jobs are added to the pending set and start from
+	//  the latest block once the next block arrives. Jobs that start at a given height
+	//  are added to the stream right away if the block already exists. This also covers
+	//  webhooks that were paused while their job was in the stream if the job was trimmed
+	//  from the stream in the meantime.
+	//
+	//  ARGV contains a webhook ID followed by its first job for each webhook.
+	//
+	script := redis.NewScript(jobIndexScript + resumeJobScript + `
+    local webhook_set_key = KEYS[1]
+    local pending_set_key = KEYS[2]
+    local paused_jobs_key = KEYS[3]
+    local latest_block_height_key = KEYS[4]
+    local webhook_stream_key = KEYS[5]
+    local job_index_key = KEYS[6]
+    local webhook_stream_msg_data_field = table.remove(ARGV, 1)
+
+    local activated = 0
+    for i = 1, #ARGV, 2 do
+      local webhook_id = ARGV[i]
+      local paused_job = redis.call("HGET", paused_jobs_key, webhook_id)
+      if paused_job ~= false then
+        redis.call("HDEL", paused_jobs_key, webhook_id)
+        resume_job(latest_block_height_key, pending_set_key, job_index_key, webhook_stream_key, webhook_stream_msg_data_field, paused_job)
+      end
+
+      if redis.call("SADD", webhook_set_key, webhook_id) == 1 then
+        if cjson.decode(ARGV[i + 1])["IsNew"] then
+          redis.call("ZADD", pending_set_key, 0, ARGV[i + 1])
+          index_job(job_index_key, ARGV[i + 1])
+        else
+          resume_job(latest_block_height_key, pending_set_key, job_index_key, webhook_stream_key, webhook_stream_msg_data_field, ARGV[i + 1])
+        end
+        activated = activated + 1
+      elseif paused_job ~= false then
+        activated = activated + 1
+      end
+    end
+
+    return activated
+  `)
+
+	// Pairs each webhook with its first job
+	args := make([]any, 0, 1+2*len(jobs))
+	args = append(args, GetDataField())
+	for _, job := range jobs {
+		args = append(args, job.Data.WebhookID, job)
+	}
+
+	// Executes the script
+	activated, err := script.Run(ctx, stream.client,
+		[]string{
+			GetWebhookSetKey(stream.ShardNum),
+			GetPendingSetKey(stream.ShardNum),
+			GetPausedJobsKey(stream.ShardNum),
+			GetLatestBlockHeightKey(stream.ShardNum),
+			stream.Name(),
+			GetJobIndexKey(stream.ShardNum),
+		},
+		args,
+	).Int64()
+	if err != nil {
+		return 0, err
+	}
+
+	// Trims the stream in case jobs were added to it
+	return activated, stream.Trim(ctx)
+}
+
+// Pauses a webhook. Its job keeps its position so that the webhook picks up where it left
+// off once it is resumed (see Activate and Resume).
+//
+// If the job is resting in the pending, delayed, or parked set, then it is moved into the
+// paused jobs right away. If it is in the stream or claimed by a consumer, then the pause
+// is recorded and the job is moved into the paused jobs the next time a processor picks it
+// up (see Hold). Replay jobs are not affected by a pause.
+func (stream *WebhookStream) Pause(ctx context.Context, webhookID string) error {
+	script := redis.NewScript(jobIndexScript + `
+    local webhook_set_key = KEYS[1]
+    local pending_set_key = KEYS[2]
+    local delayed_set_key = KEYS[3]
+    local parked_set_key = KEYS[4]
+    local paused_jobs_key = KEYS[5]
+    local job_index_key = KEYS[6]
+    local webhook_id = ARGV[1]
+
+    if redis.call("SISMEMBER", webhook_set_key, webhook_id) == 0 then
+      return -1
+    end
+
+    if redis.call("HEXISTS", paused_jobs_key, webhook_id) == 1 then
+      return 0
+    end
+
+    local jobs = find_jobs(job_index_key, { pending_set_key, delayed_set_key, parked_set_key }, webhook_id, false)
+    if #jobs ~= 0 then
+      redis.call("ZREM", jobs[1][1], jobs[1][2])
+      unindex_job(job_index_key, jobs[1][2])
+      redis.call("HSET", paused_jobs_key, webhook_id, jobs[1][2])
+    else
+      redis.call("HSET", paused_jobs_key, webhook_id, "")
+    end
+    return 1
+  `)
+
+	// Executes the script
+	result, err := script.Run(ctx, stream.client,
+		[]string{
+			GetWebhookSetKey(stream.ShardNum),
+			GetPendingSetKey(stream.ShardNum),
+			GetDelayedSetKey(stream.ShardNum),
+			GetParkedSetKey(stream.ShardNum),
+			GetPausedJobsKey(stream.ShardNum),
+			GetJobIndexKey(stream.ShardNum),
+		},
+		[]any{
+			webhookID,
+		},
+	).Int64()
+	if err != nil {
+		return err
+	}
+	if result == -1 {
+		return ErrWebhookNotActive
+	}
+	return nil
+}
+
+// Resumes a paused webhook - false is returned if the webhook was not paused
+func (stream *WebhookStream) Resume(ctx context.Context, webhookID string) (bool, error) {
+	script := redis.NewScript(jobIndexScript + resumeJobScript + `
+    local pending_set_key = KEYS[1]
+    local paused_jobs_key = KEYS[2]
+    local latest_block_height_key = KEYS[3]
+    local webhook_stream_key = KEYS[4]
+    local job_index_key = KEYS[5]
+    local webhook_id = ARGV[1]
+    local webhook_stream_msg_data_field = ARGV[2]
+
+    local paused_job = redis.call("HGET", paused_jobs_key, webhook_id)
+    if paused_job == false then
+      return 0
+    end
+
+    redis.call("HDEL", paused_jobs_key, webhook_id)
+    resume_job(latest_block_height_key, pending_set_key, job_index_key, webhook_stream_key, webhook_stream_msg_data_field, paused_job)
+    return 1
+  `)
+
+	// Executes the script
+	resumed, err := script.Run(ctx, stream.client,
+		[]string{
+			GetPendingSetKey(stream.ShardNum),
+			GetPausedJobsKey(stream.ShardNum),
+			GetLatestBlockHeightKey(stream.ShardNum),
+			stream.Name(),
+			GetJobIndexKey(stream.ShardNum),
+		},
+		[]any{
+			webhookID,
+			GetDataField(),
+		},
+	).Int64()
+	if err != nil {
+		return false, err
+	}
+
+	// Trims the stream in case the job was added to it
+	return resumed == 1, stream.Trim(ctx)
+}
+
+// Checks if a webhook is paused
+func (stream *WebhookStream) IsPaused(ctx context.Context, webhookID string) (bool, error) {
+	return stream.client.HExists(ctx, GetPausedJobsKey(stream.ShardNum), webhookID).Result()
+}
+
+// Moves a claimed job into the paused jobs if its webhook was paused while the job was in
+// the stream. Returns true if the job was held, in which case the caller should not process
+// it any further.
+func (stream *WebhookStream) Hold(ctx context.Context, msg ParsedStreamMessage[WebhookStreamMsgData]) (bool, error) {
+	// Replay jobs are not affected by a pause
+	if msg.Data.IsReplay() {
+		return false, nil
+	}
+
+	script := redis.NewScript(checkLeaseScript + `
+    local webhook_stream_key = KEYS[1]
+    local paused_jobs_key = KEYS[2]
+    local lease_key = KEYS[3]
+    local webhook_stream_cg = ARGV[1]
+    local webhook_stream_msg_id = ARGV[2]
+    local webhook_id = ARGV[3]
+    local webhook_stream_msg_data = ARGV[4]
+    local lease_token = ARGV[5]
+
+    if redis.call("HGET", paused_jobs_key, webhook_id) ~= "" then
+      return 0
+    end
+
+    if not check_lease(lease_key, lease_token) then
+      return -1
+    end
+
+    if redis.call("XACK", webhook_stream_key, webhook_stream_cg, webhook_stream_msg_id) == 0 then
+      return -1
+    end
+    redis.call("XDEL", webhook_stream_key, webhook_stream_msg_id)
+    redis.call("HSET", paused_jobs_key, webhook_id, webhook_stream_msg_data)
+    return 1
+  `)
+
+	// Executes the script
+	held, err := script.Run(ctx, stream.client,
+		[]string{
+			stream.Name(),
+			GetPausedJobsKey(stream.ShardNum),
+			GetWebhookLeaseKey(stream.ShardNum, msg.Data.WebhookID),
+		},
+		[]any{
+			stream.ConsumerGroupName(),
+			msg.ID,
+			msg.Data.WebhookID,
+			&StreamMessage[WebhookStreamMsgData]{Data: msg.Data},
+			msg.Data.LeaseToken,
+		},
+	).Int64()
+	if err != nil {
+		return false, err
+	}
+	if held == -1 {
+		return false, ErrWebhookLeaseLost
+	}
+	return held == 1, nil
+}
+
+// Removes every trace of a webhook from the shard. Jobs that are in the stream or claimed by
+// a consumer can't be removed here - processors discard them once they see that the webhook
+// no longer exists. The fencing token is kept so that the tokens of a webhook keep growing if
+// it is activated again, otherwise a consumer that still holds a job from before the removal
+// could end up with the same token as the current lease.
+func (stream *WebhookStream) Remove(ctx context.Context, webhookID string) error {
+	script := redis.NewScript(jobIndexScript + `
+    local webhook_set_key = KEYS[1]
+    local pending_set_key = KEYS[2]
+    local delayed_set_key = KEYS[3]
+    local parked_set_key = KEYS[4]
+    local paused_jobs_key = KEYS[5]
+    local cursor_override_key = KEYS[6]
+    local circuit_breaker_key = KEYS[7]
+    local delivery_ledger_key = KEYS[8]
+    local lease_key = KEYS[9]
+    local delivery_state_key = KEYS[10]
+    local job_index_key = KEYS[11]
+    local webhook_id = ARGV[1]
+
+    local jobs = find_jobs(job_index_key, { pending_set_key, delayed_set_key, parked_set_key }, webhook_id, true)
+    for _, job in ipairs(jobs) do
+      redis.call("ZREM", job[1], job[2])
+    end
+    redis.call("HDEL", job_index_key, webhook_id)
+
+    redis.call("SREM", webhook_set_key, webhook_id)
+    redis.call("HDEL", paused_jobs_key, webhook_id)
+    redis.call("DEL", cursor_override_key, circuit_breaker_key, delivery_ledger_key, lease_key, delivery_state_key)
+  `)
+
+	// Executes the script
+	if err := script.Run(ctx, stream.client,
+		[]string{
+			GetWebhookSetKey(stream.ShardNum),
+			GetPendingSetKey(stream.ShardNum),
+			GetDelayedSetKey(stream.ShardNum),
+			GetParkedSetKey(stream.ShardNum),
+			GetPausedJobsKey(stream.ShardNum),
+			GetCursorOverrideKey(stream.ShardNum, webhookID),
+			GetCircuitBreakerKey(stream.ShardNum, webhookID),
+			GetDeliveryLedgerKey(stream.ShardNum, webhookID),
+			GetWebhookLeaseKey(stream.ShardNum, webhookID),
+			GetDeliveryStateKey(stream.ShardNum, webhookID),
+			GetJobIndexKey(stream.ShardNum),
+		},
+		[]any{
+			webhookID,
+		},
+	).Err(); err != nil && !errors.Is(err, redis.Nil) {
+		return err
+	}
+	return nil
+}
+
+// Gets every webhook that is active in this shard along with whether or not it is paused
+func (stream *WebhookStream) GetWebhookStates(ctx context.Context) (map[string]bool, error) {
+	states := map[string]bool{}
+
+	// Gets the webhooks in the webhook set
+	webhooks := stream.client.SScan(ctx, GetWebhookSetKey(stream.ShardNum), 0, "", 1000).Iterator()
+	for webhooks.Next(ctx) {
+		states[webhooks.Val()] = false
+	}
+	if err := webhooks.Err(); err != nil {
+		return nil, err
+	}
+
+	// Marks the webhooks that are paused (the iterator alternates between fields and values)
+	pausedJobs := stream.client.HScan(ctx, GetPausedJobsKey(stream.ShardNum), 0, "", 1000).Iterator()
+	for i := 0; pausedJobs.Next(ctx); i++ {
+		if i%2 == 0 {
+			states[pausedJobs.Val()] = true
+		}
+	}
+	if err := pausedJobs.Err(); err != nil {
+		return nil, err
+	}
+
+	return states, nil
+}
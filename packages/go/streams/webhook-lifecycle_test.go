@@ -0,0 +1,270 @@
+package streams
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestWebhookLifecycle(t *testing.T) {
+	// Defines helper variables
+	const latestHeight = 10
+	ctx := context.Background()
+	client := newTestRedisCluster(t)
+	stream := NewWebhookStream(client, 0, nil)
+
+	// Creates the consumer group and stores the latest block height
+	if err := client.XGroupCreateMkStream(ctx, stream.Name(), stream.ConsumerGroupName(), "0").Err(); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Set(ctx, GetLatestBlockHeightKey(stream.ShardNum), latestHeight, 0).Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Defines a helper function that claims the next job in the stream
+	claimJob := func(t *testing.T) ParsedStreamMessage[WebhookStreamMsgData] {
+		result, err := client.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    stream.ConsumerGroupName(),
+			Consumer: "test-consumer",
+			Streams:  []string{stream.Name(), ">"},
+			Count:    1,
+		}).Result()
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, parsedMsgs, err := stream.parseMessages(ctx, result[0].Messages)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsedMsgs[0]
+	}
+
+	// Defines a helper function that gets the jobs in the pending set
+	getPendingJobs := func(t *testing.T) []redis.Z {
+		jobs, err := client.ZRangeWithScores(ctx, GetPendingSetKey(stream.ShardNum), 0, -1).Result()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return jobs
+	}
+
+	// Defines a helper function that gets the paused job of a webhook
+	getPausedJob := func(t *testing.T, webhookID string) WebhookStreamMsgData {
+		var job WebhookStreamMsgData
+		if rawJob, err := client.HGet(ctx, GetPausedJobsKey(stream.ShardNum), webhookID).Result(); err != nil {
+			t.Fatal(err)
+		} else if err := json.Unmarshal([]byte(rawJob), &job); err != nil {
+			t.Fatal(err)
+		}
+		return job
+	}
+
+	t.Run("Activate is idempotent", func(t *testing.T) {
+		const webhookID = "idempotent-webhook"
+		for i, expected := range []int64{1, 0} {
+			if activated, err := stream.Activate(ctx, NewWebhookStreamMsg(webhookID, 0, true)); err != nil {
+				t.Fatal(err)
+			} else if activated != expected {
+				t.Fatalf("Expected activation %d to return %d but got %d", i+1, expected, activated)
+			}
+		}
+
+		// A different first job is ignored once the webhook is active
+		if activated, err := stream.Activate(ctx, NewWebhookStreamMsg(webhookID, 5, false)); err != nil {
+			t.Fatal(err)
+		} else if activated != 0 {
+			t.Fatalf("Expected 0 webhooks to be activated but got %d", activated)
+		}
+		if jobs := getPendingJobs(t); len(jobs) != 1 || jobs[0].Score != 0 {
+			t.Fatalf("Expected 1 new job in the pending set but got: %v", jobs)
+		}
+		if length, err := client.XLen(ctx, stream.Name()).Result(); err != nil {
+			t.Fatal(err)
+		} else if length != 0 {
+			t.Fatalf("Expected the stream to be empty but it has %d job(s)", length)
+		}
+
+		if err := stream.Remove(ctx, webhookID); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("Pause and resume (job in the pending set)", func(t *testing.T) {
+		const webhookID = "pending-webhook"
+		if _, err := stream.Activate(ctx, NewWebhookStreamMsg(webhookID, latestHeight+5, false)); err != nil {
+			t.Fatal(err)
+		}
+
+		// The job is moved out of the pending set right away
+		if err := stream.Pause(ctx, webhookID); err != nil {
+			t.Fatal(err)
+		}
+		if jobs := getPendingJobs(t); len(jobs) != 0 {
+			t.Fatalf("Expected the pending set to be empty but got: %v", jobs)
+		}
+		if job := getPausedJob(t, webhookID); job.BlockHeight != latestHeight+5 {
+			t.Fatalf("Expected the paused job to be at height %d but got: %+v", latestHeight+5, job)
+		}
+
+		// Pausing again keeps the paused job
+		if err := stream.Pause(ctx, webhookID); err != nil {
+			t.Fatal(err)
+		}
+		if job := getPausedJob(t, webhookID); job.BlockHeight != latestHeight+5 {
+			t.Fatalf("Expected the paused job to be at height %d but got: %+v", latestHeight+5, job)
+		}
+
+		// The job goes back to the pending set at the same height
+		for i, expected := range []bool{true, false} {
+			if resumed, err := stream.Resume(ctx, webhookID); err != nil {
+				t.Fatal(err)
+			} else if resumed != expected {
+				t.Fatalf("Expected resume %d to return %v but got %v", i+1, expected, resumed)
+			}
+		}
+		if jobs := getPendingJobs(t); len(jobs) != 1 || jobs[0].Score != latestHeight+5 {
+			t.Fatalf("Expected 1 pending job at height %d but got: %v", latestHeight+5, jobs)
+		}
+
+		// Activating a paused webhook also resumes it from where it left off
+		if err := stream.Pause(ctx, webhookID); err != nil {
+			t.Fatal(err)
+		}
+		if activated, err := stream.Activate(ctx, NewWebhookStreamMsg(webhookID, 0, true)); err != nil {
+			t.Fatal(err)
+		} else if activated != 1 {
+			t.Fatalf("Expected 1 webhook to be resumed but got %d", activated)
+		}
+		if jobs := getPendingJobs(t); len(jobs) != 1 || jobs[0].Score != latestHeight+5 {
+			t.Fatalf("Expected 1 pending job at height %d but got: %v", latestHeight+5, jobs)
+		}
+
+		if err := stream.Remove(ctx, webhookID); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("Pause and resume (job in the stream)", func(t *testing.T) {
+		const webhookID = "streamed-webhook"
+		if _, err := stream.Activate(ctx, NewWebhookStreamMsg(webhookID, 3, false)); err != nil {
+			t.Fatal(err)
+		}
+		if err := stream.Pause(ctx, webhookID); err != nil {
+			t.Fatal(err)
+		}
+
+		// The job is held once it is claimed
+		msg := claimJob(t)
+		if held, err := stream.Hold(ctx, msg); err != nil {
+			t.Fatal(err)
+		} else if !held {
+			t.Fatal("Expected the job to be held")
+		}
+		if job := getPausedJob(t, webhookID); job.BlockHeight != 3 {
+			t.Fatalf("Expected the paused job to be at height 3 but got: %+v", job)
+		}
+
+		// The job goes back into the stream at the same height
+		if resumed, err := stream.Resume(ctx, webhookID); err != nil {
+			t.Fatal(err)
+		} else if !resumed {
+			t.Fatal("Expected the webhook to be resumed")
+		}
+		msg = claimJob(t)
+		if msg.Data.WebhookID != webhookID || msg.Data.BlockHeight != 3 {
+			t.Fatalf("Unexpected job: %+v", msg.Data)
+		}
+
+		// A job whose webhook is not paused is not held
+		if held, err := stream.Hold(ctx, msg); err != nil {
+			t.Fatal(err)
+		} else if held {
+			t.Fatal("Expected the job not to be held")
+		}
+		if err := stream.XAckDel(ctx, msg, nil); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("Remove clears every set", func(t *testing.T) {
+		const webhookID = "removed-webhook"
+		if _, err := stream.Activate(ctx, NewWebhookStreamMsg(webhookID, 0, true)); err != nil {
+			t.Fatal(err)
+		}
+
+		// Sets replay jobs aside in the parked and delayed sets
+		for _, setAside := range []func(context.Context, ParsedStreamMessage[WebhookStreamMsgData], *StreamMessage[WebhookStreamMsgData], time.Time) error{
+			stream.Park,
+			stream.Delay,
+		} {
+			if _, err := stream.Replay(ctx, webhookID, 1, 2); err != nil {
+				t.Fatal(err)
+			}
+			msg := claimJob(t)
+			if err := setAside(ctx, msg, msg.Data.Next(2), time.Now().Add(time.Hour)); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// Pauses the webhook and stores some state for it
+		if err := stream.Pause(ctx, webhookID); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := stream.SetCursor(ctx, webhookID, 5); err != nil {
+			t.Fatal(err)
+		}
+		stateKeys := []string{
+			GetCursorOverrideKey(stream.ShardNum, webhookID),
+			GetCircuitBreakerKey(stream.ShardNum, webhookID),
+			GetDeliveryLedgerKey(stream.ShardNum, webhookID),
+			GetWebhookLeaseKey(stream.ShardNum, webhookID),
+			GetDeliveryStateKey(stream.ShardNum, webhookID),
+		}
+		for _, key := range append(stateKeys, GetWebhookFenceKey(stream.ShardNum, webhookID)) {
+			if err := client.Set(ctx, key, "1", 0).Err(); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// Removes the webhook
+		if err := stream.Remove(ctx, webhookID); err != nil {
+			t.Fatal(err)
+		}
+
+		// Nothing should be left behind except for the fencing token
+		if isMember, err := client.SIsMember(ctx, GetWebhookSetKey(stream.ShardNum), webhookID).Result(); err != nil {
+			t.Fatal(err)
+		} else if isMember {
+			t.Fatal("Expected the webhook to be removed from the webhook set")
+		}
+		for _, key := range []string{GetPausedJobsKey(stream.ShardNum), GetJobIndexKey(stream.ShardNum)} {
+			if exists, err := client.HExists(ctx, key, webhookID).Result(); err != nil {
+				t.Fatal(err)
+			} else if exists {
+				t.Fatalf("Expected the webhook to be removed from %s", key)
+			}
+		}
+		for _, key := range []string{GetPendingSetKey(stream.ShardNum), GetDelayedSetKey(stream.ShardNum), GetParkedSetKey(stream.ShardNum)} {
+			if count, err := client.ZCard(ctx, key).Result(); err != nil {
+				t.Fatal(err)
+			} else if count != 0 {
+				t.Fatalf("Expected %s to be empty but it has %d job(s)", key, count)
+			}
+		}
+		for _, key := range stateKeys {
+			if count, err := client.Exists(ctx, key).Result(); err != nil {
+				t.Fatal(err)
+			} else if count != 0 {
+				t.Fatalf("Expected %s to be deleted", key)
+			}
+		}
+		if token, err := client.Get(ctx, GetWebhookFenceKey(stream.ShardNum, webhookID)).Result(); err != nil {
+			t.Fatal(err)
+		} else if token != "1" {
+			t.Fatalf("Expected the fencing token to be kept but got: %s", token)
+		}
+	})
+}
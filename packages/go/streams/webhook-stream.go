@@ -3,6 +3,8 @@ package streams
 import (
 	"context"
 	"errors"
+	"log"
+	"time"
 
 	"github.com/redis/go-redis/v9"
 )
@@ -10,6 +12,7 @@ import (
 const (
 	WebhookStreamConsumerGroupName = "webhook-stream-consumer"
 	WebhookStreamName              = "webhook-stream"
+	DelayedSetFlushLimit           = 1000
 )
 
 type (
@@ -17,15 +20,94 @@ type (
 		WebhookID   string
 		BlockHeight uint64
 		IsNew       bool
+		Lingered    bool // true if the job already waited for more blocks to arrive
+
+		// Backfill jobs deliver historical blocks to a webhook that was created with a start
+		// height. They are throttled separately from real-time jobs so that they can't starve
+		// them, and they become regular jobs once they've caught up with the chain.
+		Backfill bool `json:",omitempty"`
+
+		// Replay jobs resend a range of blocks once without affecting the webhook's regular
+		// job (see WebhookStream.Replay). They are finished once ReplayUntil is delivered.
+		ReplayID    string `json:",omitempty"`
+		ReplayUntil uint64 `json:",omitempty"`
+
+		// The fencing token of the lease that the job is being handled under (see WebhookLease).
+		// It is never stored with the job.
+		LeaseToken int64 `json:"-"`
 	}
 
 	WebhookStream struct {
 		*RedisStream[WebhookStreamMsgData]
 		client   *redis.ClusterClient
 		ShardNum int32
+
+		// Called with the IDs of the webhooks whose jobs were dropped (see OnDrop)
+		onDropped func(ctx context.Context, webhookIDs []string, logger *log.Logger) error
 	}
 )
 
+// Defines lua functions that maintain an index of the jobs which are resting in the pending,
+// delayed, and parked sets. The index maps each webhook to the jobs it has in these sets (a
+// JSON encoded list, since a webhook may have replay jobs alongside its regular job) so that
+// they can be found without scanning the sets. Every script that adds a job to one of these
+// sets or removes a job from one of them must update the index in the same operation.
+//
+// find_jobs returns each job as a pair of its set key and its member. Replay jobs are only
+// included if include_replays is true.
+const jobIndexScript = `
+    local function index_job(job_index_key, job)
+      local webhook_id = cjson.decode(job)["WebhookID"]
+      local entry = redis.call("HGET", job_index_key, webhook_id)
+      local jobs = entry and cjson.decode(entry) or {}
+      for _, indexed_job in ipairs(jobs) do
+        if indexed_job == job then
+          return
+        end
+      end
+      table.insert(jobs, job)
+      redis.call("HSET", job_index_key, webhook_id, cjson.encode(jobs))
+    end
+
+    local function unindex_job(job_index_key, job)
+      local webhook_id = cjson.decode(job)["WebhookID"]
+      local entry = redis.call("HGET", job_index_key, webhook_id)
+      if entry == false then
+        return
+      end
+      local jobs = {}
+      for _, indexed_job in ipairs(cjson.decode(entry)) do
+        if indexed_job ~= job then
+          table.insert(jobs, indexed_job)
+        end
+      end
+      if #jobs == 0 then
+        redis.call("HDEL", job_index_key, webhook_id)
+      else
+        redis.call("HSET", job_index_key, webhook_id, cjson.encode(jobs))
+      end
+    end
+
+    local function find_jobs(job_index_key, set_keys, webhook_id, include_replays)
+      local found = {}
+      local entry = redis.call("HGET", job_index_key, webhook_id)
+      if entry == false then
+        return found
+      end
+      for _, job in ipairs(cjson.decode(entry)) do
+        if include_replays or cjson.decode(job)["ReplayID"] == nil then
+          for _, set_key in ipairs(set_keys) do
+            if redis.call("ZSCORE", set_key, job) ~= false then
+              table.insert(found, { set_key, job })
+              break
+            end
+          end
+        end
+      end
+      return found
+    end
+`
+
 func NewWebhookStreamMsg(webhookID string, blockHeight uint64, isNew bool) *StreamMessage[WebhookStreamMsgData] {
 	return &StreamMessage[WebhookStreamMsgData]{
 		Data: WebhookStreamMsgData{
@@ -36,18 +118,90 @@ func NewWebhookStreamMsg(webhookID string, blockHeight uint64, isNew bool) *Stre
 	}
 }
 
-func NewWebhookStream(client *redis.ClusterClient, shardID int32) *WebhookStream {
+func (data WebhookStreamMsgData) IsReplay() bool {
+	return data.ReplayID != ""
+}
+
+// Creates the first job of a webhook that delivers blocks starting at the given height
+func NewBackfillStreamMsg(webhookID string, startHeight uint64) *StreamMessage[WebhookStreamMsgData] {
+	msg := NewWebhookStreamMsg(webhookID, startHeight, false)
+	msg.Data.Backfill = true
+	return msg
+}
+
+// Creates the job that continues where this one left off (replay jobs remain replay jobs
+// and backfill jobs remain backfill jobs)
+func (data WebhookStreamMsgData) Next(blockHeight uint64) *StreamMessage[WebhookStreamMsgData] {
+	return &StreamMessage[WebhookStreamMsgData]{
+		Data: WebhookStreamMsgData{
+			WebhookID:   data.WebhookID,
+			BlockHeight: blockHeight,
+			Backfill:    data.Backfill,
+			ReplayID:    data.ReplayID,
+			ReplayUntil: data.ReplayUntil,
+		},
+	}
+}
+
+// NOTE: capping a webhook stream with the MAXLEN trimming strategy may evict jobs that
+// have not been processed yet, and a webhook whose job is evicted will stop receiving
+// blocks. The MINID trimming strategy only evicts jobs that have been acknowledged.
+//
+// Jobs are added to webhook streams by lua scripts which always encode them as JSON, so
+// the codec option has no effect here.
+func NewWebhookStream(client *redis.ClusterClient, shardID int32, opts *RedisStreamOpts) *WebhookStream {
 	redisStream := NewRedisStream[WebhookStreamMsgData](
 		client,
 		GetStreamKey(shardID, WebhookStreamName),
 		WebhookStreamConsumerGroupName,
+		opts,
 	)
 
-	return &WebhookStream{
-		redisStream,
-		client,
-		shardID,
+	webhookStream := &WebhookStream{
+		RedisStream: redisStream,
+		client:      client,
+		ShardNum:    shardID,
+	}
+
+	// A webhook whose job was dropped no longer has a job in this shard, so it is
+	// removed from the webhook set which allows it to be activated again later
+	redisStream.onDrop = webhookStream.removeWebhooks
+	return webhookStream
+}
+
+// Registers a function that is called with the IDs of the webhooks whose jobs were dropped
+// because of a permanent or poison error. These webhooks no longer have a job in this shard,
+// so the function should make sure that they are not activated again automatically (e.g.
+// by marking them as inactive in the database). The function is also given the stream's
+// logger so that it can report errors that shouldn't stop the stream.
+func (stream *WebhookStream) OnDrop(onDropped func(ctx context.Context, webhookIDs []string, logger *log.Logger) error) {
+	stream.onDropped = onDropped
+}
+
+func (stream *WebhookStream) removeWebhooks(ctx context.Context, msgs []ParsedStreamMessage[WebhookStreamMsgData]) error {
+	webhookIDs := make([]string, 0, len(msgs))
+	for _, msg := range msgs {
+		// Dropping a replay job does not affect the webhook's regular job
+		if !msg.Data.IsReplay() {
+			webhookIDs = append(webhookIDs, msg.Data.WebhookID)
+		}
+	}
+	if len(webhookIDs) == 0 {
+		return nil
+	}
+
+	members := make([]any, len(webhookIDs))
+	for i, webhookID := range webhookIDs {
+		members[i] = webhookID
+	}
+	if err := stream.client.SRem(ctx, GetWebhookSetKey(stream.ShardNum), members...).Err(); err != nil {
+		return err
+	}
+
+	if stream.onDropped != nil {
+		return stream.onDropped(ctx, webhookIDs, stream.logger)
 	}
+	return nil
 }
 
 func (stream *WebhookStream) Flush(
@@ -78,10 +232,11 @@ func (stream *WebhookStream) Flush(
 	// will produce the same results. This script will always add webhooks
 	// with the smallest block height to the stream first.
 	//
-	script := redis.NewScript(`
+	script := redis.NewScript(jobIndexScript + `
     local latest_block_height_key = KEYS[1]
     local pending_set_key = KEYS[2]
     local webhook_stream_key = KEYS[3]
+    local job_index_key = KEYS[4]
     local webhook_stream_msg_data_field = ARGV[1]
     local latest_block_height = tonumber(ARGV[2])
 
@@ -98,6 +253,7 @@ func (stream *WebhookStream) Flush(
         if #elem ~= 2 then
           return
         else
+          unindex_job(job_index_key, elem[1])
           redis.call("XADD", webhook_stream_key, "*", webhook_stream_msg_data_field, elem[1])
         end
       end
@@ -114,6 +270,7 @@ func (stream *WebhookStream) Flush(
       end
 
       redis.call("ZPOPMIN", pending_set_key)
+      unindex_job(job_index_key, elems[1])
       redis.call("XADD", webhook_stream_key, "*", webhook_stream_msg_data_field, elems[1])
     end
   `)
@@ -123,6 +280,7 @@ func (stream *WebhookStream) Flush(
 			GetLatestBlockHeightKey(stream.ShardNum),
 			GetPendingSetKey(stream.ShardNum),
 			stream.Name(),
+			GetJobIndexKey(stream.ShardNum),
 		},
 		[]any{
 			GetDataField(),
@@ -130,9 +288,10 @@ func (stream *WebhookStream) Flush(
 		},
 	).Err(); err != nil && !errors.Is(err, redis.Nil) {
 		return err
-	} else {
-		return nil
 	}
+
+	// Trims the stream now that new jobs may have been added to it
+	return stream.Trim(ctx)
 }
 
 func (stream *WebhookStream) XAckDel(
@@ -142,82 +301,368 @@ func (stream *WebhookStream) XAckDel(
 ) error {
 	if newMsg == nil {
 		// Acknowledges the job, deletes it from the stream, and deletes it from the
-		// webhook set in one atomic operation
-		ackScript := redis.NewScript(`
+		// webhook set in one atomic operation (replay jobs are not in the webhook set)
+		ackScript := redis.NewScript(checkLeaseScript + `
       local webhook_stream_key = KEYS[1]
       local webhook_set_key = KEYS[2]
+      local lease_key = KEYS[3]
       local webhook_stream_cg = ARGV[1]
       local webhook_stream_old_msg_id = ARGV[2]
       local webhook_id = ARGV[3]
+      local is_replay = ARGV[4] == "1"
+      local lease_token = ARGV[5]
 
-      redis.call("XACK", webhook_stream_key, webhook_stream_cg, webhook_stream_old_msg_id)
+      if not check_lease(lease_key, lease_token) then
+        return 0
+      end
+
+      if redis.call("XACK", webhook_stream_key, webhook_stream_cg, webhook_stream_old_msg_id) == 0 then
+        return 0
+      end
       redis.call("XDEL", webhook_stream_key, webhook_stream_old_msg_id)
-      redis.call("SREM", webhook_set_key, webhook_id)
+      if not is_replay then
+        redis.call("SREM", webhook_set_key, webhook_id)
+      end
+      return 1
     `)
 
 		// Executes the script
-		if err := ackScript.Run(ctx, stream.client,
+		acked, err := ackScript.Run(ctx, stream.client,
 			[]string{
 				stream.Name(),
 				GetWebhookSetKey(stream.ShardNum),
+				GetWebhookLeaseKey(stream.ShardNum, oldMsg.Data.WebhookID),
 			},
 			[]any{
 				stream.ConsumerGroupName(),
 				oldMsg.ID,
 				oldMsg.Data.WebhookID,
+				oldMsg.Data.IsReplay(),
+				oldMsg.Data.LeaseToken,
 			},
-		).Err(); err != nil && !errors.Is(err, redis.Nil) {
+		).Int64()
+		if err != nil {
 			return err
-		} else {
-			return nil
 		}
+		if acked == 0 {
+			return ErrWebhookLeaseLost
+		}
+		return nil
 	} else {
-		// Acknowledges the job, deletes it from the stream, and either reschedules
-		// the job or adds it to the pending set in one atomic operation
-		ackScript := redis.NewScript(`
-      local latest_block_height_key = KEYS[1]
-      local pending_set_key = KEYS[2]
-      local webhook_stream_key = KEYS[3]
-      local webhook_stream_cg = ARGV[1]
-      local webhook_stream_msg_data_field = ARGV[2]
-      local webhook_stream_old_msg_id = ARGV[3]
-      local new_block_height = tonumber(ARGV[4])
-      local webhook_stream_new_msg_data = ARGV[5]
+		return stream.reschedule(ctx, oldMsg, newMsg, "")
+	}
+}
 
-      redis.call("XACK", webhook_stream_key, webhook_stream_cg, webhook_stream_old_msg_id)
-      redis.call("XDEL", webhook_stream_key, webhook_stream_old_msg_id)
+// Acknowledges the job, deletes it from the stream, and either reschedules the job or adds
+// it to the pending set in one atomic operation. If a cursor override height is given, then
+// the webhook's cursor override is also cleared as long as it still has that height (it
+// may have been moved again in the meantime, in which case it still needs to be applied).
+func (stream *WebhookStream) reschedule(
+	ctx context.Context,
+	oldMsg ParsedStreamMessage[WebhookStreamMsgData],
+	newMsg *StreamMessage[WebhookStreamMsgData],
+	cursorOverrideHeight string,
+) error {
+	ackScript := redis.NewScript(checkLeaseScript + jobIndexScript + `
+    local latest_block_height_key = KEYS[1]
+    local pending_set_key = KEYS[2]
+    local webhook_stream_key = KEYS[3]
+    local lease_key = KEYS[4]
+    local job_index_key = KEYS[5]
+    local cursor_override_key = KEYS[6]
+    local webhook_stream_cg = ARGV[1]
+    local webhook_stream_msg_data_field = ARGV[2]
+    local webhook_stream_old_msg_id = ARGV[3]
+    local new_block_height = tonumber(ARGV[4])
+    local webhook_stream_new_msg_data = ARGV[5]
+    local lease_token = ARGV[6]
+    local cursor_override_height = ARGV[7]
 
-      local latest_block_height = redis.call("GET", latest_block_height_key)
-      if latest_block_height == false then
-        redis.call("ZADD", pending_set_key, new_block_height, webhook_stream_new_msg_data)
-        return
-      end
+    if not check_lease(lease_key, lease_token) then
+      return 0
+    end
 
-      if new_block_height >= tonumber(latest_block_height) then
-        redis.call("ZADD", pending_set_key, new_block_height, webhook_stream_new_msg_data)
-      else
-        redis.call("XADD", webhook_stream_key, "*", webhook_stream_msg_data_field, webhook_stream_new_msg_data)
-      end
-    `)
+    if redis.call("XACK", webhook_stream_key, webhook_stream_cg, webhook_stream_old_msg_id) == 0 then
+      return 0
+    end
+    redis.call("XDEL", webhook_stream_key, webhook_stream_old_msg_id)
 
-		// Executes the script
-		if err := ackScript.Run(ctx, stream.client,
-			[]string{
-				GetLatestBlockHeightKey(stream.ShardNum),
-				GetPendingSetKey(stream.ShardNum),
-				stream.Name(),
-			},
-			[]any{
-				stream.ConsumerGroupName(),
-				GetDataField(),
-				oldMsg.ID,
-				newMsg.Data.BlockHeight,
-				newMsg,
-			},
-		).Err(); err != nil && !errors.Is(err, redis.Nil) {
-			return err
-		} else {
-			return nil
+    if cursor_override_height ~= "" and redis.call("GET", cursor_override_key) == cursor_override_height then
+      redis.call("DEL", cursor_override_key)
+    end
+
+    local latest_block_height = redis.call("GET", latest_block_height_key)
+    if latest_block_height == false then
+      redis.call("ZADD", pending_set_key, new_block_height, webhook_stream_new_msg_data)
+      index_job(job_index_key, webhook_stream_new_msg_data)
+      return 1
+    end
+
+    if new_block_height >= tonumber(latest_block_height) then
+      redis.call("ZADD", pending_set_key, new_block_height, webhook_stream_new_msg_data)
+      index_job(job_index_key, webhook_stream_new_msg_data)
+    else
+      redis.call("XADD", webhook_stream_key, "*", webhook_stream_msg_data_field, webhook_stream_new_msg_data)
+    end
+    return 1
+  `)
+
+	// Executes the script
+	acked, err := ackScript.Run(ctx, stream.client,
+		[]string{
+			GetLatestBlockHeightKey(stream.ShardNum),
+			GetPendingSetKey(stream.ShardNum),
+			stream.Name(),
+			GetWebhookLeaseKey(stream.ShardNum, oldMsg.Data.WebhookID),
+			GetJobIndexKey(stream.ShardNum),
+			GetCursorOverrideKey(stream.ShardNum, oldMsg.Data.WebhookID),
+		},
+		[]any{
+			stream.ConsumerGroupName(),
+			GetDataField(),
+			oldMsg.ID,
+			newMsg.Data.BlockHeight,
+			newMsg,
+			oldMsg.Data.LeaseToken,
+			cursorOverrideHeight,
+		},
+	).Int64()
+	if err != nil {
+		return err
+	}
+	if acked == 0 {
+		return ErrWebhookLeaseLost
+	}
+
+	// Trims the stream in case the job was rescheduled
+	return stream.Trim(ctx)
+}
+
+// Drops a job that failed with a permanent or poison error (see errors.go) while its lease
+// is still held. Unlike the handling in RedisStream, the job is only dropped if the lease it
+// was handled under is still current, so a consumer whose lease expired can't dead letter a
+// job that another consumer has taken over. Permanent errors copy the job to the dead letter
+// stream and poison errors drop it outright. Either way, the webhook no longer has a job in
+// this shard, so it is removed from the webhook set and reported to the OnDrop function.
+func (stream *WebhookStream) Drop(
+	ctx context.Context,
+	msg ParsedStreamMessage[WebhookStreamMsgData],
+	cause error,
+) error {
+	// This script checks the lease, copies the job to the dead letter stream if
+	// asked to, then acknowledges and deletes the job and removes the webhook from
+	// the webhook set in one atomic operation (replay jobs are not in the webhook set)
+	dropScript := redis.NewScript(checkLeaseScript + `
+    local webhook_stream_key = KEYS[1]
+    local dead_letter_stream_key = KEYS[2]
+    local webhook_set_key = KEYS[3]
+    local lease_key = KEYS[4]
+    local webhook_stream_cg = ARGV[1]
+    local webhook_stream_msg_id = ARGV[2]
+    local webhook_id = ARGV[3]
+    local is_replay = ARGV[4] == "1"
+    local lease_token = ARGV[5]
+    local dead_letter = ARGV[6] == "1"
+    local cause = ARGV[7]
+    local max_len = ARGV[8]
+
+    if not check_lease(lease_key, lease_token) then
+      return 0
+    end
+
+    local entries = redis.call("XRANGE", webhook_stream_key, webhook_stream_msg_id, webhook_stream_msg_id)
+    if redis.call("XACK", webhook_stream_key, webhook_stream_cg, webhook_stream_msg_id) == 0 then
+      return 0
+    end
+    if dead_letter and #entries ~= 0 then
+      redis.call("XADD", dead_letter_stream_key, "MAXLEN", "~", max_len, "*", "MsgID", webhook_stream_msg_id, "Error", cause, unpack(entries[1][2]))
+    end
+    redis.call("XDEL", webhook_stream_key, webhook_stream_msg_id)
+    if not is_replay then
+      redis.call("SREM", webhook_set_key, webhook_id)
+    end
+    return 1
+  `)
+
+	// Executes the script
+	deadLetter := GetErrorKind(cause) == ErrorKindPermanent
+	dropped, err := dropScript.Run(ctx, stream.client,
+		[]string{
+			stream.Name(),
+			stream.DeadLetterStreamName(),
+			GetWebhookSetKey(stream.ShardNum),
+			GetWebhookLeaseKey(stream.ShardNum, msg.Data.WebhookID),
+		},
+		[]any{
+			stream.ConsumerGroupName(),
+			msg.ID,
+			msg.Data.WebhookID,
+			msg.Data.IsReplay(),
+			msg.Data.LeaseToken,
+			deadLetter,
+			cause.Error(),
+			DeadLetterStreamMaxLen,
+		},
+	).Int64()
+	if err != nil {
+		return err
+	}
+	if dropped == 0 {
+		return ErrWebhookLeaseLost
+	}
+
+	// Logs where the job went
+	if deadLetter {
+		stream.logger.Printf("Moved job %s of webhook %s to dead letter stream \"%s\"", msg.ID, msg.Data.WebhookID, stream.DeadLetterStreamName())
+	} else {
+		stream.logger.Printf("Dropped poison job %s of webhook %s", msg.ID, msg.Data.WebhookID)
+	}
+
+	// Dropping a replay job does not affect the webhook's regular job
+	if !msg.Data.IsReplay() && stream.onDropped != nil {
+		return stream.onDropped(ctx, []string{msg.Data.WebhookID}, stream.logger)
+	}
+	return nil
+}
+
+// Acknowledges the job, deletes it from the stream, and adds a new job to the delayed set
+// in one atomic operation. The new job is moved back into the stream by FlushDelayed once
+// the given time has passed.
+func (stream *WebhookStream) Delay(
+	ctx context.Context,
+	oldMsg ParsedStreamMessage[WebhookStreamMsgData],
+	newMsg *StreamMessage[WebhookStreamMsgData],
+	until time.Time,
+) error {
+	return stream.setAside(ctx, GetDelayedSetKey(stream.ShardNum), oldMsg, newMsg, until)
+}
+
+// Moves the jobs in the delayed set whose delay has passed back into the stream (at most
+// DelayedSetFlushLimit at a time). This is safe to call concurrently from multiple
+// processors since the script is atomic.
+func (stream *WebhookStream) FlushDelayed(ctx context.Context, now time.Time) (int64, error) {
+	return stream.flushSet(ctx, GetDelayedSetKey(stream.ShardNum), now)
+}
+
+// Acknowledges the job, deletes it from the stream, and adds a new job to the parked set
+// in one atomic operation. Webhooks whose circuit is open are parked until their next probe
+// is due, at which point FlushParked moves them back into the stream. Unlike the delayed
+// set, the parked set only holds webhooks that are failing.
+func (stream *WebhookStream) Park(
+	ctx context.Context,
+	oldMsg ParsedStreamMessage[WebhookStreamMsgData],
+	newMsg *StreamMessage[WebhookStreamMsgData],
+	until time.Time,
+) error {
+	return stream.setAside(ctx, GetParkedSetKey(stream.ShardNum), oldMsg, newMsg, until)
+}
+
+// Moves the jobs in the parked set whose probe is due back into the stream (at most
+// DelayedSetFlushLimit at a time)
+func (stream *WebhookStream) FlushParked(ctx context.Context, now time.Time) (int64, error) {
+	return stream.flushSet(ctx, GetParkedSetKey(stream.ShardNum), now)
+}
+
+func (stream *WebhookStream) setAside(
+	ctx context.Context,
+	setKey string,
+	oldMsg ParsedStreamMessage[WebhookStreamMsgData],
+	newMsg *StreamMessage[WebhookStreamMsgData],
+	until time.Time,
+) error {
+	setAsideScript := redis.NewScript(checkLeaseScript + jobIndexScript + `
+    local webhook_stream_key = KEYS[1]
+    local set_key = KEYS[2]
+    local lease_key = KEYS[3]
+    local job_index_key = KEYS[4]
+    local webhook_stream_cg = ARGV[1]
+    local webhook_stream_old_msg_id = ARGV[2]
+    local until_ms = tonumber(ARGV[3])
+    local webhook_stream_new_msg_data = ARGV[4]
+    local lease_token = ARGV[5]
+
+    if not check_lease(lease_key, lease_token) then
+      return 0
+    end
+
+    if redis.call("XACK", webhook_stream_key, webhook_stream_cg, webhook_stream_old_msg_id) == 0 then
+      return 0
+    end
+    redis.call("XDEL", webhook_stream_key, webhook_stream_old_msg_id)
+    redis.call("ZADD", set_key, until_ms, webhook_stream_new_msg_data)
+    index_job(job_index_key, webhook_stream_new_msg_data)
+    return 1
+  `)
+
+	// Executes the script
+	setAside, err := setAsideScript.Run(ctx, stream.client,
+		[]string{
+			stream.Name(),
+			setKey,
+			GetWebhookLeaseKey(stream.ShardNum, oldMsg.Data.WebhookID),
+			GetJobIndexKey(stream.ShardNum),
+		},
+		[]any{
+			stream.ConsumerGroupName(),
+			oldMsg.ID,
+			until.UnixMilli(),
+			newMsg,
+			oldMsg.Data.LeaseToken,
+		},
+	).Int64()
+	if err != nil {
+		return err
+	}
+	if setAside == 0 {
+		return ErrWebhookLeaseLost
+	}
+	return nil
+}
+
+func (stream *WebhookStream) flushSet(ctx context.Context, setKey string, now time.Time) (int64, error) {
+	flushScript := redis.NewScript(jobIndexScript + `
+    local set_key = KEYS[1]
+    local webhook_stream_key = KEYS[2]
+    local job_index_key = KEYS[3]
+    local webhook_stream_msg_data_field = ARGV[1]
+    local now_ms = ARGV[2]
+    local limit = ARGV[3]
+
+    local elems = redis.call("ZRANGE", set_key, "-inf", now_ms, "BYSCORE", "LIMIT", 0, limit)
+    for _, elem in ipairs(elems) do
+      unindex_job(job_index_key, elem)
+      redis.call("XADD", webhook_stream_key, "*", webhook_stream_msg_data_field, elem)
+    end
+    if #elems ~= 0 then
+      redis.call("ZREM", set_key, unpack(elems))
+    end
+    return #elems
+  `)
+
+	// Executes the script
+	count, err := flushScript.Run(ctx, stream.client,
+		[]string{
+			setKey,
+			stream.Name(),
+			GetJobIndexKey(stream.ShardNum),
+		},
+		[]any{
+			GetDataField(),
+			now.UnixMilli(),
+			DelayedSetFlushLimit,
+		},
+	).Int64()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return 0, err
+	}
+
+	// Trims the stream if any jobs were added to it
+	if count != 0 {
+		if err := stream.Trim(ctx); err != nil {
+			return 0, err
 		}
 	}
+
+	// Returns the number of jobs that were moved
+	return count, nil
 }
@@ -0,0 +1,69 @@
+package streams
+
+import (
+	"context"
+	"errors"
+	"log"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestWebhookStreamDrop(t *testing.T) {
+	// Defines helper variables
+	const webhookID = "test-webhook"
+	ctx := context.Background()
+	client := newTestRedisCluster(t)
+	stream := NewWebhookStream(client, 0, nil)
+
+	// Records the webhooks whose jobs were dropped
+	dropped := []string{}
+	stream.OnDrop(func(ctx context.Context, webhookIDs []string, logger *log.Logger) error {
+		dropped = append(dropped, webhookIDs...)
+		return nil
+	})
+
+	// Activates a webhook whose job goes straight into the stream
+	if err := client.XGroupCreateMkStream(ctx, stream.Name(), stream.ConsumerGroupName(), "0").Err(); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Set(ctx, GetLatestBlockHeightKey(stream.ShardNum), 10, 0).Err(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Activate(ctx, NewWebhookStreamMsg(webhookID, 5, false)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Claims the job and fails it with a permanent error
+	result, err := client.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    stream.ConsumerGroupName(),
+		Consumer: "test-consumer",
+		Streams:  []string{stream.Name(), ">"},
+		Count:    1,
+	}).Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rawMsgs, parsedMsgs, err := stream.parseMessages(ctx, result[0].Messages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.handleError(ctx, rawMsgs, parsedMsgs, NewPermanentError(errors.New("simulated failure"))); err != nil {
+		t.Fatal(err)
+	}
+
+	// The job is dead lettered, the webhook is removed from the webhook set, and the owner is told about it
+	if length, err := client.XLen(ctx, stream.DeadLetterStreamName()).Result(); err != nil {
+		t.Fatal(err)
+	} else if length != 1 {
+		t.Fatalf("Expected 1 dead lettered job but got %d", length)
+	}
+	if isMember, err := client.SIsMember(ctx, GetWebhookSetKey(stream.ShardNum), webhookID).Result(); err != nil {
+		t.Fatal(err)
+	} else if isMember {
+		t.Fatal("Expected the webhook to be removed from the webhook set")
+	}
+	if len(dropped) != 1 || dropped[0] != webhookID {
+		t.Fatalf("Expected the drop of webhook %s to be reported but got: %v", webhookID, dropped)
+	}
+}
@@ -18,6 +18,7 @@ import (
 	"github.com/chris-de-leon/block-feed-prototype/tests/testservices"
 	"github.com/chris-de-leon/block-feed-prototype/tests/testwebhooks"
 	"github.com/chris-de-leon/block-feed-prototype/testutils/containers"
+	"github.com/chris-de-leon/block-feed-prototype/webhookpayload"
 
 	"github.com/google/uuid"
 	"github.com/onflow/flow-go-sdk/access/grpc"
@@ -27,7 +28,7 @@ import (
 type (
 	RequestLog struct {
 		Timestamp string
-		Blocks    []string
+		Blocks    []json.RawMessage
 	}
 )
 
@@ -81,8 +82,6 @@ func TestBasic(t *testing.T) {
 
 	// Starts a mock server
 	server := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, req *http.Request) {
-		var blocks []string
-
 		body, err := io.ReadAll(req.Body)
 		if err != nil {
 			t.Fatal(err)
@@ -91,14 +90,14 @@ func TestBasic(t *testing.T) {
 			defer req.Body.Close()
 		}
 
-		err = json.Unmarshal(body, &blocks)
+		payload, err := webhookpayload.Parse(body)
 		if err != nil {
 			t.Fatal(err)
 		}
 
 		reqLog = append(reqLog, RequestLog{
 			Timestamp: time.Now().UTC().String(),
-			Blocks:    blocks,
+			Blocks:    payload.Blocks,
 		})
 	}))
 	t.Cleanup(func() { server.Close() })
@@ -302,7 +301,7 @@ func TestBasic(t *testing.T) {
 			t.Logf("  => Received request at %s containing %d block(s)", req.Timestamp, len(req.Blocks))
 			for _, block := range req.Blocks {
 				var parsedBlock map[string]any
-				err = json.Unmarshal([]byte(block), &parsedBlock)
+				err = json.Unmarshal(block, &parsedBlock)
 				if err != nil {
 					t.Fatal(err)
 				}
@@ -43,7 +43,7 @@ func NewFlowBlockForwarder(
 	// Creates the service
 	return blockforwarder.NewBlockForwarder(
 		flowsrc.NewFlowBlockSource(flowClient, nil, &flowsrc.FlowBlockSourceOpts{}),
-		streams.NewBlockStream(redisClient, chainConfig.ChainID),
+		streams.NewBlockStream(redisClient, chainConfig.ChainID, chainConfig.BlockStream.Opts()),
 	), nil
 }
 
@@ -67,7 +67,7 @@ func NewEthBlockForwarder(
 	// Creates the service
 	return blockforwarder.NewBlockForwarder(
 		ethsrc.NewEthBlockSource(ethClient, nil),
-		streams.NewBlockStream(redisClient, chainConfig.ChainID),
+		streams.NewBlockStream(redisClient, chainConfig.ChainID, chainConfig.BlockStream.Opts()),
 	), nil
 }
 
@@ -125,12 +125,12 @@ func NewBlockRouter(
 	// Creates the webhook streams
 	webhookStreams := make([]*streams.WebhookStream, chainConfig.ShardCount)
 	for shardID := range chainConfig.ShardCount {
-		webhookStreams[shardID] = streams.NewWebhookStream(redisClusterClient, shardID)
+		webhookStreams[shardID] = streams.NewWebhookStream(redisClusterClient, shardID, chainConfig.WebhookStream.Opts())
 	}
 
 	// Creates the consumer
 	return blockrouter.NewBlockRouter(blockrouter.BlockRouterParams{
-		BlockStream:    streams.NewBlockStream(redisClient, chainConfig.ChainID),
+		BlockStream:    streams.NewBlockStream(redisClient, chainConfig.ChainID, chainConfig.BlockStream.Opts()),
 		WebhookStreams: webhookStreams,
 		BlockStore:     store,
 		Opts:           opts,
@@ -161,9 +161,11 @@ func NewBlockRelay(
 
 	// Creates the service
 	return blockrelay.NewBlockRelay(blockrelay.BlockRelayParams{
-		WebhookStream: streams.NewWebhookStream(redisClusterClient, shardID),
-		Queries:       queries.New(mysqlClient),
-		BlockStore:    store,
-		Opts:          opts,
+		WebhookStream:  streams.NewWebhookStream(redisClusterClient, shardID, chainConfig.WebhookStream.Opts()),
+		DeliveryLedger: streams.NewDeliveryLedger(redisClusterClient, shardID, 100),
+		ErrorSink:      streams.NewRedisErrorSink(redisClusterClient, 50),
+		Queries:        queries.New(mysqlClient),
+		BlockStore:     store,
+		Opts:           opts,
 	}), nil
 }
@@ -3,16 +3,17 @@ package testwebhooks
 import (
 	"context"
 	"database/sql"
-	"errors"
 	"math/rand/v2"
 	"time"
 
 	"github.com/chris-de-leon/block-feed-prototype/appenv"
+	"github.com/chris-de-leon/block-feed-prototype/delivery-targets/deliverytarget"
 	"github.com/chris-de-leon/block-feed-prototype/streams"
 	"github.com/chris-de-leon/block-feed-prototype/tests/testqueries"
 	mysqlT "github.com/chris-de-leon/block-feed-prototype/testutils/clients/mysql"
 	redisT "github.com/chris-de-leon/block-feed-prototype/testutils/clients/redis"
 	"github.com/chris-de-leon/block-feed-prototype/testutils/db"
+	"github.com/chris-de-leon/block-feed-prototype/webhooksig"
 
 	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
@@ -31,16 +32,18 @@ func CreateManyWebhooks(
 	webhooks := make([]testqueries.Webhook, count)
 	for i := range count {
 		webhooks[i] = testqueries.Webhook{
-			ID:           uuid.NewString(),
-			CreatedAt:    time.Now(),
-			IsActive:     false,
-			Url:          url,
-			MaxBlocks:    maxBlocks,
-			MaxRetries:   maxRetries,
-			TimeoutMs:    timeoutMs,
-			CustomerID:   customerID,
-			BlockchainID: blockchainID,
-			ShardID:      rand.Int32N(totalShards),
+			ID:            uuid.NewString(),
+			CreatedAt:     time.Now(),
+			IsActive:      false,
+			Url:           url,
+			MaxBlocks:     maxBlocks,
+			MaxRetries:    maxRetries,
+			TimeoutMs:     timeoutMs,
+			CustomerID:    customerID,
+			BlockchainID:  blockchainID,
+			ShardID:       rand.Int32N(totalShards),
+			SigningSecret: webhooksig.SecretPrefix + uuid.NewString(),
+			TargetType:    deliverytarget.TargetTypeHttp,
 		}
 	}
 	return webhooks
@@ -112,59 +115,15 @@ func ActivateManyWebhooks(
 	redisClusterUrl string,
 	webhooks []testqueries.Webhook,
 ) error {
-	shardIdToWebhookIDs := map[int32][]string{}
+	shardIdToJobs := map[int32][]*streams.StreamMessage[streams.WebhookStreamMsgData]{}
 	for _, webhook := range webhooks {
-		shardIdToWebhookIDs[webhook.ShardID] = append(shardIdToWebhookIDs[webhook.ShardID], webhook.ID)
+		shardIdToJobs[webhook.ShardID] = append(shardIdToJobs[webhook.ShardID], streams.NewWebhookStreamMsg(webhook.ID, 0, true))
 	}
 
-	// Script Breakdown:
-	//
-	// Keys:
-	//   1 = key of webhook set
-	//   2 = key of pending set
-	//
-	// ARGV:
-	//   A list of webhook IDs
-	//
-	// Algorithm:
-	//   1. First, we check which webhook IDs have already been activated and which ones haven't
-	//   2. For all the webhooks that HAVE NOT been activated, we'll create a JSON job object for it and add the job to a lua table
-	//   3. All input webhook IDs in ARGV are added to the webhook set (so that they cannot be activated again)
-	//   4. The contents of the lua table containing the jobs is unpacked and added to the pending set for later processing
-	//
-	script := redis.NewScript(`
-    local webhook_set_key = KEYS[1]
-    local pending_set_key = KEYS[2]
-
-    local exists = redis.call("SMISMEMBER", webhook_set_key, unpack(ARGV))
-    
-    local jobs = {}
-    for i = 1, #ARGV do
-      if exists[i] == 0 then 
-        table.insert(jobs, 0)
-        table.insert(jobs, 
-          cjson.encode({ 
-            ['WebhookID'] = ARGV[i], 
-            ['BlockHeight'] = 0,
-            ['IsNew'] = true,
-          })
-        )
-      end
-    end
-
-    redis.call("SADD", webhook_set_key, unpack(ARGV))
-    redis.call("ZADD", pending_set_key, unpack(jobs))
-  `)
-
 	if _, err := redisT.GetTempRedisClusterClient(redisClusterUrl, func(client *redis.ClusterClient) (bool, error) {
-		for shardID, webhooksInShard := range shardIdToWebhookIDs {
-			if err := script.Run(ctx, client,
-				[]string{
-					streams.GetWebhookSetKey(shardID),
-					streams.GetPendingSetKey(shardID),
-				},
-				webhooksInShard,
-			).Err(); err != nil && !errors.Is(err, redis.Nil) {
+		for shardID, jobsInShard := range shardIdToJobs {
+			stream := streams.NewWebhookStream(client, shardID, &streams.RedisStreamOpts{})
+			if _, err := stream.Activate(ctx, jobsInShard...); err != nil {
 				return false, err
 			}
 		}
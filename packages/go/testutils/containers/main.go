@@ -17,6 +17,7 @@ import (
 	"github.com/docker/go-connections/nat"
 	"github.com/testcontainers/testcontainers-go"
 	"github.com/testcontainers/testcontainers-go/modules/compose"
+	"github.com/testcontainers/testcontainers-go/modules/redpanda"
 	"github.com/testcontainers/testcontainers-go/wait"
 )
 
@@ -57,6 +58,11 @@ const (
 
 	REDIS_VERSION = "7.2.1-alpine3.18"
 	REDIS_PORT    = nat.Port("6379/tcp")
+
+	REDPANDA_VERSION = "v24.2.7"
+
+	RABBITMQ_VERSION = "3.13-alpine"
+	RABBITMQ_PORT    = nat.Port("5672/tcp")
 )
 
 type (
@@ -466,6 +472,77 @@ func NewRedisContainer(ctx context.Context, t *testing.T, cmd []string) (*Contai
 	}, nil
 }
 
+func NewRedpandaContainer(ctx context.Context, t *testing.T) (*ContainerWithConnectionInfo, error) {
+	// Creates the container
+	container, err := redpanda.Run(ctx, fmt.Sprintf("docker.redpanda.com/redpandadata/redpanda:%s", REDPANDA_VERSION))
+
+	// Schedules the container for termination once the test case is completed
+	if err != nil {
+		return nil, err
+	} else {
+		ScheduleContainerTermination(t, container)
+	}
+
+	// Gets the address of the kafka API
+	seedBroker, err := container.KafkaSeedBroker(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parses the host and port from the broker address
+	host, port, err := net.SplitHostPort(seedBroker)
+	if err != nil {
+		return nil, err
+	}
+
+	// Returns the container info
+	return &ContainerWithConnectionInfo{
+		Container: container,
+		Conn: &HostConnectionInfo{
+			Url:  seedBroker,
+			Host: host,
+			Port: nat.Port(fmt.Sprintf("%s/tcp", port)),
+		},
+	}, nil
+}
+
+func NewRabbitMQContainer(ctx context.Context, t *testing.T) (*ContainerWithConnectionInfo, error) {
+	// Creates the container
+	version := RABBITMQ_VERSION
+	container, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: testcontainers.ContainerRequest{
+			ImagePlatform: DOCKER_PLATFORM,
+			Image:         fmt.Sprintf("rabbitmq:%s", version),
+			ExposedPorts:  []string{RABBITMQ_PORT.Port()},
+			WaitingFor:    wait.ForLog("Server startup complete"),
+		},
+		Started: true,
+	})
+
+	// Schedules the container for termination once the test case is completed
+	if err != nil {
+		return nil, err
+	} else {
+		ScheduleContainerTermination(t, container)
+	}
+
+	// Gets the connection info of the container
+	conn, err := GetConnectionInfo(ctx, container, RABBITMQ_PORT)
+	if err != nil {
+		return nil, err
+	}
+
+	// Returns the container info
+	return &ContainerWithConnectionInfo{
+		Container: container,
+		Conn:      conn,
+	}, nil
+}
+
+func AmqpUrl(conn HostConnectionInfo) string {
+	return fmt.Sprintf("amqp://guest:guest@%s:%s/", conn.Host, conn.Port.Port())
+}
+
 func RedisDefaultCmd() []string {
 	return []string{
 		"redis-server",
@@ -0,0 +1,191 @@
+// Package webhookauth holds the credentials that block-feed presents to webhooks whose
+// endpoints require authentication.
+//
+// A webhook's credentials are stored as a single JSON document which looks like this:
+//
+//	{
+//	  "headers": {"Authorization": "Bearer ..."},
+//	  "basicAuth": {"username": "...", "password": "..."},
+//	  "clientCert": "acme-prod"
+//	}
+//
+// Every field is optional. Headers are added to each request (they can't replace the
+// headers that block-feed sets itself), basic auth is sent as an Authorization header,
+// and clientCert names a certificate and key pair in a CertStore which is presented to
+// the endpoint during the TLS handshake (mutual TLS).
+//
+// The document is encrypted at rest with AES-256-GCM (see Cipher). The webhook's ID is
+// used as additional authenticated data, so the credentials of one webhook can't be
+// copied over to another one.
+package webhookauth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// The size of an encryption key in bytes (AES-256)
+	KeySize = 32
+
+	// The file names of a certificate and its key within a CertStore entry
+	CertFileName = "tls.crt"
+	KeyFileName  = "tls.key"
+)
+
+var (
+	ErrInvalidCiphertext = errors.New("webhookauth: credentials could not be decrypted")
+	ErrInvalidCertName   = errors.New("webhookauth: invalid client certificate name")
+)
+
+type (
+	BasicAuth struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+
+	Config struct {
+		Headers    map[string]string `json:"headers,omitempty"`
+		BasicAuth  *BasicAuth        `json:"basicAuth,omitempty"`
+		ClientCert string            `json:"clientCert,omitempty"`
+	}
+
+	// Cipher encrypts and decrypts credentials. The encrypted form is the base64 encoding
+	// of the nonce followed by the ciphertext (which ends with the GCM tag).
+	Cipher struct {
+		aead cipher.AEAD
+	}
+
+	// CertStore loads client certificates from a directory in which each certificate has a
+	// folder of its own (e.g. <dir>/acme-prod/tls.crt and <dir>/acme-prod/tls.key). This
+	// matches the layout of mounted Kubernetes TLS secrets. Certificates are reloaded when
+	// their files change so that they can be rotated without a restart.
+	CertStore struct {
+		dir   string
+		mutex sync.Mutex
+		certs map[string]*storedCert
+	}
+
+	storedCert struct {
+		cert    *tls.Certificate
+		modTime time.Time
+	}
+)
+
+func NewCipher(key []byte) (*Cipher, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("webhookauth: key must be %d bytes but got %d", KeySize, len(key))
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Cipher{aead: aead}, nil
+}
+
+// Encrypts the credentials of a webhook
+func (c *Cipher) Encrypt(webhookID string, config *Config) (string, error) {
+	plaintext, err := json.Marshal(config)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(c.aead.Seal(nonce, nonce, plaintext, []byte(webhookID))), nil
+}
+
+// Decrypts the credentials of a webhook
+func (c *Cipher) Decrypt(webhookID string, encrypted string) (*Config, error) {
+	data, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCiphertext, err)
+	}
+	if len(data) < c.aead.NonceSize() {
+		return nil, ErrInvalidCiphertext
+	}
+
+	nonce, ciphertext := data[:c.aead.NonceSize()], data[c.aead.NonceSize():]
+	plaintext, err := c.aead.Open(nil, nonce, ciphertext, []byte(webhookID))
+	if err != nil {
+		return nil, ErrInvalidCiphertext
+	}
+
+	var config Config
+	if err := json.Unmarshal(plaintext, &config); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// Adds the credentials to a request. This should be called before any other headers are set
+// so that the custom headers can't replace them.
+func (config *Config) Apply(req *http.Request) {
+	for k, v := range config.Headers {
+		req.Header.Set(k, v)
+	}
+	if config.BasicAuth != nil {
+		req.SetBasicAuth(config.BasicAuth.Username, config.BasicAuth.Password)
+	}
+}
+
+func NewCertStore(dir string) *CertStore {
+	return &CertStore{
+		dir:   dir,
+		certs: make(map[string]*storedCert),
+	}
+}
+
+// Gets a client certificate by name
+func (store *CertStore) Get(name string) (*tls.Certificate, error) {
+	// Names can't point outside of the store
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return nil, fmt.Errorf("%w: \"%s\"", ErrInvalidCertName, name)
+	}
+	certFile := filepath.Join(store.dir, name, CertFileName)
+	keyFile := filepath.Join(store.dir, name, KeyFileName)
+
+	// Checks when the certificate was last changed
+	info, err := os.Stat(certFile)
+	if err != nil {
+		return nil, err
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	// Returns the cached certificate if it's still up to date
+	if stored, exists := store.certs[name]; exists && stored.modTime.Equal(info.ModTime()) {
+		return stored.cert, nil
+	}
+
+	// Otherwise the certificate is loaded from disk
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	store.certs[name] = &storedCert{cert: &cert, modTime: info.ModTime()}
+	return &cert, nil
+}
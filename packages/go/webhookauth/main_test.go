@@ -0,0 +1,77 @@
+package webhookauth
+
+import (
+	"crypto/rand"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestCipher(t *testing.T) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := &Config{
+		Headers:    map[string]string{"Authorization": "Bearer token"},
+		BasicAuth:  &BasicAuth{Username: "user", Password: "pass"},
+		ClientCert: "acme",
+	}
+	encrypted, err := c.Encrypt("webhook-1", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("decrypts the credentials of the same webhook", func(t *testing.T) {
+		decrypted, err := c.Decrypt("webhook-1", encrypted)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if decrypted.Headers["Authorization"] != "Bearer token" || decrypted.BasicAuth.Password != "pass" || decrypted.ClientCert != "acme" {
+			t.Fatalf("Unexpected credentials: %+v", decrypted)
+		}
+	})
+
+	t.Run("rejects credentials that belong to another webhook", func(t *testing.T) {
+		if _, err := c.Decrypt("webhook-2", encrypted); !errors.Is(err, ErrInvalidCiphertext) {
+			t.Fatalf("Expected ErrInvalidCiphertext but got: %v", err)
+		}
+	})
+
+	t.Run("rejects invalid keys", func(t *testing.T) {
+		if _, err := NewCipher(key[:16]); err == nil {
+			t.Fatal("Expected an error")
+		}
+	})
+
+	t.Run("applies the credentials to requests", func(t *testing.T) {
+		req, err := http.NewRequest("POST", "https://example.com", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		config.Apply(req)
+		if req.Header.Get("Authorization") == "Bearer token" {
+			t.Fatal("Expected basic auth to take precedence over the custom Authorization header")
+		}
+		if user, pass, ok := req.BasicAuth(); !ok || user != "user" || pass != "pass" {
+			t.Fatalf("Unexpected basic auth: %s %s %v", user, pass, ok)
+		}
+	})
+}
+
+func TestCertStore(t *testing.T) {
+	store := NewCertStore(t.TempDir())
+	for _, name := range []string{"", ".", "..", "../etc", "a/b", `a\b`} {
+		if _, err := store.Get(name); !errors.Is(err, ErrInvalidCertName) {
+			t.Fatalf("Expected ErrInvalidCertName for %q but got: %v", name, err)
+		}
+	}
+	if _, err := store.Get("missing"); err == nil {
+		t.Fatal("Expected an error for a missing certificate")
+	}
+}
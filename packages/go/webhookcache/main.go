@@ -0,0 +1,216 @@
+// Package webhookcache keeps recently used webhook configs in memory so that processors
+// don't need to query MySQL for every job they handle.
+//
+// The cache is bounded by both size and age. Once it is full, the least recently used
+// webhook is evicted, and webhooks that were loaded more than TTL ago are loaded again.
+//
+// Whenever a webhook is updated or deleted, the writer should call Publish. Every cache
+// that is subscribed to the redis cluster (see WebhookCache.Subscribe) then drops its copy
+// of the webhook so that the change takes effect right away. If an invalidation is missed
+// (e.g. while a processor is reconnecting to redis), then the TTL bounds how long the old
+// config is used for.
+package webhookcache
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/chris-de-leon/block-feed-prototype/queries"
+	"github.com/chris-de-leon/block-feed-prototype/streams"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	InvalidationChannelKey = "webhook-invalidations"
+
+	// Published in place of a webhook ID to drop every webhook from the caches
+	InvalidateAll = "*"
+)
+
+type (
+	// Loads a webhook from the source of truth (e.g. queries.Queries.WebhooksFindOne)
+	WebhookLoader func(ctx context.Context, webhookID string) (*queries.Webhook, error)
+
+	WebhookCacheOpts struct {
+		TTL        time.Duration
+		MaxEntries int
+	}
+
+	WebhookCache struct {
+		client  *redis.ClusterClient
+		loader  WebhookLoader
+		opts    *WebhookCacheOpts
+		mutex   sync.Mutex
+		entries map[string]*list.Element
+		lru     *list.List // the front of the list is the most recently used webhook
+		now     func() time.Time
+
+		// Incremented on every invalidation so that a webhook which was loaded before an
+		// invalidation arrived isn't cached (it may be outdated)
+		generation uint64
+	}
+
+	entry struct {
+		webhook   *queries.Webhook
+		expiresAt time.Time
+	}
+)
+
+func GetInvalidationChannel() string {
+	return streams.NamespaceJoin(InvalidationChannelKey)
+}
+
+// Tells every subscribed cache that a webhook was updated or deleted
+func Publish(ctx context.Context, client redis.UniversalClient, webhookID string) error {
+	return client.Publish(ctx, GetInvalidationChannel(), webhookID).Err()
+}
+
+func NewWebhookCache(client *redis.ClusterClient, loader WebhookLoader, opts *WebhookCacheOpts) *WebhookCache {
+	return &WebhookCache{
+		client:  client,
+		loader:  loader,
+		opts:    opts,
+		entries: map[string]*list.Element{},
+		lru:     list.New(),
+		now:     time.Now,
+	}
+}
+
+// Gets a webhook from the cache or loads it if it isn't cached (or it has expired). Errors
+// from the loader are returned as is and nothing is cached, so a webhook that was deleted
+// is reported as missing every time.
+func (cache *WebhookCache) Get(ctx context.Context, webhookID string) (*queries.Webhook, error) {
+	webhook, generation, exists := cache.get(webhookID)
+	if exists {
+		return webhook, nil
+	}
+
+	webhook, err := cache.loader(ctx, webhookID)
+	if err != nil {
+		return nil, err
+	}
+
+	cache.put(webhook, generation)
+	return copyWebhook(webhook), nil
+}
+
+// Drops a webhook from the cache
+func (cache *WebhookCache) Invalidate(webhookID string) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	cache.generation++
+	if elem, exists := cache.entries[webhookID]; exists {
+		cache.lru.Remove(elem)
+		delete(cache.entries, webhookID)
+	}
+}
+
+// Drops every webhook from the cache
+func (cache *WebhookCache) InvalidateAll() {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	cache.generation++
+	cache.entries = map[string]*list.Element{}
+	cache.lru.Init()
+}
+
+// Gets the number of webhooks in the cache
+func (cache *WebhookCache) Len() int {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	return cache.lru.Len()
+}
+
+// Listens for invalidations until the context is cancelled. Every time the subscription
+// is (re)established the whole cache is dropped, since invalidations may have been missed
+// while there was no subscription.
+func (cache *WebhookCache) Subscribe(ctx context.Context) error {
+	pubsub := cache.client.Subscribe(ctx, GetInvalidationChannel())
+	defer pubsub.Close()
+
+	for {
+		msg, err := pubsub.Receive(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			if errors.Is(err, redis.ErrClosed) {
+				return err
+			}
+
+			// Waits a bit before trying again so that a redis outage isn't a busy loop
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(time.Second):
+				continue
+			}
+		}
+
+		switch msg := msg.(type) {
+		case *redis.Subscription:
+			cache.InvalidateAll()
+		case *redis.Message:
+			if msg.Payload == InvalidateAll {
+				cache.InvalidateAll()
+			} else {
+				cache.Invalidate(msg.Payload)
+			}
+		}
+	}
+}
+
+func (cache *WebhookCache) get(webhookID string) (*queries.Webhook, uint64, bool) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	elem, exists := cache.entries[webhookID]
+	if !exists {
+		return nil, cache.generation, false
+	}
+
+	cached := elem.Value.(*entry)
+	if !cache.now().Before(cached.expiresAt) {
+		cache.lru.Remove(elem)
+		delete(cache.entries, webhookID)
+		return nil, cache.generation, false
+	}
+
+	cache.lru.MoveToFront(elem)
+	return copyWebhook(cached.webhook), cache.generation, true
+}
+
+func (cache *WebhookCache) put(webhook *queries.Webhook, generation uint64) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	if generation != cache.generation {
+		return
+	}
+
+	cached := &entry{webhook: copyWebhook(webhook), expiresAt: cache.now().Add(cache.opts.TTL)}
+	if elem, exists := cache.entries[webhook.ID]; exists {
+		elem.Value = cached
+		cache.lru.MoveToFront(elem)
+		return
+	}
+
+	cache.entries[webhook.ID] = cache.lru.PushFront(cached)
+	for cache.opts.MaxEntries > 0 && cache.lru.Len() > cache.opts.MaxEntries {
+		oldest := cache.lru.Back()
+		cache.lru.Remove(oldest)
+		delete(cache.entries, oldest.Value.(*entry).webhook.ID)
+	}
+}
+
+// Callers get their own copy so that they can't modify the cached webhook
+func copyWebhook(webhook *queries.Webhook) *queries.Webhook {
+	webhookCopy := *webhook
+	return &webhookCopy
+}
@@ -0,0 +1,129 @@
+package webhookcache
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/chris-de-leon/block-feed-prototype/queries"
+)
+
+type testLoader struct {
+	webhooks map[string]*queries.Webhook
+	loads    map[string]int
+	onLoad   func()
+}
+
+func (loader *testLoader) load(ctx context.Context, webhookID string) (*queries.Webhook, error) {
+	loader.loads[webhookID]++
+	if loader.onLoad != nil {
+		loader.onLoad()
+	}
+	if webhook, exists := loader.webhooks[webhookID]; exists {
+		webhookCopy := *webhook
+		return &webhookCopy, nil
+	}
+	return nil, sql.ErrNoRows
+}
+
+func newTestCache(maxEntries int) (*WebhookCache, *testLoader, *time.Time) {
+	loader := &testLoader{
+		webhooks: map[string]*queries.Webhook{
+			"a": {ID: "a", Url: "http://a"},
+			"b": {ID: "b", Url: "http://b"},
+			"c": {ID: "c", Url: "http://c"},
+		},
+		loads: map[string]int{},
+	}
+
+	now := time.Unix(0, 0)
+	cache := NewWebhookCache(nil, loader.load, &WebhookCacheOpts{TTL: time.Minute, MaxEntries: maxEntries})
+	cache.now = func() time.Time { return now }
+	return cache, loader, &now
+}
+
+func mustGet(t *testing.T, cache *WebhookCache, webhookID string) *queries.Webhook {
+	webhook, err := cache.Get(context.Background(), webhookID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return webhook
+}
+
+func TestWebhookCache(t *testing.T) {
+	t.Run("caches webhooks", func(t *testing.T) {
+		cache, loader, _ := newTestCache(10)
+		mustGet(t, cache, "a")
+		mustGet(t, cache, "a").Url = "modified"
+		if webhook := mustGet(t, cache, "a"); webhook.Url != "http://a" {
+			t.Fatalf("Expected the cached webhook to be unaffected but got %s", webhook.Url)
+		}
+		if loader.loads["a"] != 1 {
+			t.Fatalf("Expected 1 load but got %d", loader.loads["a"])
+		}
+	})
+
+	t.Run("does not cache missing webhooks", func(t *testing.T) {
+		cache, loader, _ := newTestCache(10)
+		for range 2 {
+			if _, err := cache.Get(context.Background(), "missing"); !errors.Is(err, sql.ErrNoRows) {
+				t.Fatalf("Expected sql.ErrNoRows but got %v", err)
+			}
+		}
+		if loader.loads["missing"] != 2 {
+			t.Fatalf("Expected 2 loads but got %d", loader.loads["missing"])
+		}
+	})
+
+	t.Run("expires webhooks", func(t *testing.T) {
+		cache, loader, now := newTestCache(10)
+		mustGet(t, cache, "a")
+		*now = now.Add(time.Minute)
+		mustGet(t, cache, "a")
+		if loader.loads["a"] != 2 {
+			t.Fatalf("Expected 2 loads but got %d", loader.loads["a"])
+		}
+	})
+
+	t.Run("evicts the least recently used webhook", func(t *testing.T) {
+		cache, loader, _ := newTestCache(2)
+		mustGet(t, cache, "a")
+		mustGet(t, cache, "b")
+		mustGet(t, cache, "a")
+		mustGet(t, cache, "c")
+		if cache.Len() != 2 {
+			t.Fatalf("Expected 2 cached webhooks but got %d", cache.Len())
+		}
+		mustGet(t, cache, "a")
+		mustGet(t, cache, "b")
+		if loader.loads["a"] != 1 || loader.loads["b"] != 2 {
+			t.Fatalf("Expected b to be evicted but got loads %v", loader.loads)
+		}
+	})
+
+	t.Run("invalidates webhooks", func(t *testing.T) {
+		cache, loader, _ := newTestCache(10)
+		mustGet(t, cache, "a")
+		mustGet(t, cache, "b")
+		loader.webhooks["a"] = &queries.Webhook{ID: "a", Url: "http://new-a"}
+		cache.Invalidate("a")
+		if webhook := mustGet(t, cache, "a"); webhook.Url != "http://new-a" {
+			t.Fatalf("Expected the updated webhook but got %s", webhook.Url)
+		}
+		cache.InvalidateAll()
+		if cache.Len() != 0 {
+			t.Fatalf("Expected an empty cache but got %d webhooks", cache.Len())
+		}
+	})
+
+	t.Run("does not cache webhooks that were invalidated while loading", func(t *testing.T) {
+		cache, loader, _ := newTestCache(10)
+		loader.onLoad = func() { cache.Invalidate("a") }
+		mustGet(t, cache, "a")
+		if cache.Len() != 0 {
+			t.Fatalf("Expected an empty cache but got %d webhooks", cache.Len())
+		}
+	})
+}
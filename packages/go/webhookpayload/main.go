@@ -0,0 +1,87 @@
+// Package webhookpayload defines the body of the deliveries that block-feed sends to webhooks.
+//
+// Deliveries are wrapped in a versioned envelope which describes where the blocks came from
+// and embeds each block as a regular JSON object:
+//
+//	{
+//	  "version": 1,
+//	  "chainId": "flow-testnet",
+//	  "webhookId": "9b2f6c1e-...",
+//	  "deliveryId": "4c8e1a7d-...",
+//	  "fromHeight": 100,
+//	  "toHeight": 101,
+//	  "timestamp": "2024-01-01T00:00:00Z",
+//	  "blocks": [{"height":100,...},{"height":101,...}]
+//	}
+//
+// The heights are inclusive and match the X-Block-Feed-Block-Range header. Receivers should
+// check the version before reading the rest of the envelope - fields may be added within a
+// version, but they are never removed or changed.
+//
+// Webhooks that were built against the original format can set their legacy payload flag,
+// in which case the body is a bare JSON array of stringified blocks:
+//
+//	[
+//	 "{\"height\":100,...}",
+//	 "{\"height\":101,...}"
+//	]
+//
+// Parse accepts both formats.
+package webhookpayload
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	// The version of the envelope that is currently sent
+	Version = 1
+
+	// Identifies a delivery across retries - receivers can use it to dedupe deliveries and
+	// echo it back to confirm that a delivery was received
+	DeliveryIDHeader = "X-Block-Feed-Delivery-ID"
+)
+
+var ErrUnsupportedVersion = errors.New("webhookpayload: unsupported payload version")
+
+type Payload struct {
+	Version    int               `json:"version"`
+	ChainID    string            `json:"chainId"`
+	WebhookID  string            `json:"webhookId"`
+	DeliveryID string            `json:"deliveryId"`
+	FromHeight uint64            `json:"fromHeight"`
+	ToHeight   uint64            `json:"toHeight"`
+	Timestamp  time.Time         `json:"timestamp"`
+	Blocks     []json.RawMessage `json:"blocks"`
+}
+
+// Parses the body of a delivery. Legacy payloads only carry blocks, so every other field of
+// the returned payload is left empty (with a version of 0).
+func Parse(body []byte) (*Payload, error) {
+	// Legacy payloads are arrays of strings which each hold a block
+	if trimmed := bytes.TrimSpace(body); len(trimmed) != 0 && trimmed[0] == '[' {
+		var blocks []string
+		if err := json.Unmarshal(trimmed, &blocks); err != nil {
+			return nil, err
+		}
+		payload := &Payload{Blocks: make([]json.RawMessage, len(blocks))}
+		for i, block := range blocks {
+			payload.Blocks[i] = json.RawMessage(block)
+		}
+		return payload, nil
+	}
+
+	// Everything else is an envelope
+	var payload Payload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, err
+	}
+	if payload.Version != Version {
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedVersion, payload.Version)
+	}
+	return &payload, nil
+}
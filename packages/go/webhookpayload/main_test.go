@@ -0,0 +1,37 @@
+package webhookpayload
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	t.Run("parses envelopes", func(t *testing.T) {
+		payload, err := Parse([]byte(`{"version":1,"chainId":"c","webhookId":"w","deliveryId":"d","fromHeight":1,"toHeight":2,"timestamp":"2024-01-01T00:00:00Z","blocks":[{"height":1},{"height":2}]}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if payload.ChainID != "c" || payload.FromHeight != 1 || payload.ToHeight != 2 || len(payload.Blocks) != 2 {
+			t.Fatalf("Unexpected payload: %+v", payload)
+		}
+		if string(payload.Blocks[1]) != `{"height":2}` {
+			t.Fatalf("Unexpected block: %s", payload.Blocks[1])
+		}
+	})
+
+	t.Run("parses legacy payloads", func(t *testing.T) {
+		payload, err := Parse([]byte("[\n \"{\\\"height\\\":1}\"\n]"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if payload.Version != 0 || len(payload.Blocks) != 1 || string(payload.Blocks[0]) != `{"height":1}` {
+			t.Fatalf("Unexpected payload: %+v", payload)
+		}
+	})
+
+	t.Run("rejects unknown versions", func(t *testing.T) {
+		if _, err := Parse([]byte(`{"version":2,"blocks":[]}`)); !errors.Is(err, ErrUnsupportedVersion) {
+			t.Fatalf("Expected ErrUnsupportedVersion but got: %v", err)
+		}
+	})
+}
@@ -0,0 +1,146 @@
+// Package webhooksig signs and verifies the requests that block-feed sends to webhooks.
+//
+// Every request includes a signature header which looks like this:
+//
+//	X-Block-Feed-Signature: t=1700000000,v1=5257a869...,v1=8a3f0c1e...
+//
+// The t field is the unix timestamp (in seconds) of when the request was signed, and
+// each v1 field is a hex encoded HMAC-SHA256 of the timestamp and the request body:
+//
+//	HMAC-SHA256(secret, "<timestamp>.<body>")
+//
+// While a webhook's signing secret is being rotated, requests are signed with both the
+// old and the new secret, which means a header can have more than one v1 field. A request
+// is valid if any of the v1 fields matches the receiver's secret. This gives receivers a
+// grace window in which they can switch over to the new secret without dropping requests.
+//
+// Receivers should use Verify to check the header before trusting the request body:
+//
+//	body, err := io.ReadAll(r.Body)
+//	if err != nil {
+//		...
+//	}
+//	if err := webhooksig.Verify(r.Header.Get(webhooksig.SignatureHeader), body, secret, webhooksig.DefaultTolerance); err != nil {
+//		...
+//	}
+package webhooksig
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	SignatureHeader  = "X-Block-Feed-Signature"
+	SecretPrefix     = "whsec_"
+	DefaultTolerance = 5 * time.Minute
+
+	timestampKey = "t"
+	signatureKey = "v1"
+)
+
+var (
+	ErrInvalidHeader       = errors.New("webhooksig: invalid signature header")
+	ErrNoValidSignature    = errors.New("webhooksig: no signature matches the secret")
+	ErrTimestampOutOfRange = errors.New("webhooksig: timestamp is outside of the tolerance window")
+)
+
+// Generates a new random signing secret
+func GenerateSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return SecretPrefix + hex.EncodeToString(buf), nil
+}
+
+// Computes the hex encoded signature of a request body
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	return hex.EncodeToString(computeSignature(secret, timestamp.Unix(), body))
+}
+
+// Builds the signature header for a request body - one signature is included per secret
+func Header(timestamp time.Time, body []byte, secrets ...string) string {
+	fields := make([]string, 0, len(secrets)+1)
+	fields = append(fields, fmt.Sprintf("%s=%d", timestampKey, timestamp.Unix()))
+	for _, secret := range secrets {
+		fields = append(fields, fmt.Sprintf("%s=%s", signatureKey, Sign(secret, timestamp, body)))
+	}
+	return strings.Join(fields, ",")
+}
+
+// Checks that the signature header was produced from the body using the secret and that
+// it was signed within the tolerance window (a tolerance of 0 skips the timestamp check)
+func Verify(header string, body []byte, secret string, tolerance time.Duration) error {
+	// Parses the header
+	timestamp, signatures, err := parseHeader(header)
+	if err != nil {
+		return err
+	}
+
+	// Rejects old (or future) requests to protect against replay attacks
+	if tolerance > 0 {
+		age := time.Since(time.Unix(timestamp, 0))
+		if age > tolerance || age < -tolerance {
+			return ErrTimestampOutOfRange
+		}
+	}
+
+	// Checks if any of the signatures match
+	expected := computeSignature(secret, timestamp, body)
+	for _, signature := range signatures {
+		if hmac.Equal(expected, signature) {
+			return nil
+		}
+	}
+	return ErrNoValidSignature
+}
+
+func computeSignature(secret string, timestamp int64, body []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return mac.Sum(nil)
+}
+
+func parseHeader(header string) (int64, [][]byte, error) {
+	timestamp := int64(-1)
+	signatures := [][]byte{}
+	for _, field := range strings.Split(header, ",") {
+		key, value, found := strings.Cut(strings.TrimSpace(field), "=")
+		if !found {
+			return 0, nil, ErrInvalidHeader
+		}
+
+		switch key {
+		case timestampKey:
+			t, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return 0, nil, ErrInvalidHeader
+			} else {
+				timestamp = t
+			}
+		case signatureKey:
+			signature, err := hex.DecodeString(value)
+			if err != nil {
+				continue
+			} else {
+				signatures = append(signatures, signature)
+			}
+		}
+	}
+
+	if timestamp < 0 || len(signatures) == 0 {
+		return 0, nil, ErrInvalidHeader
+	}
+
+	return timestamp, signatures, nil
+}
@@ -0,0 +1,67 @@
+package webhooksig
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWebhookSig(t *testing.T) {
+	body := []byte(`["block"]`)
+
+	oldSecret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newSecret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("valid signature", func(t *testing.T) {
+		header := Header(time.Now(), body, newSecret)
+		if err := Verify(header, body, newSecret, DefaultTolerance); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("rotation grace window", func(t *testing.T) {
+		header := Header(time.Now(), body, newSecret, oldSecret)
+		if err := Verify(header, body, oldSecret, DefaultTolerance); err != nil {
+			t.Fatal(err)
+		}
+		if err := Verify(header, body, newSecret, DefaultTolerance); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("wrong secret", func(t *testing.T) {
+		header := Header(time.Now(), body, newSecret)
+		if err := Verify(header, body, oldSecret, DefaultTolerance); !errors.Is(err, ErrNoValidSignature) {
+			t.Fatalf("Expected %v but got %v", ErrNoValidSignature, err)
+		}
+	})
+
+	t.Run("tampered body", func(t *testing.T) {
+		header := Header(time.Now(), body, newSecret)
+		if err := Verify(header, []byte(`["tampered"]`), newSecret, DefaultTolerance); !errors.Is(err, ErrNoValidSignature) {
+			t.Fatalf("Expected %v but got %v", ErrNoValidSignature, err)
+		}
+	})
+
+	t.Run("expired timestamp", func(t *testing.T) {
+		header := Header(time.Now().Add(-2*DefaultTolerance), body, newSecret)
+		if err := Verify(header, body, newSecret, DefaultTolerance); !errors.Is(err, ErrTimestampOutOfRange) {
+			t.Fatalf("Expected %v but got %v", ErrTimestampOutOfRange, err)
+		}
+	})
+
+	t.Run("malformed header", func(t *testing.T) {
+		for _, header := range []string{"", "t=abc,v1=00", "v1=00", "t=1"} {
+			if err := Verify(header, body, newSecret, 0); !errors.Is(err, ErrInvalidHeader) {
+				t.Fatalf("Expected %v for header %q but got %v", ErrInvalidHeader, header, err)
+			}
+		}
+	})
+}
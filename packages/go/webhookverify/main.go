@@ -0,0 +1,162 @@
+// Package webhookverify checks that the owner of a webhook's endpoint agreed to receive
+// deliveries before the webhook is activated.
+//
+// The verifier POSTs a challenge to the endpoint which looks like this:
+//
+//	{"type":"url_verification","challenge":"3f1c9a..."}
+//
+// The request is signed with the webhook's signing secret just like a regular delivery
+// (see webhooksig), so the endpoint can tell that it came from block-feed. The endpoint
+// proves that it is willing to receive deliveries by responding with a 2xx status code and
+// echoing the challenge back, either as the raw response body or as JSON:
+//
+//	{"challenge":"3f1c9a..."}
+//
+// Servers that don't know about block-feed won't echo the challenge, so a customer can't
+// point a webhook at someone else's server.
+package webhookverify
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/chris-de-leon/block-feed-prototype/delivery-targets/deliverytarget"
+	"github.com/chris-de-leon/block-feed-prototype/queries"
+	"github.com/chris-de-leon/block-feed-prototype/webhookauth"
+	"github.com/chris-de-leon/block-feed-prototype/webhooksig"
+)
+
+const (
+	ChallengeType = "url_verification"
+
+	// Caps how much of the response body is read
+	MaxResponseBodyBytes = 4 * 1024
+)
+
+var (
+	ErrChallengeFailed     = errors.New("webhookverify: endpoint did not echo the challenge")
+	ErrClientCertsDisabled = errors.New("webhookverify: client certificates are not supported")
+)
+
+type (
+	Challenge struct {
+		Type      string `json:"type"`
+		Challenge string `json:"challenge"`
+	}
+
+	EndpointVerifier struct {
+		client *http.Client
+
+		// Creates a client which presents the named certificate (nil disables mutual TLS)
+		newCertClient func(certName string) (*http.Client, error)
+	}
+)
+
+func NewEndpointVerifier(client *http.Client, newCertClient func(certName string) (*http.Client, error)) *EndpointVerifier {
+	return &EndpointVerifier{client: client, newCertClient: newCertClient}
+}
+
+// Sends a challenge to the endpoint and checks that it was echoed back. A nil error means
+// that the endpoint is verified. The webhook's credentials (if any) are presented just
+// like they are for deliveries, so endpoints that require authentication can be verified.
+func (verifier *EndpointVerifier) Verify(ctx context.Context, url string, signingSecret string, auth *webhookauth.Config) error {
+	// Picks the client that presents the webhook's certificate (if it has one)
+	client := verifier.client
+	if auth != nil && auth.ClientCert != "" {
+		if verifier.newCertClient == nil {
+			return ErrClientCertsDisabled
+		}
+		certClient, err := verifier.newCertClient(auth.ClientCert)
+		if err != nil {
+			return err
+		}
+		defer certClient.CloseIdleConnections()
+		client = certClient
+	}
+
+	// Generates a new challenge
+	challenge, err := NewChallenge()
+	if err != nil {
+		return err
+	}
+
+	// Encodes the challenge
+	body, err := json.Marshal(challenge)
+	if err != nil {
+		return err
+	}
+
+	// Prepares a signed request
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	} else {
+		if auth != nil {
+			auth.Apply(req)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(webhooksig.SignatureHeader, webhooksig.Header(time.Now(), body, signingSecret))
+	}
+
+	// Sends the request
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// Reads (part of) the response body
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, MaxResponseBodyBytes))
+	if err != nil {
+		return err
+	}
+
+	// Checks that the endpoint accepted the challenge
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%w: endpoint responded with status code %d", ErrChallengeFailed, resp.StatusCode)
+	}
+	if !IsEcho(respBody, challenge.Challenge) {
+		return ErrChallengeFailed
+	}
+	return nil
+}
+
+// Checks if a webhook's current URL was verified. Only HTTP endpoints are challenged, so
+// webhooks with other targets are always considered verified.
+func IsVerified(webhook *queries.Webhook) bool {
+	if webhook.TargetType != deliverytarget.TargetTypeHttp {
+		return true
+	}
+	return webhook.VerifiedUrl.Valid && webhook.VerifiedUrl.String == webhook.Url
+}
+
+// Creates a challenge with a random token
+func NewChallenge() (*Challenge, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	return &Challenge{Type: ChallengeType, Challenge: hex.EncodeToString(buf)}, nil
+}
+
+// Checks if a response body echoes the challenge token (either raw or as JSON)
+func IsEcho(body []byte, token string) bool {
+	if strings.TrimSpace(string(body)) == token {
+		return true
+	}
+
+	var echo Challenge
+	if err := json.Unmarshal(body, &echo); err != nil {
+		return false
+	}
+	return echo.Challenge == token
+}
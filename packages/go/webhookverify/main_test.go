@@ -0,0 +1,105 @@
+package webhookverify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/chris-de-leon/block-feed-prototype/webhookauth"
+	"github.com/chris-de-leon/block-feed-prototype/webhooksig"
+)
+
+func TestEndpointVerifier(t *testing.T) {
+	const secret = "whsec_test"
+
+	// Defines a helper function that creates a server which answers challenges with the given function
+	newServer := func(t *testing.T, answer func(w http.ResponseWriter, challenge *Challenge)) *httptest.Server {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			if err := webhooksig.Verify(r.Header.Get(webhooksig.SignatureHeader), body, secret, webhooksig.DefaultTolerance); err != nil {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			var challenge Challenge
+			if err := json.Unmarshal(body, &challenge); err != nil || challenge.Type != ChallengeType {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			answer(w, &challenge)
+		}))
+		t.Cleanup(server.Close)
+		return server
+	}
+
+	t.Run("accepts endpoints that echo the challenge", func(t *testing.T) {
+		for name, answer := range map[string]func(w http.ResponseWriter, challenge *Challenge){
+			"raw": func(w http.ResponseWriter, challenge *Challenge) {
+				w.Write([]byte(challenge.Challenge))
+			},
+			"json": func(w http.ResponseWriter, challenge *Challenge) {
+				json.NewEncoder(w).Encode(map[string]string{"challenge": challenge.Challenge})
+			},
+		} {
+			server := newServer(t, answer)
+			if err := NewEndpointVerifier(server.Client(), nil).Verify(context.Background(), server.URL, secret, nil); err != nil {
+				t.Fatalf("Expected the %s echo to be accepted but got: %v", name, err)
+			}
+		}
+	})
+
+	t.Run("rejects endpoints that do not echo the challenge", func(t *testing.T) {
+		server := newServer(t, func(w http.ResponseWriter, challenge *Challenge) {
+			w.Write([]byte("ok"))
+		})
+		if err := NewEndpointVerifier(server.Client(), nil).Verify(context.Background(), server.URL, secret, nil); !errors.Is(err, ErrChallengeFailed) {
+			t.Fatalf("Expected ErrChallengeFailed but got: %v", err)
+		}
+	})
+
+	t.Run("rejects endpoints that respond with an error", func(t *testing.T) {
+		server := newServer(t, func(w http.ResponseWriter, challenge *Challenge) {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(challenge.Challenge))
+		})
+		if err := NewEndpointVerifier(server.Client(), nil).Verify(context.Background(), server.URL, secret, nil); !errors.Is(err, ErrChallengeFailed) {
+			t.Fatalf("Expected ErrChallengeFailed but got: %v", err)
+		}
+	})
+
+	t.Run("presents the webhook's credentials", func(t *testing.T) {
+		server := newServer(t, func(w http.ResponseWriter, challenge *Challenge) {
+			w.Write([]byte(challenge.Challenge))
+		})
+		server.Config.Handler = requireHeader(server.Config.Handler, "X-Api-Key", "secret")
+
+		verifier := NewEndpointVerifier(server.Client(), nil)
+		if err := verifier.Verify(context.Background(), server.URL, secret, nil); !errors.Is(err, ErrChallengeFailed) {
+			t.Fatalf("Expected ErrChallengeFailed but got: %v", err)
+		}
+		if err := verifier.Verify(context.Background(), server.URL, secret, &webhookauth.Config{Headers: map[string]string{"X-Api-Key": "secret"}}); err != nil {
+			t.Fatal(err)
+		}
+		if err := verifier.Verify(context.Background(), server.URL, secret, &webhookauth.Config{ClientCert: "acme"}); !errors.Is(err, ErrClientCertsDisabled) {
+			t.Fatalf("Expected ErrClientCertsDisabled but got: %v", err)
+		}
+	})
+}
+
+// Rejects requests that don't have the given header
+func requireHeader(next http.Handler, key string, value string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(key) != value {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
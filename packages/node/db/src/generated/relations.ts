@@ -1,5 +1,5 @@
 import { relations } from "drizzle-orm/relations";
-import { customer, checkoutSession, webhook, blockchain } from "./schema";
+import { customer, checkoutSession, webhook, blockchain, webhookDeliveryAttempt } from "./schema";
 
 export const checkoutSessionRelations = relations(checkoutSession, ({one}) => ({
 	customer: one(customer, {
@@ -13,7 +13,7 @@ export const customerRelations = relations(customer, ({many}) => ({
 	webhooks: many(webhook),
 }));
 
-export const webhookRelations = relations(webhook, ({one}) => ({
+export const webhookRelations = relations(webhook, ({one, many}) => ({
 	customer: one(customer, {
 		fields: [webhook.customerId],
 		references: [customer.id]
@@ -22,8 +22,15 @@ export const webhookRelations = relations(webhook, ({one}) => ({
 		fields: [webhook.blockchainId],
 		references: [blockchain.id]
 	}),
+	webhookDeliveryAttempts: many(webhookDeliveryAttempt),
 }));
 
 export const blockchainRelations = relations(blockchain, ({many}) => ({
 	webhooks: many(webhook),
-}));
\ No newline at end of file
+}));
+export const webhookDeliveryAttemptRelations = relations(webhookDeliveryAttempt, ({one}) => ({
+	webhook: one(webhook, {
+		fields: [webhookDeliveryAttempt.webhookId],
+		references: [webhook.id]
+	}),
+}));
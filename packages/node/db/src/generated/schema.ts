@@ -1,4 +1,4 @@
-import { mysqlTable, mysqlSchema, AnyMySqlColumn, primaryKey, varchar, datetime, int, text, foreignKey, unique, index, tinyint } from "drizzle-orm/mysql-core"
+import { mysqlTable, mysqlSchema, AnyMySqlColumn, primaryKey, varchar, datetime, int, text, foreignKey, unique, index, tinyint, json, bigint } from "drizzle-orm/mysql-core"
 import { sql } from "drizzle-orm"
 
 export const blockchain = mysqlTable("blockchain", {
@@ -10,6 +10,7 @@ export const blockchain = mysqlTable("blockchain", {
 	redisStoreUrl: text("redis_store_url").notNull(),
 	redisClusterUrl: text("redis_cluster_url").notNull(),
 	redisStreamUrl: text("redis_stream_url").notNull(),
+	webhookApiUrl: text("webhook_api_url").notNull(),
 },
 (table) => {
 	return {
@@ -54,12 +55,43 @@ export const webhook = mysqlTable("webhook", {
 	customerId: varchar("customer_id", { length: 255 }).notNull().references(() => customer.id),
 	blockchainId: varchar("blockchain_id", { length: 255 }).notNull().references(() => blockchain.id),
 	shardId: int("shard_id").notNull(),
+	signingSecret: varchar("signing_secret", { length: 255 }).notNull(),
+	previousSigningSecret: varchar("previous_signing_secret", { length: 255 }),
+	previousSigningSecretExpiresAt: datetime("previous_signing_secret_expires_at", { mode: 'string'}),
+	filters: json(),
+	targetType: varchar("target_type", { length: 32 }).default('http').notNull(),
+	targetConfig: json("target_config"),
+	maxPayloadBytes: int("max_payload_bytes").default(0).notNull(),
+	lingerMs: int("linger_ms").default(0).notNull(),
+	startHeight: bigint("start_height", { mode: "number", unsigned: true }),
+	verifiedUrl: text("verified_url"),
+	legacyPayload: tinyint("legacy_payload").default(0).notNull(),
+	encryptedAuth: text("encrypted_auth"),
 },
 (table) => {
 	return {
-		blockchainId: index("blockchain_id").on(table.blockchainId),
+		blockchainId: index("blockchain_id").on(table.blockchainId, table.shardId, table.id),
 		customerId: index("customer_id").on(table.customerId),
 		webhookId: primaryKey({ columns: [table.id], name: "webhook_id"}),
 		id: unique("id").on(table.id, table.createdAt),
 	}
-});
\ No newline at end of file
+});
+export const webhookDeliveryAttempt = mysqlTable("webhook_delivery_attempt", {
+	id: bigint({ mode: "number" }).autoincrement().notNull(),
+	createdAt: datetime("created_at", { mode: 'string'}).default(sql`(CURRENT_TIMESTAMP)`).notNull(),
+	webhookId: varchar("webhook_id", { length: 36 }).notNull().references(() => webhook.id, { onDelete: "cascade" } ),
+	deliveryId: varchar("delivery_id", { length: 36 }).notNull(),
+	startHeight: bigint("start_height", { mode: "number", unsigned: true }).notNull(),
+	endHeight: bigint("end_height", { mode: "number", unsigned: true }).notNull(),
+	attempt: int().notNull(),
+	statusCode: int("status_code"),
+	latencyMs: int("latency_ms").notNull(),
+	error: text(),
+	responseBody: text("response_body"),
+},
+(table) => {
+	return {
+		webhookId: index("webhook_id").on(table.webhookId, table.id),
+		webhookDeliveryAttemptId: primaryKey({ columns: [table.id], name: "webhook_delivery_attempt_id"}),
+	}
+});
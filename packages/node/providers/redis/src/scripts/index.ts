@@ -1,7 +1,5 @@
-import { activate } from "./activate"
 import { xackdel } from "./xackdel"
 
 export const scripts = {
-  activate,
   xackdel,
 }